@@ -0,0 +1,79 @@
+// apikey creates an api key for the clientdb API. The key is printed once, only its hash is stored.
+//
+//	go run ./cmd/apikey -name ci-pipeline -roles viewer
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+)
+
+func main() {
+	name := flag.String("name", "", "name of the key, recorded as the caller identity")
+	roles := flag.String("roles", "", "comma separated roles granted to the key: viewer, editor, billing-admin or admin")
+	flag.Parse()
+
+	if *name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	keyRoles := []string{}
+	for _, role := range strings.Split(*roles, ",") {
+		if role = strings.TrimSpace(role); role == "" {
+			continue
+		}
+		if !auth.IsRole(role) {
+			log.Fatal("Unknown role: ", role)
+		}
+		keyRoles = append(keyRoles, role)
+	}
+
+	config, err := util.LoadConfig()
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ConnectTimeout*time.Duration(config.ConnectRetries))
+	defer cancel()
+
+	client, err := util.DbConnect(ctx, config)
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB: ", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(config.MongoDBName)
+	if err := repository.EnsureMongoIndexes(ctx, db); err != nil {
+		log.Fatal("Failed to create indexes: ", err)
+	}
+
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		log.Fatal("Failed to generate api key: ", err)
+	}
+
+	apiKey := models.APIKey{
+		Name:      *name,
+		KeyHash:   auth.HashAPIKey(key),
+		Roles:     keyRoles,
+		CreatedOn: time.Now(),
+	}
+
+	store := repository.NewMongoStore(db, config.QueryTimeout)
+	if _, err := store.APIKeys.Insert(ctx, apiKey); err != nil {
+		log.Fatal("Failed to store api key: ", err)
+	}
+
+	fmt.Println(key)
+}
@@ -0,0 +1,65 @@
+// migrate converts the amounts of services and invoices stored as floating point numbers to decimals and sets the
+// currency of the documents that don't have one. It maps the service statuses from before the lifecycle onto it,
+// statuses that don't name one, e.g. "Tools", become the status given with -status. Running it again only migrates
+// documents stored since.
+//
+//	go run ./cmd/migrate -currency SEK -status proposed
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/money"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+)
+
+func main() {
+	currency := flag.String("currency", "", "ISO 4217 currency of the existing amounts, e.g. SEK")
+	status := flag.String("status", models.StatusProposed, "status of the services stored with a status that isn't part of the lifecycle")
+	flag.Parse()
+
+	*currency = strings.ToUpper(strings.TrimSpace(*currency))
+	if *currency == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if !money.IsCurrency(*currency) {
+		log.Fatal("Unknown currency: ", *currency)
+	}
+
+	if !models.IsServiceStatus(*status) {
+		log.Fatal("Unknown service status: ", *status)
+	}
+
+	config, err := util.LoadConfig()
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ConnectTimeout*time.Duration(config.ConnectRetries))
+	defer cancel()
+
+	client, err := util.DbConnect(ctx, config)
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB: ", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	// the connect deadline doesn't apply to the migration itself
+	db := client.Database(config.MongoDBName)
+	if _, err := repository.MigrateMoney(context.Background(), db, *currency); err != nil {
+		log.Fatal("Failed to migrate amounts: ", err)
+	}
+
+	if _, err := repository.MigrateServiceStatuses(context.Background(), db, *status); err != nil {
+		log.Fatal("Failed to migrate service statuses: ", err)
+	}
+}
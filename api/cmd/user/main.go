@@ -0,0 +1,86 @@
+// user creates a user logging in to the clientdb API with a password, e.g. from the UI. The password is read
+// from the first line of stdin, only its hash is stored.
+//
+//	go run ./cmd/user -username alice -roles editor < password.txt
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+)
+
+func main() {
+	username := flag.String("username", "", "name the user logs in with, recorded as the caller identity")
+	roles := flag.String("roles", "", "comma separated roles granted to the user: viewer, editor, billing-admin or admin")
+	flag.Parse()
+
+	if *username == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	userRoles := []string{}
+	for _, role := range strings.Split(*roles, ",") {
+		if role = strings.TrimSpace(role); role == "" {
+			continue
+		}
+		if !auth.IsRole(role) {
+			log.Fatal("Unknown role: ", role)
+		}
+		userRoles = append(userRoles, role)
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatal("Failed to read password: ", err)
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		log.Fatal("Invalid password: ", err)
+	}
+
+	config, err := util.LoadConfig()
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ConnectTimeout*time.Duration(config.ConnectRetries))
+	defer cancel()
+
+	client, err := util.DbConnect(ctx, config)
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB: ", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(config.MongoDBName)
+	if err := repository.EnsureMongoIndexes(ctx, db); err != nil {
+		log.Fatal("Failed to create indexes: ", err)
+	}
+
+	user := models.User{
+		Username:     *username,
+		PasswordHash: hash,
+		Roles:        userRoles,
+		CreatedOn:    time.Now(),
+	}
+
+	store := repository.NewMongoStore(db, config.QueryTimeout)
+	if _, err := store.Users.Insert(ctx, user); err != nil {
+		log.Fatal("Failed to store user: ", err)
+	}
+
+	fmt.Fprintln(os.Stderr, "Created user", *username)
+}
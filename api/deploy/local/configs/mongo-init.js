@@ -3,6 +3,16 @@ db = db.getSiblingDB('clientdb');
 db.createCollection('clients');
 db.createCollection('contacts');
 db.createCollection('services');
+db.createCollection('api_keys');
+
+// development api key "cdb_local-development-key", only its SHA-256 hash is stored
+db.api_keys.insertOne(
+  {
+    "name": "local-development",
+    "key_hash": "91659adfeebf657c43977a53ec948464d38380d22435a14a151461cb38ef4860",
+    "roles": ["admin"]
+  }
+);
 db.clients.insertMany(
   [
     {
@@ -140,100 +150,110 @@ db.services.insertMany(
       "service_type": "br.com.uol.Lotstring",
       "service_owner": "Emmit Gearty",
       "service_description": "Dilation of Bladder Neck, Open Approach",
-      "service_status": "Tools",
+      "service_status": "active",
       "invoice_frequency": "Yearly",
-      "Invoice_amount": 256,
-      "management_fee": 90
+      "invoice_amount": NumberDecimal("256"),
+      "management_fee": NumberDecimal("90"),
+      "currency": "SEK"
     },
     {
       "service_name": "Duobam",
       "service_type": "com.ask.Subin",
       "service_owner": "Conan Lewsam",
       "service_description": "Destruction of Bilateral Seminal Vesicles, Open Approach",
-      "service_status": "Jewelry",
+      "service_status": "active",
       "invoice_frequency": "Monthly",
-      "Invoice_amount": 598,
-      "management_fee": 81
+      "invoice_amount": NumberDecimal("598"),
+      "management_fee": NumberDecimal("81"),
+      "currency": "SEK"
     },
     {
       "service_name": "Cardguard",
       "service_type": "com.studiopress.Latlux",
       "service_owner": "Laverna Spender",
       "service_description": "Destruction of Ileocecal Valve, Perc Endo Approach",
-      "service_status": "Sports",
+      "service_status": "onboarding",
       "invoice_frequency": "Daily",
-      "Invoice_amount": 417,
-      "management_fee": 53
+      "invoice_amount": NumberDecimal("417"),
+      "management_fee": NumberDecimal("53"),
+      "currency": "SEK"
     },
     {
       "service_name": "Treeflex",
       "service_type": "com.godaddy.Sub-Ex",
       "service_owner": "Seymour Jenyns",
       "service_description": "Restrict Sigmoid Colon w Extralum Dev, Perc Endo",
-      "service_status": "Sports",
+      "service_status": "active",
       "invoice_frequency": "Weekly",
-      "Invoice_amount": 196,
-      "management_fee": 61
+      "invoice_amount": NumberDecimal("196"),
+      "management_fee": NumberDecimal("61"),
+      "currency": "SEK"
     },
     {
       "service_name": "Treeflex",
       "service_type": "us.imageshack.Wrapsafe",
       "service_owner": "Corene Lipscombe",
       "service_description": "Release Left Innominate Vein, Percutaneous Approach",
-      "service_status": "Jewelry",
+      "service_status": "suspended",
       "invoice_frequency": "Seldom",
-      "Invoice_amount": 716,
-      "management_fee": 93
+      "invoice_amount": NumberDecimal("716"),
+      "management_fee": NumberDecimal("93"),
+      "currency": "SEK"
     },
     {
       "service_name": "Tempsoft",
       "service_type": "com.dropbox.Kanlam",
       "service_owner": "Hewett Heatly",
       "service_description": "Insertion of Ext Fix into Skull, Perc Approach",
-      "service_status": "Jewelry",
+      "service_status": "active",
       "invoice_frequency": "Daily",
-      "Invoice_amount": 287,
-      "management_fee": 34
+      "invoice_amount": NumberDecimal("287"),
+      "management_fee": NumberDecimal("34"),
+      "currency": "SEK"
     },
     {
       "service_name": "Redhold",
       "service_type": "com.surveymonkey.Sonsing",
       "service_owner": "Donall Bontine",
       "service_description": "Extirpation of Matter from L Verteb Art, Open Approach",
-      "service_status": "Kids",
+      "service_status": "proposed",
       "invoice_frequency": "Daily",
-      "Invoice_amount": 927,
-      "management_fee": 60
+      "invoice_amount": NumberDecimal("927"),
+      "management_fee": NumberDecimal("60"),
+      "currency": "SEK"
     },
     {
       "service_name": "Aerified",
       "service_type": "cn.com.sina.Trippledex",
       "service_owner": "Heath Peddel",
       "service_description": "Dilation of Left Hand Artery with 3 Drug-elut, Perc Approach",
-      "service_status": "Jewelry",
+      "service_status": "active",
       "invoice_frequency": "Weekly",
-      "Invoice_amount": 839,
-      "management_fee": 56
+      "invoice_amount": NumberDecimal("839"),
+      "management_fee": NumberDecimal("56"),
+      "currency": "SEK"
     },
     {
       "service_name": "Viva",
       "service_type": "edu.princeton.Aerified",
       "service_owner": "Karie Titford",
       "service_description": "Bypass R Com Iliac Art to B Ext Ilia w Autol Vn, Perc Endo",
-      "service_status": "Games",
+      "service_status": "decommissioned",
       "invoice_frequency": "Seldom",
-      "Invoice_amount": 76,
-      "management_fee": 95
+      "invoice_amount": NumberDecimal("76"),
+      "management_fee": NumberDecimal("95"),
+      "currency": "SEK"
     },
     {
       "service_name": "Flowdesk",
       "service_type": "edu.stanford.Pannier",
       "service_owner": "Stan Wallenger",
       "service_description": "Plaque Radiation of Maxilla",
-      "service_status": "Toys",
+      "service_status": "onboarding",
       "invoice_frequency": "Monthly",
-      "Invoice_amount": 592,
-      "management_fee": 72
+      "invoice_amount": NumberDecimal("592"),
+      "management_fee": NumberDecimal("72"),
+      "currency": "SEK"
     }
   ]
 );
\ No newline at end of file
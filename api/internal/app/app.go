@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// App wires the configuration, the database client, the repositories and the HTTP API together
+type App struct {
+	Config util.Config
+	Client *mongo.Client
+	Store  *repository.Store
+	Router http.Handler
+	// Streams are the open event feeds, they are closed when the server shuts down
+	Streams *controllers.Streams
+}
+
+// New connects to the database and builds the store and router on top of the single client
+func New(ctx context.Context, config util.Config) (*App, error) {
+	client, err := util.DbConnect(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(config.MongoDBName)
+
+	// text indexes are required by the search endpoint and the q filter on the list endpoints, the other indexes
+	// back the trash, the api key lookups, invoices, the audit log and the webhook deliveries
+	if err := repository.EnsureMongoIndexes(ctx, db); err != nil {
+		log.Error("Failed to create indexes: ", err)
+	}
+
+	store := repository.NewMongoStore(db, config.QueryTimeout)
+
+	keys, err := auth.LoadKeySet(config.JWTKeysFile)
+	if err != nil {
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("failed to load JWT key set: %w", err)
+	}
+	authenticator := auth.NewAuthenticator(store.APIKeys, keys, config.JWTIssuer, config.JWTAudience)
+
+	// users log in with a password when a key to sign their tokens is configured
+	var tokens *auth.TokenIssuer
+	if config.JWTSigningKeyID != "" {
+		tokens, err = auth.NewTokenIssuer(keys, config.JWTSigningKeyID, config.JWTIssuer, config.JWTAudience, config.JWTLifetime)
+		if err != nil {
+			client.Disconnect(ctx)
+			return nil, fmt.Errorf("failed to load JWT signing key: %w", err)
+		}
+	}
+
+	streams := controllers.NewStreams()
+
+	return &App{
+		Config:  config,
+		Client:  client,
+		Store:   store,
+		Router:  NewRouter(store, authenticator, tokens, streams, config.AllowedOrigins),
+		Streams: streams,
+	}, nil
+}
+
+// Close disconnects the database client
+func (a *App) Close(ctx context.Context) error {
+	return a.Client.Disconnect(ctx)
+}
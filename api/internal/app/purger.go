@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// PurgeTrash permanently removes the documents that have been in the trash longer than the configured retention,
+// once at start and then every purge interval until ctx is cancelled
+func (a *App) PurgeTrash(ctx context.Context) {
+	if a.Config.TrashRetention <= 0 {
+		log.Info("Trash retention is disabled, deleted documents are kept until they are restored")
+		return
+	}
+
+	ticker := time.NewTicker(a.Config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeTrash(ctx, a.Store, time.Now().Add(-a.Config.TrashRetention))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash removes the documents deleted before the time from every collection, failures are logged and the
+// collection is purged again on the next run
+func purgeTrash(ctx context.Context, store *repository.Store, before time.Time) {
+	bins := []struct {
+		Type string
+		Bin  repository.TrashBin
+	}{
+		{"clients", store.Clients},
+		{"services", store.Services},
+		{"contacts", store.Contacts},
+	}
+
+	for _, bin := range bins {
+		purged, err := bin.Bin.Purge(ctx, before)
+		if err != nil {
+			log.Error("Failed to purge deleted ", bin.Type, ": ", err)
+			continue
+		}
+
+		if purged > 0 {
+			log.Info("Purged ", purged, " deleted ", bin.Type, " from the trash")
+		}
+	}
+}
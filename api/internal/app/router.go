@@ -0,0 +1,83 @@
+package app
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+)
+
+// func Homehandler is dummy func for returning "I'm alive"
+func homeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("I'm alive"))
+}
+
+// commonMiddleware is a middleware for setting content type on on all requests
+func commonMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestID tags every request with an id, taken from the X-Request-ID header when the caller sent one,
+// the id is returned in the response and included in error responses and logs
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(util.RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = util.NewRequestID()
+		}
+
+		w.Header().Set(util.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(util.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+func logger(next http.Handler) http.Handler {
+	if log.GetLevel().String() == "debug" {
+		return handlers.CombinedLoggingHandler(os.Stdout, next)
+	}
+	return next
+}
+
+// NewRouter returns the HTTP API served from store, wrapped in the common middlewares and cors.
+// Everything below /api but the login requires credentials checked by authenticator and a role granting access to
+// the route. Users logging in get tokens issued by tokens, password login is disabled when it is nil. The event
+// feeds are tracked in streams so they can be closed at shutdown.
+func NewRouter(store *repository.Store, authenticator *auth.Authenticator, tokens *auth.TokenIssuer, streams *controllers.Streams, allowedOrigins []string) http.Handler {
+	r := mux.NewRouter()
+
+	r.NotFoundHandler = http.HandlerFunc(controllers.NotFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(controllers.MethodNotAllowed)
+
+	r.Use(commonMiddleware, logger)
+	r.HandleFunc("/", homeHandler)
+
+	handler := controllers.NewHandler(store, tokens, streams, allowedOrigins)
+	// the login is the only route below /api that doesn't require credentials
+	handler.RegisterPublicRoutes(r.PathPrefix("/api").Subrouter())
+
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(controllers.Authenticate(authenticator), controllers.Authorize)
+	handler.RegisterRoutes(api)
+	r.Handle("/", r)
+
+	// setup the cors, credentials are sent as headers and not as cookies so the browser doesn't need to
+	// send credentials with cross origin requests, they would be refused for a wildcard origin anyway
+	c := cors.New(cors.Options{
+		AllowedOrigins: allowedOrigins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "FETCH"},
+		AllowedHeaders: []string{"Accept", "Content-Type", "Authorization", auth.APIKeyHeader, util.RequestIDHeader, "If-Match", "If-None-Match", "Last-Event-ID"},
+		ExposedHeaders: []string{"Content-Type", "Content-Disposition", "Accept", "X-Total-Count", "Content-Range", util.RequestIDHeader, "ETag"},
+	})
+
+	return c.Handler(requestID(r))
+}
@@ -0,0 +1,20 @@
+package app
+
+import (
+	"context"
+
+	"github.com/terrpan/clientdb/internal/webhooks"
+)
+
+// DeliverWebhooks sends the queued change events to the webhooks subscribed to them until ctx is cancelled
+func (a *App) DeliverWebhooks(ctx context.Context) {
+	dispatcher := webhooks.NewDispatcher(a.Store, webhooks.Options{
+		MaxAttempts:  a.Config.WebhookMaxAttempts,
+		Backoff:      a.Config.WebhookBackoff,
+		MaxBackoff:   a.Config.WebhookMaxBackoff,
+		Timeout:      a.Config.WebhookTimeout,
+		PollInterval: a.Config.WebhookPollInterval,
+		Workers:      a.Config.WebhookWorkers,
+	})
+	dispatcher.Run(ctx)
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// APIKeyHeader is the header static api keys are sent in
+const APIKeyHeader = "X-API-Key"
+
+var (
+	// ErrNoCredentials is returned when the request carries neither an api key nor a bearer token
+	ErrNoCredentials = errors.New("missing credentials")
+	// ErrInvalidCredentials is returned when the api key or token is unknown, revoked, expired or badly signed
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// claims are the JWT claims read into an Identity
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+// Authenticator identifies the caller of a request from an api key or a JWT bearer token
+type Authenticator struct {
+	apiKeys  repository.APIKeyRepository
+	keys     *KeySet
+	parser   *jwt.Parser
+	issuer   string
+	audience string
+}
+
+// NewAuthenticator returns an Authenticator looking up api keys in apiKeys and verifying tokens against keys,
+// the iss and aud claims are only checked when issuer and audience are set
+func NewAuthenticator(apiKeys repository.APIKeyRepository, keys *KeySet, issuer string, audience string) *Authenticator {
+	return &Authenticator{
+		apiKeys:  apiKeys,
+		keys:     keys,
+		parser:   jwt.NewParser(jwt.WithValidMethods([]string{"HS256", "RS256"})),
+		issuer:   issuer,
+		audience: audience,
+	}
+}
+
+// Authenticate returns the identity of the caller of r. Errors other than ErrNoCredentials and
+// ErrInvalidCredentials mean the credentials could not be checked, e.g. because the database is down.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return a.authenticateAPIKey(r.Context(), key)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return Identity{}, fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidCredentials)
+	}
+
+	return a.authenticateToken(strings.TrimSpace(parts[1]))
+}
+
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, key string) (Identity, error) {
+	apiKey, err := a.apiKeys.FindByHash(ctx, HashAPIKey(key))
+	if errors.Is(err, repository.ErrNotFound) {
+		return Identity{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if apiKey.RevokedOn != nil && !apiKey.RevokedOn.After(time.Now()) {
+		return Identity{}, fmt.Errorf("%w: api key %s is revoked", ErrInvalidCredentials, apiKey.Name)
+	}
+
+	return Identity{Subject: apiKey.Name, Method: MethodAPIKey, Roles: apiKey.Roles}, nil
+}
+
+func (a *Authenticator) authenticateToken(raw string) (Identity, error) {
+	// read the header first to pick the keys, the signature is verified below
+	unverified, _, err := a.parser.ParseUnverified(raw, &claims{})
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	algorithm, _ := unverified.Header["alg"].(string)
+	keyID, _ := unverified.Header["kid"].(string)
+
+	keys := a.keys.candidates(algorithm, keyID)
+	if len(keys) == 0 {
+		return Identity{}, fmt.Errorf("%w: no key to verify %s token", ErrInvalidCredentials, algorithm)
+	}
+
+	var tokenClaims claims
+	for _, key := range keys {
+		tokenClaims = claims{}
+		_, err = a.parser.ParseWithClaims(raw, &tokenClaims, func(*jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	switch {
+	case tokenClaims.Subject == "":
+		return Identity{}, fmt.Errorf("%w: token has no sub claim", ErrInvalidCredentials)
+	case tokenClaims.ExpiresAt == nil:
+		return Identity{}, fmt.Errorf("%w: token has no exp claim", ErrInvalidCredentials)
+	case a.issuer != "" && !tokenClaims.VerifyIssuer(a.issuer, true):
+		return Identity{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidCredentials)
+	case a.audience != "" && !tokenClaims.VerifyAudience(a.audience, true):
+		return Identity{}, fmt.Errorf("%w: unexpected audience", ErrInvalidCredentials)
+	}
+
+	return Identity{Subject: tokenClaims.Subject, Method: MethodJWT, Roles: tokenClaims.Roles}, nil
+}
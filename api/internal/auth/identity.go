@@ -0,0 +1,30 @@
+package auth
+
+import "context"
+
+// Authentication methods recorded on an Identity
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	// Subject is the api key name or the sub claim of the token
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Roles   []string `json:"roles"`
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity returns a copy of ctx carrying the identity
+func ContextWithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored in ctx, ok is false for unauthenticated requests
+func IdentityFromContext(ctx context.Context) (identity Identity, ok bool) {
+	identity, ok = ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
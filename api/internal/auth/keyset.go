@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// KeySet holds the keys JWTs are verified with. It is read from a JSON Web Key Set document,
+// RSA keys verify RS256 tokens and symmetric (oct) keys verify HS256 tokens.
+// https://datatracker.ietf.org/doc/html/rfc7517
+type KeySet struct {
+	keys []verificationKey
+}
+
+type verificationKey struct {
+	id        string
+	algorithm string
+	key       interface{}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA modulus and exponent
+	N string `json:"n"`
+	E string `json:"e"`
+	// symmetric key
+	K string `json:"k"`
+}
+
+// LoadKeySet reads a key set from a JWKS file, an empty path returns an empty key set rejecting every token
+func LoadKeySet(path string) (*KeySet, error) {
+	if path == "" {
+		return &KeySet{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeySet(data)
+}
+
+// ParseKeySet parses a JWKS document
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	set := &KeySet{}
+	for i, jwk := range document.Keys {
+		// keys meant for encryption are not used to verify signatures
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := parseKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d in key set: %w", i, err)
+		}
+		set.keys = append(set.keys, key)
+	}
+
+	return set, nil
+}
+
+func parseKey(jwk jsonWebKey) (verificationKey, error) {
+	key := verificationKey{id: jwk.Kid, algorithm: jwk.Alg}
+
+	switch jwk.Kty {
+	case "RSA":
+		if key.algorithm == "" {
+			key.algorithm = "RS256"
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return key, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return key, fmt.Errorf("invalid exponent: %w", err)
+		}
+		key.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "oct":
+		if key.algorithm == "" {
+			key.algorithm = "HS256"
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil {
+			return key, fmt.Errorf("invalid symmetric key: %w", err)
+		}
+		if len(secret) < 32 {
+			return key, fmt.Errorf("symmetric key must be at least 256 bits")
+		}
+		key.key = secret
+	default:
+		return key, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+
+	if key.algorithm != "RS256" && key.algorithm != "HS256" {
+		return key, fmt.Errorf("unsupported algorithm %q", key.algorithm)
+	}
+
+	return key, nil
+}
+
+// candidates returns the keys that may have signed a token with the algorithm and key id,
+// tokens without a kid are tried against every key of the algorithm
+func (s *KeySet) candidates(algorithm string, id string) []interface{} {
+	var keys []interface{}
+	for _, key := range s.keys {
+		if key.algorithm != algorithm {
+			continue
+		}
+		if id != "" && key.id != "" && key.id != id {
+			continue
+		}
+		keys = append(keys, key.key)
+	}
+	return keys
+}
+
+// signingKey returns the symmetric key with the id, HS256 tokens can be signed with it
+func (s *KeySet) signingKey(id string) ([]byte, bool) {
+	for _, key := range s.keys {
+		if secret, ok := key.key.([]byte); ok && key.algorithm == "HS256" && key.id == id && id != "" {
+			return secret, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MethodPassword is the authentication method of a user logging in to get a token
+const MethodPassword = "password"
+
+// MinPasswordLength is the length passwords of users must have at least
+const MinPasswordLength = 12
+
+// unknownUserHash is compared against the password of an unknown user, so a login takes as long whether or not
+// the username exists
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+
+// HashPassword returns the bcrypt hash of password
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// Login checks the password of the user with the username and returns the identity a token is issued to. Errors
+// other than ErrInvalidCredentials mean the password could not be checked.
+func Login(ctx context.Context, users repository.UserRepository, username string, password string) (Identity, error) {
+	user, err := users.FindByUsername(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(unknownUserHash, []byte(password))
+		return Identity{}, fmt.Errorf("%w: unknown user %s", ErrInvalidCredentials, username)
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return Identity{}, fmt.Errorf("%w: wrong password for %s", ErrInvalidCredentials, username)
+	}
+
+	if user.DisabledOn != nil && !user.DisabledOn.After(time.Now()) {
+		return Identity{}, fmt.Errorf("%w: user %s is disabled", ErrInvalidCredentials, username)
+	}
+
+	return Identity{Subject: user.Username, Method: MethodPassword, Roles: user.Roles}, nil
+}
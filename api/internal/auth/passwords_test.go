@@ -0,0 +1,9 @@
+package auth
+
+import "testing"
+
+func TestHashPasswordRequiresLength(t *testing.T) {
+	if _, err := HashPassword("short"); err == nil {
+		t.Fatal("short password accepted")
+	}
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"sort"
+
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// Roles granted to api keys and carried in the roles claim of tokens
+const (
+	RoleViewer       = "viewer"
+	RoleEditor       = "editor"
+	RoleBillingAdmin = "billing-admin"
+	RoleAdmin        = "admin"
+)
+
+// Permission is an action on a resource, e.g. clients:delete
+type Permission string
+
+const (
+	ReadClients    Permission = "clients:read"
+	WriteClients   Permission = "clients:write"
+	DeleteClients  Permission = "clients:delete"
+	ReadServices   Permission = "services:read"
+	WriteServices  Permission = "services:write"
+	DeleteServices Permission = "services:delete"
+	ReadContacts   Permission = "contacts:read"
+	WriteContacts  Permission = "contacts:write"
+	DeleteContacts Permission = "contacts:delete"
+	ReadInvoices   Permission = "invoices:read"
+	WriteInvoices  Permission = "invoices:write"
+	ReadReports    Permission = "reports:read"
+	ReadAudit      Permission = "audit:read"
+	// ManageWebhooks covers the webhooks and their delivery logs, which contain documents of every resource
+	ManageWebhooks Permission = "webhooks:manage"
+	// WriteBilling is required to change the fields invoices are based on
+	WriteBilling Permission = "billing:write"
+)
+
+// ReadPermission returns the permission to read the documents of a resource, e.g. clients
+func ReadPermission(resource string) Permission {
+	return Permission(resource + ":read")
+}
+
+// The access policy is declared below, rolePermissions, routePermissions and fieldPermissions are the only
+// place where access is granted.
+
+var readAll = []Permission{ReadClients, ReadServices, ReadContacts}
+
+// rolePermissions lists the permissions granted by each role
+var rolePermissions = map[string][]Permission{
+	RoleViewer: readAll,
+	RoleEditor: append([]Permission{
+		WriteClients, WriteServices, DeleteServices, WriteContacts, DeleteContacts,
+	}, readAll...),
+	RoleBillingAdmin: append([]Permission{
+		WriteServices, WriteBilling, ReadInvoices, WriteInvoices, ReadReports,
+	}, readAll...),
+	RoleAdmin: append([]Permission{
+		WriteClients, DeleteClients, WriteServices, DeleteServices, WriteContacts, DeleteContacts, WriteBilling,
+		ReadInvoices, WriteInvoices, ReadReports, ReadAudit, ManageWebhooks,
+	}, readAll...),
+}
+
+// routePermissions lists the permission required by each named API route, an empty permission only requires an
+// authenticated caller. Routes missing from the list are refused.
+var routePermissions = map[string]Permission{
+	"GetClients":    ReadClients,
+	"GetClientById": ReadClients,
+	"AddClient":     WriteClients,
+	"UpdateClient":  WriteClients,
+	"PatchClient":   WriteClients,
+	"DeleteClient":  DeleteClients,
+	"RestoreClient": DeleteClients,
+	// attaching changes the attached_to_client list of the service or contact
+	"GetClientServices":   ReadServices,
+	"AttachClientService": WriteServices,
+	"DetachClientService": WriteServices,
+	"GetClientContacts":   ReadContacts,
+	"AttachClientContact": WriteContacts,
+	"DetachClientContact": WriteContacts,
+	"GetClientInvoices":   ReadInvoices,
+	"AddClientInvoice":    WriteInvoices,
+	"GetServices":         ReadServices,
+	"GetServiceById":      ReadServices,
+	"AddService":          WriteServices,
+	"UpdateService":       WriteServices,
+	"PatchService":        WriteServices,
+	"DeleteService":       DeleteServices,
+	"RestoreService":      DeleteServices,
+	"TransitionService":   WriteServices,
+	"GetContacts":         ReadContacts,
+	"GetContactById":      ReadContacts,
+	"AddContact":          WriteContacts,
+	"UpdateContact":       WriteContacts,
+	"PatchContact":        WriteContacts,
+	"DeleteContact":       DeleteContacts,
+	"RestoreContact":      DeleteContacts,
+	"GetInvoices":         ReadInvoices,
+	"GetInvoiceById":      ReadInvoices,
+	"TransitionInvoice":   WriteInvoices,
+	"ImportClients":       WriteClients,
+	"ImportServices":      WriteServices,
+	"ImportContacts":      WriteContacts,
+	"ExportClients":       ReadClients,
+	"ExportServices":      ReadServices,
+	"ExportContacts":      ReadContacts,
+	"GetRevenueReport":    ReadReports,
+	"GetAudit":            ReadAudit,
+	// webhooks and their delivery logs
+	"GetWebhooks":              ManageWebhooks,
+	"GetWebhookById":           ManageWebhooks,
+	"AddWebhook":               ManageWebhooks,
+	"UpdateWebhook":            ManageWebhooks,
+	"DeleteWebhook":            ManageWebhooks,
+	"GetWebhookDeliveries":     ManageWebhooks,
+	"RedeliverWebhookDelivery": ManageWebhooks,
+	// search and the trash only return documents of the resources the caller may read
+	"Search":   "",
+	"GetTrash": "",
+	// the event feeds only stream changes of the resources the caller may read
+	"GetEvents":          "",
+	"GetEventsWebSocket": "",
+	// every operation of a batch requires the permission of its own route
+	"Batch": "",
+}
+
+// fieldPermissions lists the fields of a resource that require a permission on top of the write permission
+// of the route to be set or changed
+var fieldPermissions = map[string]map[string]Permission{
+	"services": {
+		"currency":          WriteBilling,
+		"invoice_amount":    WriteBilling,
+		"invoice_frequency": WriteBilling,
+		"management_fee":    WriteBilling,
+	},
+}
+
+// cascadePermissions lists the permissions required on top of clients:delete to apply a cascade policy to the
+// services and contacts attached to a deleted client
+var cascadePermissions = map[string][]Permission{
+	repository.CascadeRestrict: nil,
+	repository.CascadeDetach:   {WriteServices, WriteContacts},
+	repository.CascadeDelete:   {WriteServices, WriteContacts, DeleteServices, DeleteContacts},
+}
+
+// IsRole reports whether role is one of the roles of the policy
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoutePermission returns the permission required by the named route, ok is false for routes missing from the policy
+func RoutePermission(route string) (permission Permission, ok bool) {
+	permission, ok = routePermissions[route]
+	return permission, ok
+}
+
+// CascadePermissions returns the permissions required to delete a client with the cascade policy, ok is false for
+// unknown policies
+func CascadePermissions(cascade string) (permissions []Permission, ok bool) {
+	permissions, ok = cascadePermissions[cascade]
+	return permissions, ok
+}
+
+// Can reports whether any role of the identity grants the permission
+func (i Identity) Can(permission Permission) bool {
+	for _, role := range i.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeniedField is a field the identity may not change and the permission it lacks
+type DeniedField struct {
+	Field      string
+	Permission Permission
+}
+
+// DeniedFields returns the fields of resource among fields that the identity may not change, sorted by name
+func (i Identity) DeniedFields(resource string, fields []string) []DeniedField {
+	var denied []DeniedField
+	for _, field := range fields {
+		permission, ok := fieldPermissions[resource][field]
+		if ok && !i.Can(permission) {
+			denied = append(denied, DeniedField{Field: field, Permission: permission})
+		}
+	}
+
+	sort.Slice(denied, func(a, b int) bool { return denied[a].Field < denied[b].Field })
+	return denied
+}
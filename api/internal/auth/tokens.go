@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenIssuer signs the tokens users get when they log in. It signs with a symmetric key of the key set tokens
+// are verified against, so the Authenticator accepts the tokens it issues.
+type TokenIssuer struct {
+	key      []byte
+	keyID    string
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+// NewTokenIssuer returns a TokenIssuer signing HS256 tokens valid for ttl with the key of keys with the id, the
+// iss and aud claims are only set when issuer and audience are set
+func NewTokenIssuer(keys *KeySet, keyID string, issuer string, audience string, ttl time.Duration) (*TokenIssuer, error) {
+	key, ok := keys.signingKey(keyID)
+	if !ok {
+		return nil, fmt.Errorf("no symmetric key with kid %q in the key set", keyID)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token lifetime must be positive")
+	}
+
+	return &TokenIssuer{key: key, keyID: keyID, issuer: issuer, audience: audience, ttl: ttl}, nil
+}
+
+// Issue returns a token carrying the subject and roles of identity and the time it expires at
+func (i *TokenIssuer) Issue(identity Identity) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(i.ttl)
+
+	tokenClaims := claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   identity.Subject,
+			Issuer:    i.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		Roles: identity.Roles,
+	}
+	if i.audience != "" {
+		tokenClaims.Audience = jwt.ClaimStrings{i.audience}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims)
+	token.Header["kid"] = i.keyID
+
+	signed, err := token.SignedString(i.key)
+	return signed, expires, err
+}
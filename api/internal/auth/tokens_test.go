@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIssuedTokensAreAccepted(t *testing.T) {
+	secret := base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	keys, err := ParseKeySet([]byte(`{"keys":[{"kty":"oct","kid":"login","k":"` + secret + `"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewTokenIssuer(keys, "other", "", "", time.Hour); err == nil {
+		t.Fatal("issuer created with an unknown key")
+	}
+
+	issuer, err := NewTokenIssuer(keys, "login", "clientdb", "clientdb-ui", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, expires, err := issuer.Issue(Identity{Subject: "alice", Method: MethodPassword, Roles: []string{RoleEditor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expires) <= 59*time.Minute {
+		t.Fatalf("token expires at %s", expires)
+	}
+
+	r := httptest.NewRequest("GET", "/api/clients", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	identity, err := NewAuthenticator(nil, keys, "clientdb", "clientdb-ui").Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "alice" || identity.Method != MethodJWT || len(identity.Roles) != 1 || identity.Roles[0] != RoleEditor {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	// the audience is checked
+	if _, err := NewAuthenticator(nil, keys, "", "other").Authenticate(r); err == nil {
+		t.Fatal("token accepted for another audience")
+	}
+}
@@ -0,0 +1,178 @@
+// Package billing turns the invoice fields of services into invoices and recurring revenue
+package billing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/money"
+)
+
+// cycle is the length of a billing cycle in calendar months or, for cycles shorter than a month, in days
+type cycle struct {
+	months, days int
+}
+
+// cycles maps the invoice frequencies of services, compared case insensitive, to the length of their billing cycle
+var cycles = map[string]cycle{
+	"daily":     {days: 1},
+	"weekly":    {days: 7},
+	"monthly":   {months: 1},
+	"quarterly": {months: 3},
+	"yearly":    {months: 12},
+	"annually":  {months: 12},
+}
+
+// UnknownFrequencyError is returned for a service with an invoice frequency that isn't a billing cycle
+type UnknownFrequencyError struct {
+	Frequency string
+}
+
+func (e *UnknownFrequencyError) Error() string {
+	return "unknown invoice frequency: " + e.Frequency
+}
+
+// Cycles returns the number of billing cycles of frequency covered by the period from start to end, counted in
+// calendar days. Cycles of months are counted in calendar months from start, a remaining part of a month is
+// pro-rated by the days of that month, so October is 1/12 of a yearly cycle and January 1st to February 15th is
+// 1 14/28 monthly cycles. Unknown frequencies return an UnknownFrequencyError.
+func Cycles(frequency string, start time.Time, end time.Time) (decimal.Decimal, error) {
+	length, ok := cycles[strings.ToLower(strings.TrimSpace(frequency))]
+	if !ok {
+		return decimal.Zero, &UnknownFrequencyError{Frequency: frequency}
+	}
+
+	if length.months == 0 {
+		return fraction(days(start, end), length.days), nil
+	}
+
+	return months(start, end).Div(decimal.NewFromInt(int64(length.months))), nil
+}
+
+// months returns the number of calendar months from start to end
+func months(start time.Time, end time.Time) decimal.Decimal {
+	count := decimal.Zero
+	for cursor, whole := start, 1; cursor.Before(end); whole++ {
+		// step from start every time, so the day of the month doesn't drift after a shorter month
+		next := start.AddDate(0, whole, 0)
+		if !next.After(end) {
+			count = count.Add(decimal.NewFromInt(1))
+			cursor = next
+			continue
+		}
+		count = count.Add(fraction(days(cursor, end), days(cursor, next)))
+		break
+	}
+	return count
+}
+
+// days returns the number of calendar days from the date of start to the date of end
+func days(start time.Time, end time.Time) int {
+	from := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// fraction returns numerator divided by denominator as a decimal
+func fraction(numerator int, denominator int) decimal.Decimal {
+	return decimal.NewFromInt(int64(numerator)).Div(decimal.NewFromInt(int64(denominator)))
+}
+
+// daysPerMonth is the average length of a month, used to normalize cycles shorter than a month
+const daysPerMonth = 365.0 / 12
+
+// MonthlyFactors returns the factor turning an amount billed per cycle of each invoice frequency into a monthly
+// amount, keyed by the lower case frequency, e.g. 1/12 for yearly
+func MonthlyFactors() map[string]float64 {
+	factors := map[string]float64{}
+	for frequency, length := range cycles {
+		if length.months > 0 {
+			factors[frequency] = 1 / float64(length.months)
+		} else {
+			factors[frequency] = daysPerMonth / float64(length.days)
+		}
+	}
+	return factors
+}
+
+// Billable reports whether the service has an amount to bill
+func Billable(service models.ServiceResponse) bool {
+	return !service.InvoiceAmount.IsZero() || !service.ManagementFee.IsZero()
+}
+
+// Draft returns a draft invoice billing services to the client in currency for the period from start to end, the
+// services are expected to be billed in currency. Every service gets a line for its invoice amount and one for its
+// management fee, both per billing cycle of its invoice frequency and pro-rated to the days of the period it was
+// billable, a service that changed status during the period is billed from that change and one that changed it at
+// the end of the period or later is left out. Amounts are rounded to the minor unit of the currency and services
+// without amounts are left out. A service with an unknown invoice frequency returns an UnknownFrequencyError wrapped
+// with the service.
+func Draft(client models.ClientBase, currency string, services []models.ServiceResponse, start time.Time, end time.Time) (models.Invoice, error) {
+	invoice := models.Invoice{
+		ClientID:    client.ID,
+		ClientName:  client.ClientName,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Status:      models.InvoiceDraft,
+		Currency:    currency,
+		Lines:       []models.InvoiceLine{},
+	}
+	places := money.MinorUnits(currency)
+
+	for _, service := range services {
+		if !Billable(service) {
+			continue
+		}
+
+		// the services are billed in their current status, it holds since the last change, so a service that got it
+		// at the end of the period or later wasn't billable during the period
+		if !service.StatusChangedOn.IsZero() && !service.StatusChangedOn.Before(end) {
+			continue
+		}
+		billedFrom := start
+		if service.StatusChangedOn.After(start) {
+			billedFrom = service.StatusChangedOn
+		}
+
+		quantity, err := Cycles(service.InvoiceFrequency, billedFrom, end)
+		if err != nil {
+			return models.Invoice{}, fmt.Errorf("service %s (%s): %w", service.ServiceName, service.ID.Hex(), err)
+		}
+
+		// amounts are computed from the exact quantity, the rounded one is only shown on the line
+		shown, _ := quantity.Round(4).Float64()
+		line := models.InvoiceLine{
+			ServiceID:        service.ID,
+			InvoiceFrequency: service.InvoiceFrequency,
+			Quantity:         shown,
+		}
+
+		if !service.InvoiceAmount.IsZero() {
+			line.Description = service.ServiceName
+			line.UnitAmount = service.InvoiceAmount
+			line.Amount = service.InvoiceAmount.MulDecimal(quantity).Round(places)
+			invoice.Lines = append(invoice.Lines, line)
+		}
+
+		if !service.ManagementFee.IsZero() {
+			line.Description = service.ServiceName + " management fee"
+			line.UnitAmount = service.ManagementFee
+			line.Amount = service.ManagementFee.MulDecimal(quantity).Round(places)
+			invoice.Lines = append(invoice.Lines, line)
+		}
+	}
+
+	for _, line := range invoice.Lines {
+		invoice.Total = invoice.Total.Add(line.Amount)
+	}
+
+	return invoice, nil
+}
+
+// Number formats the sequence number of an invoice issued in year, e.g. INV-2026-00042
+func Number(year int, sequence int64) string {
+	return fmt.Sprintf("INV-%d-%05d", year, sequence)
+}
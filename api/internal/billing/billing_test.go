@@ -0,0 +1,139 @@
+package billing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func amount(t *testing.T, s string) money.Amount {
+	t.Helper()
+
+	a, err := money.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		frequency  string
+		start, end string
+		want       string
+	}{
+		{"Monthly", "2026-01-01", "2026-02-01", "1"},
+		// the remaining half of February is pro-rated by the 28 days of February
+		{"Monthly", "2026-01-01", "2026-02-15", "1.5"},
+		{"monthly", "2026-10-16", "2026-11-01", "0.5161290322580645"},
+		{"Quarterly", "2026-01-01", "2026-04-01", "1"},
+		{"Yearly", "2026-10-01", "2026-11-01", "0.0833333333333333"},
+		{"Weekly", "2026-10-01", "2026-10-15", "2"},
+		{"Daily", "2026-10-01", "2026-11-01", "31"},
+	}
+	for _, test := range tests {
+		got, err := Cycles(test.frequency, date(t, test.start), date(t, test.end))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != test.want {
+			t.Errorf("Cycles(%q, %s, %s) = %s, want %s", test.frequency, test.start, test.end, got, test.want)
+		}
+	}
+
+	_, err := Cycles("Whenever", date(t, "2026-10-01"), date(t, "2026-11-01"))
+	var unknown *UnknownFrequencyError
+	if !errors.As(err, &unknown) || unknown.Frequency != "Whenever" {
+		t.Fatalf("err = %v, want an UnknownFrequencyError", err)
+	}
+}
+
+func TestDraft(t *testing.T) {
+	client := models.ClientBase{ID: primitive.NewObjectID(), ClientName: "Acme"}
+	start, end := date(t, "2026-10-01"), date(t, "2026-11-01")
+
+	services := []models.ServiceResponse{
+		{ID: primitive.NewObjectID(), ServiceName: "Hosting", InvoiceFrequency: "Yearly", InvoiceAmount: amount(t, "1200"), ManagementFee: amount(t, "120")},
+		// activated halfway through the period
+		{ID: primitive.NewObjectID(), ServiceName: "Backups", InvoiceFrequency: "Monthly", InvoiceAmount: amount(t, "310"), StatusChangedOn: date(t, "2026-10-17")},
+		{ID: primitive.NewObjectID(), ServiceName: "Free", InvoiceFrequency: "Monthly"},
+	}
+
+	invoice, err := Draft(client, "SEK", services, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoice.Lines) != 3 || invoice.Status != models.InvoiceDraft || invoice.ClientName != "Acme" {
+		t.Fatalf("unexpected invoice %+v", invoice)
+	}
+
+	want := []string{"100", "10", "150"}
+	for i, line := range invoice.Lines {
+		if line.Amount.String() != want[i] {
+			t.Errorf("line %d amount = %s, want %s", i, line.Amount, want[i])
+		}
+	}
+	if invoice.Lines[2].Quantity != 0.4839 {
+		t.Errorf("quantity = %v, want 0.4839", invoice.Lines[2].Quantity)
+	}
+	if invoice.Total.String() != "260" {
+		t.Errorf("total = %s, want 260", invoice.Total)
+	}
+
+	// a service that can't be billed fails the draft
+	services = append(services, models.ServiceResponse{ServiceName: "Odd", InvoiceFrequency: "Whenever", InvoiceAmount: amount(t, "50")})
+	if _, err := Draft(client, "SEK", services, start, end); !errors.As(err, new(*UnknownFrequencyError)) {
+		t.Fatalf("err = %v, want an UnknownFrequencyError", err)
+	}
+}
+
+func TestDraftBillsFromTheStatusChange(t *testing.T) {
+	client := models.ClientBase{ID: primitive.NewObjectID(), ClientName: "Acme"}
+	start, end := date(t, "2026-10-01"), date(t, "2026-11-01")
+
+	tests := []struct {
+		changedOn string
+		want      string
+	}{
+		// active since before the period, billed for all of it
+		{"2026-09-15", "310"},
+		// activated during the period, billed from the activation
+		{"2026-10-17", "150"},
+		// activated at the end of the period or later, not billed
+		{"2026-11-01", ""},
+		{"2026-12-05", ""},
+	}
+	for _, test := range tests {
+		services := []models.ServiceResponse{
+			{ID: primitive.NewObjectID(), ServiceName: "Backups", InvoiceFrequency: "Monthly", InvoiceAmount: amount(t, "310"), StatusChangedOn: date(t, test.changedOn)},
+		}
+		invoice, err := Draft(client, "SEK", services, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.want == "" {
+			if len(invoice.Lines) != 0 || !invoice.Total.IsZero() {
+				t.Errorf("service changed on %s: unexpected invoice %+v", test.changedOn, invoice)
+			}
+			continue
+		}
+		if len(invoice.Lines) != 1 || invoice.Total.String() != test.want {
+			t.Errorf("service changed on %s: total = %s, want %s", test.changedOn, invoice.Total, test.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	auditFilterFields = newFilterFields(models.AuditEntry{})
+
+	// auditIgnoredFields change on every write and are left out of the diff
+	auditIgnoredFields = map[string]bool{
+		"_id":         true,
+		"created_on":  true,
+		"modified_on": true,
+		"version":     true,
+	}
+)
+
+// recordAudit writes an audit entry with the fields that differ between before and after, nil stands for a
+// document that doesn't exist (yet). Failures are logged, the change itself has already been made.
+func (h *Handler) recordAudit(r *http.Request, action string, entity string, id primitive.ObjectID, before interface{}, after interface{}) {
+	identity, _ := auth.IdentityFromContext(r.Context())
+	requestID := util.RequestIDFromContext(r.Context())
+
+	changes, err := diffDocuments(before, after)
+	if err != nil {
+		log.WithField("request_id", requestID).Error("Failed to diff ", entity, " ", id.Hex(), " for the audit log: ", err)
+		return
+	}
+
+	entry := models.AuditEntry{
+		Timestamp:  time.Now(),
+		Actor:      identity.Subject,
+		AuthMethod: identity.Method,
+		RequestID:  requestID,
+		Action:     action,
+		Entity:     entity,
+		EntityID:   id,
+		Changes:    changes,
+	}
+
+	if err := h.store.Audit.Insert(r.Context(), entry); err != nil {
+		log.WithField("request_id", requestID).Error("Failed to write audit entry for ", entity, " ", id.Hex(), ": ", err)
+	}
+
+	// every audited change of a client, service or contact is an event for the webhooks
+	h.queueEvent(r, entry, before, after)
+}
+
+// diffDocuments compares the bson documents of before and after field by field, the changes are sorted by field
+func diffDocuments(before interface{}, after interface{}) ([]models.FieldChange, error) {
+	beforeDocument, afterDocument := bson.M{}, bson.M{}
+
+	var err error
+	if before != nil {
+		if beforeDocument, err = document(before); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if afterDocument, err = document(after); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := []models.FieldChange{}
+	for field, value := range afterDocument {
+		if auditIgnoredFields[field] || reflect.DeepEqual(value, beforeDocument[field]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: field, Before: beforeDocument[field], After: value})
+	}
+	for field, value := range beforeDocument {
+		if _, ok := afterDocument[field]; ok || auditIgnoredFields[field] || value == nil {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: field, Before: value})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// GetAudit returns a page of the audit log, newest first, e.g. /api/audit?entity=services&id=...
+// id is the id of the changed document, the other filters work like on the list endpoints, e.g. actor=alice
+// or field=invoice_amount for the entries changing a field.
+func (h *Handler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, auditFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("_sort") == "" {
+		opts.Sort, opts.Order = "timestamp", -1
+	}
+
+	// id refers to the changed document and not to the audit entry
+	query := r.URL.Query()
+	if ids, ok := query["id"]; ok {
+		query["entity_id"] = append(query["entity_id"], ids...)
+		delete(query, "id")
+	}
+
+	opts.Filters, err = parseFilters(query, auditFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	entries, total, err := h.store.Audit.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get audit entries", err)
+		return
+	}
+
+	setRangeHeaders(w, "audit", opts.Start, len(entries), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,52 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func auditLog(t *testing.T, api *testAPI, query string) []models.AuditEntry {
+	t.Helper()
+
+	w := api.request(http.MethodGet, "/api/audit?"+query, "")
+	expectStatus(t, w, http.StatusOK)
+	var entries []models.AuditEntry
+	decode(t, w, &entries)
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme","slack_channel":"#acme"}`)
+	expectStatus(t, api.request(http.MethodPut, "/api/clients/"+id, `{"client_name":"Acme","slack_channel":"#acme-ops"}`, "If-Match", `"1"`), http.StatusOK)
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+id, ""), http.StatusNoContent)
+	api.create("/api/clients", `{"client_name":"Globex"}`)
+
+	entries := auditLog(t, api, "entity=clients&id="+id)
+	if len(entries) != 3 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	// newest first
+	for i, action := range []string{models.AuditDelete, models.AuditUpdate, models.AuditCreate} {
+		if entries[i].Action != action || entries[i].EntityID.Hex() != id || entries[i].Actor != auth.RoleAdmin || entries[i].AuthMethod != auth.MethodAPIKey {
+			t.Fatalf("unexpected entry %d %+v", i, entries[i])
+		}
+	}
+
+	// only the changed fields are recorded
+	update := entries[1].Changes
+	if len(update) != 1 || update[0].Field != "slack_channel" || update[0].Before != "#acme" || update[0].After != "#acme-ops" {
+		t.Fatalf("unexpected changes %+v", update)
+	}
+
+	if entries := auditLog(t, api, "field=slack_channel&action=update"); len(entries) != 1 {
+		t.Fatalf("unexpected entries for a field %+v", entries)
+	}
+
+	// the audit log requires audit:read
+	expectStatus(t, api.as(auth.RoleEditor).request(http.MethodGet, "/api/audit", ""), http.StatusForbidden)
+}
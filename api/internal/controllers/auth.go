@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+)
+
+// Authenticate returns a middleware rejecting requests without valid credentials with 401,
+// the identity of the caller is stored in the request context for the handlers
+func Authenticate(authenticator *auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := authenticator.Authenticate(r)
+			if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+				// the reason is logged, the client only learns that the credentials were rejected
+				log.Debug("Authentication failed: ", err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="clientdb"`)
+				writeProblem(w, r, http.StatusUnauthorized, CodeUnauthorized, "Valid credentials required: "+rejection(err))
+				return
+			}
+
+			if err != nil {
+				writeInternalError(w, r, "Failed to authenticate request", err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.ContextWithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+func rejection(err error) string {
+	if errors.Is(err, auth.ErrNoCredentials) {
+		return "send an " + auth.APIKeyHeader + " header or a bearer token"
+	}
+	return "the api key or token was rejected"
+}
+
+// LoginRequest holds the credentials of a user logging in
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// LoginResponse carries the token of a user that logged in, it is sent as a bearer token until it expires
+type LoginResponse struct {
+	AccessToken string   `json:"access_token"`
+	TokenType   string   `json:"token_type"`
+	ExpiresIn   int64    `json:"expires_in"`
+	Username    string   `json:"username"`
+	Roles       []string `json:"roles"`
+}
+
+// Login checks the username and password of a user and returns a token carrying the roles of the user, so browsers
+// get credentials of their own instead of a shared api key
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	if h.tokens == nil {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Password login is not enabled, configure a JWT signing key")
+		return
+	}
+
+	var login LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if err := validate.Struct(login); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	identity, err := auth.Login(r.Context(), h.store.Users, login.Username, login.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		// the reason is logged, the client doesn't learn whether the user exists
+		log.Info("Login failed: ", err)
+		writeProblem(w, r, http.StatusUnauthorized, CodeUnauthorized, "Invalid username or password")
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to check password", err)
+		return
+	}
+
+	token, expires, err := h.tokens.Issue(identity)
+	if err != nil {
+		writeInternalError(w, r, "Failed to issue token", err)
+		return
+	}
+
+	log.Info("User logged in: ", identity.Subject)
+
+	// tokens must not end up in caches
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LoginResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(expires).Seconds()),
+		Username:    identity.Subject,
+		Roles:       identity.Roles,
+	})
+}
@@ -0,0 +1,67 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+// addUser stores user with the password
+func addUser(t *testing.T, api *testAPI, user models.User, password string) {
+	t.Helper()
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.PasswordHash = hash
+	if _, err := api.store.Users.Insert(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	api := newTestAPI(t)
+	addUser(t, api, models.User{Username: "alice", Roles: []string{auth.RoleViewer}}, "correct horse battery")
+
+	// the login doesn't require credentials
+	api.key = ""
+	w := api.request(http.MethodPost, "/api/login", `{"username":"alice","password":"correct horse battery"}`)
+	expectStatus(t, w, http.StatusOK)
+	var login controllers.LoginResponse
+	decode(t, w, &login)
+	if login.AccessToken == "" || login.TokenType != "Bearer" || login.ExpiresIn <= 0 || login.Username != "alice" {
+		t.Fatalf("unexpected login %+v", login)
+	}
+	if cache := w.Header().Get("Cache-Control"); cache != "no-store" {
+		t.Fatalf("Cache-Control = %q, want no-store", cache)
+	}
+
+	// the token carries the roles of the user
+	bearer := "Bearer " + login.AccessToken
+	expectStatus(t, api.request(http.MethodGet, "/api/clients", "", "Authorization", bearer), http.StatusOK)
+	expectProblem(t, api.request(http.MethodPost, "/api/clients", `{"client_name":"Acme"}`, "Authorization", bearer), http.StatusForbidden, controllers.CodeForbidden)
+}
+
+func TestLoginRejectsInvalidCredentials(t *testing.T) {
+	api := newTestAPI(t)
+	addUser(t, api, models.User{Username: "alice", Roles: []string{auth.RoleViewer}}, "correct horse battery")
+	disabled := time.Now().Add(-time.Minute)
+	addUser(t, api, models.User{Username: "carol", Roles: []string{auth.RoleViewer}, DisabledOn: &disabled}, "correct horse battery")
+
+	for _, body := range []string{
+		`{"username":"alice","password":"wrong horse battery"}`,
+		`{"username":"mallory","password":"correct horse battery"}`,
+		`{"username":"carol","password":"correct horse battery"}`,
+	} {
+		w := api.request(http.MethodPost, "/api/login", body)
+		expectProblem(t, w, http.StatusUnauthorized, controllers.CodeUnauthorized)
+	}
+
+	expectProblem(t, api.request(http.MethodPost, "/api/login", `{"username":"alice"}`), http.StatusBadRequest, controllers.CodeValidationFailed)
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Authorize is a middleware refusing requests to routes the roles of the caller don't grant with 403,
+// it runs after Authenticate
+func Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.IdentityFromContext(r.Context())
+
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route = current.GetName()
+		}
+
+		permission, ok := auth.RoutePermission(route)
+		if !ok {
+			// fail closed, a route missing from the policy is a bug
+			log.Error("Route is not covered by the access policy: ", route)
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden, "Access to "+r.Method+" "+r.URL.Path+" is not granted to any role")
+			return
+		}
+
+		if permission != "" && !identity.Can(permission) {
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden, "Permission "+string(permission)+" is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeFields checks that the caller may change every field of update that differs from current, the stored
+// document or the zero value of the model for new documents, and writes a 403 listing the denied fields otherwise.
+// It returns false when a response was written.
+func authorizeFields(w http.ResponseWriter, r *http.Request, resource string, current interface{}, update interface{}) bool {
+	denied, err := deniedFields(r, resource, current, update)
+	if err != nil {
+		writeInternalError(w, r, "Failed to check field permissions", err)
+		return false
+	}
+
+	if len(denied) == 0 {
+		return true
+	}
+
+	names := make([]string, len(denied))
+	for i, fieldError := range denied {
+		names[i] = fieldError.Field
+	}
+
+	renderProblem(w, r, Problem{
+		Status:  http.StatusForbidden,
+		Code:    CodeForbidden,
+		Message: "Not allowed to change " + strings.Join(names, ", "),
+		Errors:  denied,
+	})
+	return false
+}
+
+// deniedFields returns an error for every field of update the caller may not change, values equal to the ones in
+// current are allowed
+func deniedFields(r *http.Request, resource string, current interface{}, update interface{}) ([]FieldError, error) {
+	identity, _ := auth.IdentityFromContext(r.Context())
+
+	updateDocument, err := document(update)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(updateDocument))
+	for field := range updateDocument {
+		fields = append(fields, field)
+	}
+
+	denied := identity.DeniedFields(resource, fields)
+	if len(denied) == 0 {
+		return nil, nil
+	}
+
+	// values that are sent back unchanged, e.g. by a full update, are allowed
+	currentDocument, err := document(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []FieldError
+	for _, field := range denied {
+		if reflect.DeepEqual(updateDocument[field.Field], currentDocument[field.Field]) {
+			continue
+		}
+		errs = append(errs, FieldError{
+			Field:   field.Field,
+			Rule:    string(field.Permission),
+			Message: "changing " + field.Field + " requires the " + string(field.Permission) + " permission",
+		})
+	}
+	return errs, nil
+}
+
+// document returns the bson document of v, the fields are the ones $set would write
+func document(v interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	document := bson.M{}
+	err = bson.Unmarshal(raw, &document)
+	return document, err
+}
@@ -0,0 +1,60 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+func TestEveryRouteIsCoveredByThePolicy(t *testing.T) {
+	r := mux.NewRouter()
+	controllers.NewHandler(repository.NewMemoryStore(), nil, controllers.NewStreams(), nil).RegisterRoutes(r)
+
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, _ := route.GetPathTemplate()
+		if _, ok := auth.RoutePermission(route.GetName()); !ok {
+			t.Errorf("route %q %s is missing from the access policy", route.GetName(), path)
+		}
+		return nil
+	})
+}
+
+func TestRoleAccess(t *testing.T) {
+	admin := newTestAPI(t)
+	viewer := admin.as(auth.RoleViewer)
+	editor := admin.as(auth.RoleEditor)
+	billing := admin.as(auth.RoleBillingAdmin)
+	nobody := admin.as("unknown")
+
+	clientID := admin.create("/api/clients", `{"client_name":"Acme"}`)
+
+	expectStatus(t, viewer.request(http.MethodGet, "/api/clients/"+clientID, ""), http.StatusOK)
+	expectProblem(t, viewer.request(http.MethodPost, "/api/clients", `{"client_name":"Globex"}`), http.StatusForbidden, controllers.CodeForbidden)
+	expectProblem(t, nobody.request(http.MethodGet, "/api/clients", ""), http.StatusForbidden, controllers.CodeForbidden)
+
+	editor.create("/api/clients", `{"client_name":"Globex"}`)
+	expectProblem(t, editor.request(http.MethodDelete, "/api/clients/"+clientID, ""), http.StatusForbidden, controllers.CodeForbidden)
+	expectProblem(t, editor.request(http.MethodGet, "/api/audit", ""), http.StatusForbidden, controllers.CodeForbidden)
+
+	// the billing fields require billing:write on top of services:write
+	w := editor.request(http.MethodPost, "/api/services", newService("Hosting", clientID))
+	expectProblem(t, w, http.StatusForbidden, controllers.CodeForbidden)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if len(problem.Errors) != 2 || problem.Errors[0].Field != "invoice_amount" || problem.Errors[1].Field != "invoice_frequency" {
+		t.Fatalf("unexpected denied fields %+v", problem.Errors)
+	}
+	editor.create("/api/services", `{"service_name":"Consulting","service_type":"x","service_owner":"o","service_status":"active","currency":"SEK"}`)
+	serviceID := billing.create("/api/services", newService("Hosting", clientID))
+
+	// unchanged billing fields don't need billing:write, changing the currency of a service does
+	expectStatus(t, editor.request(http.MethodPut, "/api/services/"+serviceID, newService("Managed hosting", clientID), "If-Match", `"1"`), http.StatusOK)
+	w = editor.request(http.MethodPatch, "/api/services/"+serviceID, `{"currency":"EUR"}`, "If-Match", `"2"`, "Content-Type", "application/merge-patch+json")
+	expectProblem(t, w, http.StatusForbidden, controllers.CodeForbidden)
+
+	expectStatus(t, admin.request(http.MethodDelete, "/api/clients/"+clientID+"?cascade=detach", ""), http.StatusNoContent)
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operations of a batch
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchPatch  = "patch"
+	BatchDelete = "delete"
+)
+
+// maxBatchBytes limits the size of a batch body
+const maxBatchBytes = 1 << 20
+
+// BatchRequest is the body of POST /api/batch, a batch has at most 100 operations as they all run in one
+// transaction
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,max=100,dive"`
+}
+
+// BatchOperation is a create, update (PUT), patch (PATCH) or delete of a client, service or contact. Body is the
+// document, or the JSON merge patch or JSON patch of a patch, and Version the version the document is expected to
+// be at, like If-Match on the single document endpoints. Cascade is the cascade policy of a deleted client.
+type BatchOperation struct {
+	Op      string          `json:"op" validate:"required,oneof=create update patch delete"`
+	Entity  string          `json:"entity" validate:"required,oneof=clients services contacts"`
+	ID      string          `json:"id,omitempty"`
+	Version *int64          `json:"version,omitempty"`
+	Cascade string          `json:"cascade,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResponse reports the operations of a batch. When an operation fails the batch stops, nothing is stored and
+// Failed is the index of the operation, the results of the operations before it show what they would have done.
+type BatchResponse struct {
+	Committed bool          `json:"committed"`
+	Failed    *int          `json:"failed,omitempty"`
+	Results   []BatchResult `json:"results"`
+}
+
+// BatchResult is the response the endpoint of an operation returned, Body is the document, the id of a created
+// document or the problem of a failed operation
+type BatchResult struct {
+	Index  int             `json:"index"`
+	Op     string          `json:"op"`
+	Entity string          `json:"entity"`
+	ID     string          `json:"id,omitempty"`
+	Status int             `json:"status"`
+	ETag   string          `json:"etag,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchRoute is the endpoint an operation of a batch runs on
+type batchRoute struct {
+	name    string
+	method  string
+	handler http.HandlerFunc
+}
+
+// batchRoute returns the endpoint of operation, the operation is expected to be validated
+func (h *Handler) batchRoute(operation BatchOperation) batchRoute {
+	switch operation.Entity + " " + operation.Op {
+	case "clients create":
+		return batchRoute{"AddClient", http.MethodPost, h.AddClient}
+	case "clients update":
+		return batchRoute{"UpdateClient", http.MethodPut, h.UpdateClient}
+	case "clients patch":
+		return batchRoute{"PatchClient", http.MethodPatch, h.PatchClient}
+	case "clients delete":
+		return batchRoute{"DeleteClient", http.MethodDelete, h.DeleteClient}
+	case "services create":
+		return batchRoute{"AddService", http.MethodPost, h.AddService}
+	case "services update":
+		return batchRoute{"UpdateService", http.MethodPut, h.UpdateService}
+	case "services patch":
+		return batchRoute{"PatchService", http.MethodPatch, h.PatchService}
+	case "services delete":
+		return batchRoute{"DeleteService", http.MethodDelete, h.DeleteService}
+	case "contacts create":
+		return batchRoute{"AddContact", http.MethodPost, h.AddContact}
+	case "contacts update":
+		return batchRoute{"UpdateContact", http.MethodPut, h.UpdateContact}
+	case "contacts patch":
+		return batchRoute{"PatchContact", http.MethodPatch, h.PatchContact}
+	default: // contacts delete
+		return batchRoute{"DeleteContact", http.MethodDelete, h.DeleteContact}
+	}
+}
+
+// checkBatchOperations returns the errors of the fields of operations that depend on the operation
+func checkBatchOperations(operations []BatchOperation) []FieldError {
+	var errs []FieldError
+	for i, operation := range operations {
+		field := "operations[" + strconv.Itoa(i) + "]."
+
+		if operation.Op == BatchCreate {
+			if operation.ID != "" {
+				errs = append(errs, FieldError{Field: field + "id", Rule: "excluded", Message: "id is assigned on create"})
+			}
+		} else if _, err := primitive.ObjectIDFromHex(operation.ID); err != nil {
+			errs = append(errs, FieldError{Field: field + "id", Rule: "objectid", Message: "id must be a valid object id"})
+		}
+
+		if operation.Op == BatchDelete {
+			if len(operation.Body) > 0 {
+				errs = append(errs, FieldError{Field: field + "body", Rule: "excluded", Message: "body is not allowed on delete"})
+			}
+		} else if len(operation.Body) == 0 {
+			errs = append(errs, FieldError{Field: field + "body", Rule: "required", Message: "body is required"})
+		}
+
+		if operation.Cascade != "" && (operation.Op != BatchDelete || operation.Entity != "clients") {
+			errs = append(errs, FieldError{Field: field + "cascade", Rule: "excluded", Message: "cascade only applies to deleted clients"})
+		}
+	}
+	return errs
+}
+
+// batchRecorder keeps the response of an operation of a batch
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *batchRecorder) Header() http.Header {
+	return b.header
+}
+
+func (b *batchRecorder) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *batchRecorder) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// errBatchFailed aborts the transaction of a batch when an operation fails
+var errBatchFailed = errors.New("batch operation failed")
+
+// runBatchOperation runs operation on its endpoint with ctx and returns what the endpoint responded. The operation
+// is a request of its own with the identity and request id of the batch, so it is validated, authorized and
+// audited like it would be on its endpoint.
+func (h *Handler) runBatchOperation(ctx context.Context, index int, operation BatchOperation) BatchResult {
+	route := h.batchRoute(operation)
+
+	path := "/api/" + operation.Entity
+	if operation.ID != "" {
+		path += "/" + operation.ID
+	}
+	target := url.URL{Path: path}
+	if operation.Cascade != "" {
+		target.RawQuery = url.Values{"cascade": {operation.Cascade}}.Encode()
+	}
+
+	request, _ := http.NewRequestWithContext(ctx, route.method, target.String(), bytes.NewReader(operation.Body))
+	request.Header.Set("Content-Type", "application/json")
+	if operation.Op == BatchPatch && bytes.HasPrefix(bytes.TrimSpace(operation.Body), []byte("[")) {
+		request.Header.Set("Content-Type", JSONPatchContentType)
+	}
+	if operation.Version != nil {
+		request.Header.Set("If-Match", etag(*operation.Version))
+	}
+	request = mux.SetURLVars(request, map[string]string{"id": operation.ID})
+
+	recorder := &batchRecorder{header: http.Header{}}
+	route.handler(recorder, request)
+
+	result := BatchResult{
+		Index:  index,
+		Op:     operation.Op,
+		Entity: operation.Entity,
+		ID:     operation.ID,
+		Status: recorder.status,
+		ETag:   recorder.header.Get("ETag"),
+	}
+	if recorder.status != http.StatusNoContent {
+		result.Body = bytes.TrimSpace(recorder.body.Bytes())
+	}
+
+	// the endpoints respond to a create with the id of the document
+	if operation.Op == BatchCreate && recorder.status == http.StatusCreated {
+		var id primitive.ObjectID
+		if json.Unmarshal(result.Body, &id) == nil {
+			result.ID = id.Hex()
+		}
+	}
+
+	return result
+}
+
+// Batch runs a list of creates, updates, patches and deletes of clients, services and contacts in one transaction.
+// The operations run in order and see the changes of the operations before them, the first one that fails stops the
+// batch and rolls every change back, including the audit entries. The response is 200 with the result of every
+// operation when the batch is committed, otherwise it has the status of the failed operation.
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	var batch BatchRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&batch); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if validationErr := validate.Struct(batch); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	if errs := checkBatchOperations(batch.Operations); len(errs) > 0 {
+		renderProblem(w, r, Problem{
+			Status:  http.StatusBadRequest,
+			Code:    CodeValidationFailed,
+			Message: "Body missing required fields or containing invalid values",
+			Errors:  errs,
+		})
+		return
+	}
+
+	// every operation requires the permission of its endpoint, they are checked before anything is changed
+	identity, _ := auth.IdentityFromContext(r.Context())
+	for i, operation := range batch.Operations {
+		permission, ok := auth.RoutePermission(h.batchRoute(operation).name)
+		if !ok || (permission != "" && !identity.Can(permission)) {
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden,
+				"Permission "+string(permission)+" is required for operation "+strconv.Itoa(i))
+			return
+		}
+	}
+
+	var response BatchResponse
+	err := h.store.Transactions.Run(r.Context(), func(ctx context.Context) error {
+		// the transaction is retried on transient errors
+		response = BatchResponse{Results: make([]BatchResult, 0, len(batch.Operations))}
+
+		for i, operation := range batch.Operations {
+			result := h.runBatchOperation(ctx, i, operation)
+			response.Results = append(response.Results, result)
+			if result.Status >= http.StatusBadRequest {
+				failed := i
+				response.Failed = &failed
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+
+	logger := log.WithField("request_id", util.RequestIDFromContext(r.Context()))
+	if errors.Is(err, errBatchFailed) {
+		failed := response.Results[*response.Failed]
+		logger.Warn("Batch rolled back, operation ", *response.Failed, " failed with status ", failed.Status)
+		w.WriteHeader(failed.Status)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to commit the batch", err)
+		return
+	}
+
+	logger.Info("Batch committed, ", len(response.Results), " operations")
+	response.Committed = true
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,114 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func batch(t *testing.T, api *testAPI, body string, status int) controllers.BatchResponse {
+	t.Helper()
+
+	w := api.request(http.MethodPost, "/api/batch", body)
+	expectStatus(t, w, status)
+	var response controllers.BatchResponse
+	decode(t, w, &response)
+	return response
+}
+
+func TestBatch(t *testing.T) {
+	api := newTestAPI(t)
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	response := batch(t, api, `{"operations":[
+		{"op":"create","entity":"clients","body":{"client_name":"Globex"}},
+		{"op":"patch","entity":"clients","id":"`+acme+`","version":1,"body":{"web_url":"https://acme.example"}},
+		{"op":"create","entity":"contacts","body":{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example","attached_to_client":[{"client_id":"`+acme+`"}]}}
+	]}`, http.StatusOK)
+	if !response.Committed || response.Failed != nil || len(response.Results) != 3 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	if created := response.Results[0]; created.Status != http.StatusCreated || created.ID == "" {
+		t.Fatalf("unexpected result %+v", created)
+	}
+	if patched := response.Results[1]; patched.Status != http.StatusOK || patched.ETag != `"2"` {
+		t.Fatalf("unexpected result %+v", patched)
+	}
+
+	w := api.request(http.MethodGet, "/api/clients/"+acme, "")
+	expectStatus(t, w, http.StatusOK)
+	var client models.ClientResponse
+	decode(t, w, &client)
+	if client.WebUrl != "https://acme.example" || len(client.ClientContacts) != 1 {
+		t.Fatalf("unexpected client %+v", client)
+	}
+
+	// every operation is audited like on its endpoint
+	if entries := auditLog(t, api, "entity=clients&id="+response.Results[0].ID); len(entries) != 1 || entries[0].Action != models.AuditCreate {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+}
+
+func TestBatchRollsBack(t *testing.T) {
+	api := newTestAPI(t)
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	// the update is at an old version, the create before it is rolled back
+	response := batch(t, api, `{"operations":[
+		{"op":"create","entity":"clients","body":{"client_name":"Globex"}},
+		{"op":"update","entity":"clients","id":"`+acme+`","version":7,"body":{"client_name":"Acme Inc"}},
+		{"op":"delete","entity":"clients","id":"`+acme+`","version":1}
+	]}`, http.StatusPreconditionFailed)
+	if response.Committed || response.Failed == nil || *response.Failed != 1 || len(response.Results) != 2 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	if created := response.Results[0]; created.Status != http.StatusCreated {
+		t.Fatalf("unexpected result %+v", created)
+	}
+
+	w := api.request(http.MethodGet, "/api/clients", "")
+	expectStatus(t, w, http.StatusOK)
+	if count := w.Header().Get("X-Total-Count"); count != "1" {
+		t.Fatalf("X-Total-Count = %s, want 1", count)
+	}
+	if entries := auditLog(t, api, "entity=clients&action=create"); len(entries) != 1 {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+
+	// an operation sees the changes of the operations before it
+	response = batch(t, api, `{"operations":[
+		{"op":"delete","entity":"clients","id":"`+acme+`","version":1},
+		{"op":"patch","entity":"clients","id":"`+acme+`","body":{"web_url":"https://acme.example"}}
+	]}`, http.StatusNotFound)
+	if *response.Failed != 1 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	expectStatus(t, api.request(http.MethodGet, "/api/clients/"+acme, ""), http.StatusOK)
+}
+
+func TestBatchChecks(t *testing.T) {
+	api := newTestAPI(t)
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	expectProblem(t, api.request(http.MethodPost, "/api/batch", `{"operations":[]}`), http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectProblem(t, api.request(http.MethodPost, "/api/batch", `{"operations":[{"op":"upsert","entity":"clients"}]}`), http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectProblem(t, api.request(http.MethodPost, "/api/batch", `{"operations":[{"op":"create","entity":"clients","id":"`+acme+`","body":{}}]}`),
+		http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectProblem(t, api.request(http.MethodPost, "/api/batch", `{"operations":[{"op":"delete","entity":"services","id":"`+acme+`","cascade":"delete"}]}`),
+		http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectProblem(t, api.request(http.MethodPost, "/api/batch", `{"operations":[],"dry_run":true}`), http.StatusBadRequest, controllers.CodeInvalidRequest)
+
+	// the permissions of every operation are checked before any of them runs
+	editor := api.as(auth.RoleEditor)
+	w := editor.request(http.MethodPost, "/api/batch", `{"operations":[
+		{"op":"create","entity":"clients","body":{"client_name":"Globex"}},
+		{"op":"delete","entity":"clients","id":"`+acme+`"}
+	]}`)
+	expectProblem(t, w, http.StatusForbidden, controllers.CodeForbidden)
+	if entries := auditLog(t, api, "entity=clients&action=create"); len(entries) != 1 {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+}
@@ -0,0 +1,112 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDeleteClientWithDependents(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	service := api.create("/api/services", newService("Hosting", acme))
+	contact := api.create("/api/contacts", `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example","attached_to_client":[{"client_id":"`+acme+`"}]}`)
+
+	// the delete is restricted by default and lists what is in the way
+	w := api.request(http.MethodDelete, "/api/clients/"+acme, "")
+	expectProblem(t, w, http.StatusConflict, controllers.CodeHasDependents)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if len(problem.Dependents) != 2 || problem.Dependents[0].ID.Hex() != service || problem.Dependents[1].ID.Hex() != contact {
+		t.Fatalf("unexpected dependents %+v", problem.Dependents)
+	}
+	expectStatus(t, api.request(http.MethodGet, "/api/clients/"+acme, ""), http.StatusOK)
+
+	expectProblem(t, api.request(http.MethodDelete, "/api/clients/"+acme+"?cascade=bogus", ""), http.StatusBadRequest, controllers.CodeInvalidQuery)
+	expectStatus(t, api.as(auth.RoleEditor).request(http.MethodDelete, "/api/clients/"+acme+"?cascade=delete", ""), http.StatusForbidden)
+
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+acme+"?cascade=delete", ""), http.StatusNoContent)
+	expectProblem(t, api.request(http.MethodGet, "/api/services/"+service, ""), http.StatusNotFound, controllers.CodeNotFound)
+	expectProblem(t, api.request(http.MethodGet, "/api/contacts/"+contact, ""), http.StatusNotFound, controllers.CodeNotFound)
+
+	// a deleted dependent is audited with the document it was
+	entries := auditLog(t, api, "entity=services&id="+service+"&action=delete")
+	if len(entries) != 1 || !hasChange(entries[0].Changes, "service_name", "Hosting", nil) {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+}
+
+func TestDeleteClientDetachesSharedServices(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	globex := api.create("/api/clients", `{"client_name":"Globex"}`)
+	shared := api.create("/api/services", newService("Hosting", acme, globex))
+
+	// a service attached to other clients as well is only detached
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+acme+"?cascade=delete", ""), http.StatusNoContent)
+
+	w := api.request(http.MethodGet, "/api/services/"+shared, "")
+	expectStatus(t, w, http.StatusOK)
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf("ETag = %s, want \"2\"", etag)
+	}
+	var service models.ServiceResponse
+	decode(t, w, &service)
+	if len(service.Client) != 1 || service.Client[0].ID != globex {
+		t.Fatalf("unexpected clients %+v", service.Client)
+	}
+
+	// the detach is audited with the attached clients before and after
+	entries := auditLog(t, api, "entity=services&id="+shared+"&action=update")
+	if len(entries) != 1 || len(entries[0].Changes) != 1 || entries[0].Changes[0].Field != "attached_to_client" {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+	change := entries[0].Changes[0]
+	before, _ := change.Before.([]interface{})
+	after, _ := change.After.([]interface{})
+	if len(before) != 2 || len(after) != 1 {
+		t.Fatalf("unexpected change %+v", change)
+	}
+
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+globex+"?cascade=detach", ""), http.StatusNoContent)
+	w = api.request(http.MethodGet, "/api/services/"+shared, "")
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &service)
+	if len(service.Client) != 0 {
+		t.Fatalf("unexpected clients %+v", service.Client)
+	}
+}
+
+func TestDeleteClientAtAnotherVersion(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme"}`)
+	expectProblem(t, api.request(http.MethodDelete, "/api/clients/"+id, "", "If-Match", `"2"`), http.StatusPreconditionFailed, controllers.CodePreconditionFailed)
+
+	// a client changed between reading and deleting it is kept
+	clientID, _ := primitive.ObjectIDFromHex(id)
+	_, err := api.store.Clients.Delete(context.Background(), clientID, 2, "test", repository.CascadeRestrict)
+	if !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("err = %v, want %v", err, repository.ErrVersionConflict)
+	}
+	expectStatus(t, api.request(http.MethodGet, "/api/clients/"+id, ""), http.StatusOK)
+}
+
+// hasChange reports whether changes contain the field with the before and after values
+func hasChange(changes []models.FieldChange, field string, before interface{}, after interface{}) bool {
+	for _, change := range changes {
+		if change.Field == field {
+			return change.Before == before && change.After == after
+		}
+	}
+	return false
+}
@@ -1,135 +1,46 @@
 package controllers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 	"time"
 
-	"github.com/go-playground/validator"
-	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
-	"github.com/terrpan/clientdb/internal/util"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
 )
 
-type ClientBase struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ClientName   string             `json:"client_name" bson:"client_name" validate:"required"`
-	SlackChannel string             `json:"slack_channel,omitempty" bson:"slack_channel,omitempty"`
-	WebUrl       string             `json:"web_url,omitempty" bson:"web_url,omitempty"`
-	CreatedOn    time.Time          `json:"created_on,omitempty" bson:"created_on,omitempty"`
-	ModifiedOn   time.Time          `json:"modified_on,omitempty" bson:"modified_on,omitempty"`
-}
-
-type ClientResponse struct {
-	ID             primitive.ObjectID               `json:"id" bson:"_id,omitempty"`
-	ClientName     string                           `json:"client_name" bson:"client_name"`
-	SlackChannel   string                           `json:"slack_channel,omitempty" bson:"slack_channel,omitempty"`
-	WebUrl         string                           `json:"web_url,omitempty" bson:"web_url,omitempty"`
-	MangedServices []ClientsManagedServicesResponse `json:"managed_services" bson:"managed_services"`
-	ClientContacts []ClientsContactResponse         `json:"client_contacts" bson:"client_contacts"`
-	CreatedOn      time.Time                        `json:"created_on,omitempty" bson:"created_on,omitempty"`
-	ModifiedOn     time.Time                        `json:"modified_on,omitempty" bson:"modified_on,omitempty"`
-}
-
-type ClientsManagedServicesResponse struct {
-	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ServiceName      string             `json:"service_name" bson:"service_name" validate:"required"`
-	ServiceType      string             `json:"service_type" bson:"service_type" validate:"required"`
-	ServiceStatus    string             `json:"service_status" bson:"service_status" validate:"required"`
-	InvoiceFrequency string             `json:"invoice_frequency" bson:"invoice_frequency"`
-	InvoiceAmount    float64            `json:"invoice_amount" bson:"invoice_amount"`
-	ManagementFee    float64            `json:"management_fee" bson:"management_fee"`
-}
-
-type ClientsContactResponse struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	FirstName   string             `json:"first_name" bson:"first_name" validate:"required"`
-	LastName    string             `json:"last_name" bson:"last_name" validate:"required"`
-	FullName    string             `json:"full_name,omitempty" bson:"full_name,omitempty"`
-	Email       string             `json:"email" bson:"email" validate:"required,email"`
-	PhoneNumber string             `json:"phone_number,omitempty" bson:"phone_number"`
-	Role        string             `json:"role,omitempty" bson:"role"`
-}
-
 var (
-	validate                            = *validator.New()
-	clientsCollection *mongo.Collection = util.GetCollection(util.DB, "clients")
+	validate           = newValidator()
+	clientFilterFields = newFilterFields(models.ClientBase{})
 )
 
-// getClient returns all clients
-func GetClients(w http.ResponseWriter, r *http.Request) {
-	clients := []ClientResponse{}
-
-	// join manged_services from services collection using mongoDB's $lookup and $project to get the required fields
-	// https://docs.mongodb.com/manual/reference/operator/aggregation/lookup/
-	// https://docs.mongodb.com/manual/core/aggregation-pipeline/
-	pipeline := []bson.M{
-		{
-			"$lookup": bson.M{
-				"from":         "services",
-				"localField":   "_id",
-				"foreignField": "attached_to_client._id",
-				"as":           "managed_services",
-			},
-		},
-		{
-			"$lookup": bson.M{
-				"from":         "contacts",
-				"localField":   "_id",
-				"foreignField": "attached_to_client._id",
-				"as":           "client_contacts",
-			},
-		},
-		{
-			"$project": bson.M{
-				"_id":                               1,
-				"client_name":                       1,
-				"slack_channel":                     1,
-				"web_url":                           1,
-				"created_on":                        1,
-				"modified_on":                       1,
-				"managed_services._id":              1,
-				"managed_services.service_name":     1,
-				"managed_services.service_type":     1,
-				"managed_services.InvoiceFrequency": 1,
-				"managed_services.InvoiceAmount":    1,
-				"managed_services.ManagementFee":    1,
-				"client_contacts._id":               1,
-				"client_contacts.first_name":        1,
-				"client_contacts.last_name":         1,
-				"client_contacts.full_name":         1,
-				"client_contacts.email":             1,
-				"client_contacts.phone_number":      1,
-				"client_contacts.role":              1,
-			},
-		},
-	}
-
-	// execute the pipeline
-	cursor, err := clientsCollection.Aggregate(context.TODO(), pipeline)
+// getClient returns a page of clients
+func (h *Handler) GetClients(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, clientFilterFields)
 	if err != nil {
-		response := "Failed to find clients: "
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
 		return
 	}
 
-	// iterate through the cursor and add each client to the clients slice
-	for cursor.Next(context.TODO()) {
-		var client ClientResponse
-		// decode the document into the client struct
-		cursor.Decode(&client)
-		clients = append(clients, client)
+	// filters are matched before the lookup so only the base documents are filtered
+	opts.Filters, err = parseFilters(r.URL.Query(), clientFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	// get the page of clients with their managed services and contacts
+	clients, total, err := h.store.Clients.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to find clients", err)
+		return
 	}
 
-	// count and return the number of services
-	w.Header().Add("X-Total-Count", (strconv.Itoa(len(clients))))
+	// return the total number of clients and the range of this page
+	setRangeHeaders(w, "clients", opts.Start, len(clients), total)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(clients)
@@ -137,79 +48,26 @@ func GetClients(w http.ResponseWriter, r *http.Request) {
 }
 
 // getClientbyId returns a client by id
-func GetClientbyId(w http.ResponseWriter, r *http.Request) {
-	var client ClientResponse
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
-
-	// aggregate the client and the services and contacts using _id, and use $project to get the required fields
-	pipeline := []bson.M{
-		{
-			"$match": bson.M{"_id": id},
-		},
-		{
-			"$lookup": bson.M{
-				"from":         "services",
-				"localField":   "_id",
-				"foreignField": "attached_to_client._id",
-				"as":           "managed_services",
-			},
-		},
-		{
-			"$lookup": bson.M{
-				"from":         "contacts",
-				"localField":   "_id",
-				"foreignField": "attached_to_client._id",
-				"as":           "client_contacts",
-			},
-		},
-		{
-			"$project": bson.M{
-				"_id":                               1,
-				"client_name":                       1,
-				"slack_channel":                     1,
-				"web_url":                           1,
-				"created_on":                        1,
-				"modified_on":                       1,
-				"managed_services._id":              1,
-				"managed_services.service_name":     1,
-				"managed_services.service_type":     1,
-				"managed_services.InvoiceFrequency": 1,
-				"managed_services.InvoiceAmount":    1,
-				"managed_services.ManagementFee":    1,
-				"client_contacts._id":               1,
-				"client_contacts.first_name":        1,
-				"client_contacts.last_name":         1,
-				"client_contacts.full_name":         1,
-				"client_contacts.email":             1,
-				"client_contacts.phone_number":      1,
-				"client_contacts.role":              1,
-			},
-		},
-	}
-
-	// execute the pipeline
-	cursor, err := clientsCollection.Aggregate(context.TODO(), pipeline)
-	if err != nil {
-		response := "Bad request"
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+func (h *Handler) GetClientbyId(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "client")
+	if !ok {
 		return
 	}
 
-	// count length of the cursor and return 404 if no client is found
-	if !cursor.Next(context.TODO()) {
-		response := "No client found with id: " + id.Hex()
-		log.Error(response)
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(response)
+	// get the client with its managed services and contacts
+	client, err := h.store.Clients.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No client found with id: "+id.Hex())
 		return
 	}
 
-	// Decode the document into the client struct
-	err = cursor.Decode(&client)
 	if err != nil {
-		log.Error("failed to decode cursor", err.Error())
+		writeInternalError(w, r, "Failed to get client", err)
+		return
+	}
+
+	// answer with 304 when the caller already has this version
+	if notModified(w, r, client.Version) {
 		return
 	}
 
@@ -218,158 +76,304 @@ func GetClientbyId(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// updateClient updates a client
-func UpdateClient(w http.ResponseWriter, r *http.Request) {
-	var client ClientBase
-	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
-	if err != nil {
-		log.Error("Error converting id: ", err)
-		w.WriteHeader(http.StatusBadRequest)
+// updateClient replaces a client (PUT)
+func (h *Handler) UpdateClient(w http.ResponseWriter, r *http.Request) {
+	var client models.ClientBase
+	id, ok := pathID(w, r, "id", "client")
+	if !ok {
 		return
 	}
 
 	// validate the incoming json data
 	if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
-		response := "Invalid request payload"
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
 		return
 	}
 
 	// validate the body to ensure all required fields are present
 	if validationErr := validate.Struct(client); validationErr != nil {
-		response := "Body missing required fields: " + validationErr.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// load the stored document for the field permissions and the audit log
+	current, err := h.store.Clients.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Client does not exist, id: "+id.Hex())
 		return
 	}
 
-	// verify that id exists in the collection
-	count, err := clientsCollection.CountDocuments(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		response := "Failed to check if client id exists"
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to get client", err)
 		return
 	}
 
-	if count == 0 {
-		response := "No client not found with id: " + id.Hex()
-		log.Error(response)
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(response)
+	// the caller has to prove it saw the current version, a concurrent change fails with 412
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	// only the roles granted by the access policy may change protected fields
+	if !authorizeFields(w, r, "clients", current, client) {
 		return
 	}
 
 	client.ModifiedOn = time.Now()
 
-	// Update the client in the collection
-	result, err := clientsCollection.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": client})
-	if err != nil {
-		response := "Failed to update client"
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+	// PUT replaces the whole document, only the creation time is kept
+	client.CreatedOn = current.CreatedOn
+
+	// replace the client and retrieve the new document
+	updatedClient, err := h.store.Clients.Replace(r.Context(), id, current.Version, client)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
 		return
 	}
 
-	log.Info("Client updated, id: ", id.Hex())
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No client not found with id: "+id.Hex())
+		return
+	}
 
-	// retrieve the updated client
-	var updatedClient ClientBase
-	if result.MatchedCount == 1 {
-		err := clientsCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&updatedClient)
-		if err != nil {
-			response := "Failed to retrieve updated client"
-			log.Error(response, err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(response)
-			return
-		}
+	if err != nil {
+		writeInternalError(w, r, "Failed to update client", err)
+		return
 	}
 
+	log.Info("Client updated, id: ", id.Hex())
+	h.recordAudit(r, models.AuditUpdate, "clients", id, current, updatedClient)
+
+	w.Header().Set("ETag", etag(updatedClient.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updatedClient)
 }
 
-// deleteClient deletes a client
-func DeleteClient(w http.ResponseWriter, r *http.Request) {
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+// PatchClient applies a JSON merge patch or JSON patch to a client and only updates the fields it changes
+func (h *Handler) PatchClient(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	current, err := h.store.Clients.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Client does not exist, id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get client", err)
+		return
+	}
+
+	// the caller has to prove it saw the current version, a concurrent change fails with 412
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	var client models.ClientBase
+	if !applyPatch(w, r, current, &client) {
+		return
+	}
+
+	// the id, the timestamps and the version are maintained by the API and can't be patched
+	client.ID, client.CreatedOn, client.ModifiedOn, client.Version = current.ID, current.CreatedOn, current.ModifiedOn, current.Version
+
+	// the patched document has to be valid as a whole
+	if validationErr := validate.Struct(client); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// only the roles granted by the access policy may change protected fields
+	if !authorizeFields(w, r, "clients", current, client) {
+		return
+	}
+
+	changes, err := patchChanges(current, client)
+	if err != nil {
+		writeInternalError(w, r, "Failed to compute the changed fields", err)
+		return
+	}
+
+	// nothing to write, e.g. the patch sets the current values
+	if len(changes.Set) == 0 && len(changes.Unset) == 0 {
+		w.Header().Set("ETag", etag(current.Version))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+	changes.Set["modified_on"] = time.Now()
+
+	patched, err := h.store.Clients.Patch(r.Context(), id, current.Version, changes)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Client does not exist, id: "+id.Hex())
+		return
+	}
 
-	// Check if client exists
-	count, err := clientsCollection.CountDocuments(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		log.Error("Error checking that client id exists:", err)
+		writeInternalError(w, r, "Failed to patch client: "+id.Hex(), err)
 		return
 	}
 
+	log.Info("Client patched, id: ", id.Hex())
+	h.recordAudit(r, models.AuditUpdate, "clients", id, current, patched)
+
+	w.Header().Set("ETag", etag(patched.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(patched)
+}
+
+// deleteClient deletes a client, ?cascade=restrict|detach|delete decides what happens to the services and contacts
+// attached to it, by default a client with dependents isn't deleted
+func (h *Handler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
 	idString := id.Hex()
-	if count == 0 {
-		response := "Client not found, id: " + idString
-		log.Warn(response)
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(response)
+
+	cascade := r.URL.Query().Get("cascade")
+	if cascade == "" {
+		cascade = repository.CascadeRestrict
+	}
+
+	permissions, ok := auth.CascadePermissions(cascade)
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid cascade policy: "+cascade+", must be restrict, detach or delete")
+		return
+	}
+
+	// the cascade changes the dependents, which needs the permissions to change them
+	identity, _ := auth.IdentityFromContext(r.Context())
+	for _, permission := range permissions {
+		if !identity.Can(permission) {
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden, "Permission "+string(permission)+" is required for cascade="+cascade)
+			return
+		}
+	}
+
+	// keep the stored document for the audit log
+	current, err := h.store.Clients.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Client not found, id: "+idString)
 		return
 	}
 
-	// Delete the client from the collection based on id
-	_, err = clientsCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		response := "Failed to delete client"
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to get client: "+idString, err)
+		return
+	}
+
+	// deleting is only conditional when the caller sends If-Match
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
 
+	// move the client to the trash, it can be restored until it is purged
+	dependents, err := h.store.Clients.Delete(r.Context(), id, current.Version, identity.Subject, cascade)
+	if errors.Is(err, repository.ErrHasDependents) {
+		renderProblem(w, r, Problem{
+			Status:     http.StatusConflict,
+			Code:       CodeHasDependents,
+			Message:    "Client has services or contacts attached, delete it with cascade=detach or cascade=delete",
+			Dependents: dependents,
+		})
+		return
+	}
+
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Client not found, id: "+idString)
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to delete client", err)
 		return
 	}
 
 	response := "Client deleted, id: " + idString
 	log.Info(response)
+	h.recordAudit(r, models.AuditDelete, "clients", id, current, nil)
+
+	// the dependents are changed in the same transaction, each change is audited on its own
+	for _, dependent := range dependents {
+		if dependent.Action == repository.CascadeDelete {
+			h.recordAudit(r, models.AuditDelete, dependent.Type, dependent.ID, dependent.Before, nil)
+			continue
+		}
+		h.recordAudit(r, models.AuditUpdate, dependent.Type, dependent.ID, dependent.Before, dependent.After)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode(response)
+}
 
+// RestoreClient takes a deleted client out of the trash
+func (h *Handler) RestoreClient(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	restored, err := h.store.Clients.Restore(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No deleted client found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to restore client: "+id.Hex(), err)
+		return
+	}
+
+	log.Info("Client restored, id: ", id.Hex())
+	h.recordAudit(r, models.AuditRestore, "clients", id, nil, restored)
+
+	w.Header().Set("ETag", etag(restored.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(restored)
 }
 
 // addClient adds a new client to the database
-func AddClient(w http.ResponseWriter, r *http.Request) {
-	var client ClientBase
+func (h *Handler) AddClient(w http.ResponseWriter, r *http.Request) {
+	var client models.ClientBase
 
 	// validate the request body
 	if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
-		response := "Invalid request payload"
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
 		return
 	}
 
 	// validate the body to ensure all required fields are present
 	if validationErr := validate.Struct(client); validationErr != nil {
-		response := "Body missing required fields: " + validationErr.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// only the roles granted by the access policy may set protected fields
+	if !authorizeFields(w, r, "clients", models.ClientBase{}, client) {
 		return
 	}
 
 	// Don't allow duplicate client names
-	count, err := clientsCollection.CountDocuments(context.TODO(), bson.M{"client_name": client.ClientName})
+	exists, err := h.store.Clients.NameExists(r.Context(), client.ClientName)
 	if err != nil {
-		response := "Failed to check if client exists"
-		log.Error(response, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to check if client exists", err)
 		return
 	}
 
-	if count > 0 {
-		response := "Client already exists"
-		log.Error(response, client.ClientName)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+	if exists {
+		writeProblem(w, r, http.StatusBadRequest, CodeAlreadyExists, "Client already exists")
 		return
 	}
 
@@ -378,19 +382,19 @@ func AddClient(w http.ResponseWriter, r *http.Request) {
 	client.ModifiedOn = time.Now()
 
 	// Insert the new client to collection
-	result, err := clientsCollection.InsertOne(context.TODO(), client)
+	id, err := h.store.Clients.Insert(r.Context(), client)
 	if err != nil {
-		response := "Failed to insert client"
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to insert client", err)
 		return
 	}
 
-	log.Info("Client added, id:", result.InsertedID.(primitive.ObjectID).Hex())
+	client.ID, client.Version = id, 1
+
+	log.Info("Client added, id:", id.Hex())
+	h.recordAudit(r, models.AuditCreate, "clients", id, nil, client)
 
 	// return the id of the new client and 201 status
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(result.InsertedID)
+	json.NewEncoder(w).Encode(id)
 
 }
@@ -0,0 +1,87 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func TestClientCRUD(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme","web_url":"https://acme.example"}`)
+
+	w := api.request(http.MethodGet, "/api/clients/"+id, "")
+	expectStatus(t, w, http.StatusOK)
+	var client models.ClientResponse
+	decode(t, w, &client)
+	if client.ID.Hex() != id || client.ClientName != "Acme" || client.WebUrl != "https://acme.example" || client.Version != 1 {
+		t.Fatalf("unexpected client %+v", client)
+	}
+
+	w = api.request(http.MethodPut, "/api/clients/"+id, `{"client_name":"Acme Inc"}`, "If-Match", w.Header().Get("ETag"))
+	expectStatus(t, w, http.StatusOK)
+
+	w = api.request(http.MethodGet, "/api/clients", "")
+	expectStatus(t, w, http.StatusOK)
+	var clients []models.ClientResponse
+	decode(t, w, &clients)
+	if len(clients) != 1 || clients[0].ClientName != "Acme Inc" || clients[0].Version != 2 {
+		t.Fatalf("unexpected clients %+v", clients)
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "1" {
+		t.Fatalf("X-Total-Count = %q, want 1", total)
+	}
+
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+id, ""), http.StatusNoContent)
+	expectProblem(t, api.request(http.MethodGet, "/api/clients/"+id, ""), http.StatusNotFound, controllers.CodeNotFound)
+}
+
+func TestAddClientValidation(t *testing.T) {
+	api := newTestAPI(t)
+
+	expectProblem(t, api.request(http.MethodPost, "/api/clients", `{"web_url":"https://acme.example"}`), http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectProblem(t, api.request(http.MethodPost, "/api/clients", `{"client_name":`), http.StatusBadRequest, controllers.CodeInvalidRequest)
+
+	api.create("/api/clients", `{"client_name":"Acme"}`)
+	expectProblem(t, api.request(http.MethodPost, "/api/clients", `{"client_name":"Acme"}`), http.StatusBadRequest, controllers.CodeAlreadyExists)
+}
+
+func TestClientRequiresAuthentication(t *testing.T) {
+	api := newTestAPI(t)
+	api.key = ""
+
+	expectProblem(t, api.request(http.MethodGet, "/api/clients", ""), http.StatusUnauthorized, controllers.CodeUnauthorized)
+}
+
+func TestInvalidID(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, path := range []string{"/api/clients/nope", "/api/services/nope", "/api/contacts/nope"} {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			w := api.request(method, path, `{}`, "If-Match", "*", "Content-Type", "application/merge-patch+json")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s %s: status = %d, want 400", method, path, w.Code)
+				continue
+			}
+			var problem controllers.Problem
+			decode(t, w, &problem)
+			if problem.Code != controllers.CodeInvalidID {
+				t.Errorf("%s %s: problem code = %q, want %q", method, path, problem.Code, controllers.CodeInvalidID)
+			}
+		}
+	}
+}
+
+func TestDeleteClientHasNoBody(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme"}`)
+	w := api.request(http.MethodDelete, "/api/clients/"+id, "")
+	expectStatus(t, w, http.StatusNoContent)
+	if w.Body.Len() != 0 {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
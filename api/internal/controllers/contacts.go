@@ -1,106 +1,45 @@
 package controllers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 	"time"
 
-	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
-	"github.com/terrpan/clientdb/internal/util"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
 )
 
-type ContactsBase struct {
-	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	FirstName        string             `json:"first_name" bson:"first_name" validate:"required"`
-	LastName         string             `json:"last_name" bson:"last_name" validate:"required"`
-	FullName         string             `json:"full_name,omitempty" bson:"full_name,omitempty"`
-	Email            string             `json:"email" bson:"email" validate:"required,email"`
-	AttachedToClient []Clients          `json:"attached_to_client,omitempty" bson:"attached_to_client"`
-	PhoneNumber      string             `json:"phone_number,omitempty" bson:"phone_number"`
-	Role             string             `json:"role,omitempty" bson:"role"`
-	CreatedOn        time.Time          `json:"created_on" bson:"created_on,omitempty"`
-	ModifiedOn       time.Time          `json:"modified_on" bson:"modified_on,omitempty"`
-}
-
-type ContactResponse struct {
-	ID          primitive.ObjectID      `json:"id" bson:"_id,omitempty"`
-	FirstName   string                  `json:"first_name" bson:"first_name"`
-	LastName    string                  `json:"last_name" bson:"last_name"`
-	FullName    string                  `json:"full_name,omitempty" bson:"full_name,omitempty"`
-	Email       string                  `json:"email" bson:"email"`
-	PhoneNumber string                  `json:"phone_number,omitempty" bson:"phone_number"`
-	Client      []ContactClientResponse `json:"client,omitempty" bson:"client"`
-	Role        string                  `json:"role,omitempty" bson:"role"`
-	CreatedOn   time.Time               `json:"created_on" bson:"created_on,omitempty"`
-	ModifiedOn  time.Time               `json:"modified_on" bson:"modified_on,omitempty"`
-}
-
-type ContactClientResponse struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ClientName string             `json:"client_name" bson:"client_name"`
-}
-
 var (
-	contactsCollection *mongo.Collection = util.GetCollection(util.DB, "contacts")
+	contactFilterFields = newFilterFields(models.ContactsBase{})
 )
 
-// getContacts returns all contacts
-func GetContacts(w http.ResponseWriter, r *http.Request) {
-	contacts := []ContactResponse{}
-
-	// join the contacts with the clients collection to get the client name and client id for each contact
-	// using $lookup and $project
-	pipeline := []bson.M{
-		{
-			"$lookup": bson.M{
-				"from":         "clients",
-				"localField":   "attached_to_client._id",
-				"foreignField": "_id",
-				"as":           "client",
-			},
-		},
-		{
-			"$project": bson.M{
-				"_id":                1,
-				"first_name":         1,
-				"last_name":          1,
-				"full_name":          1,
-				"email":              1,
-				"phone_number":       1,
-				"role":               1,
-				"created_on":         1,
-				"modified_on":        1,
-				"client._id":         1,
-				"client.client_name": 1,
-			},
-		},
-	}
-
-	// execute the pipeline
-	cursor, err := contactsCollection.Aggregate(context.TODO(), pipeline)
+// getContacts returns a page of contacts
+func (h *Handler) GetContacts(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, contactFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	// filters are matched before the lookup so only the base documents are filtered
+	opts.Filters, err = parseFilters(r.URL.Query(), contactFilterFields)
 	if err != nil {
-		response := "Failed to get contacts"
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(response))
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
 		return
 	}
 
-	// iterate through the cursor and decode each document into the contacts slice
-	for cursor.Next(context.TODO()) {
-		var contact ContactResponse
-		cursor.Decode(&contact)
-		contacts = append(contacts, contact)
+	// get the page of contacts with the client name and client id for each contact
+	contacts, total, err := h.store.Contacts.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get contacts", err)
+		return
 	}
 
-	// Count documents in slice and return x-total-count header
-	w.Header().Add("X-Total-Count", (strconv.Itoa(len(contacts))))
+	// return the total number of contacts and the range of this page
+	setRangeHeaders(w, "contacts", opts.Start, len(contacts), total)
 
 	// Return the contacts slice
 	w.WriteHeader(http.StatusOK)
@@ -109,66 +48,27 @@ func GetContacts(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetContactById returns a contact based on the id.
-func GetContactById(w http.ResponseWriter, r *http.Request) {
-	var contact ContactResponse
-
+func (h *Handler) GetContactById(w http.ResponseWriter, r *http.Request) {
 	// retrive the id from the request and convert to ObjectID
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
-
-	// aggregate the contacts collection with the clients collection to get the client name and client id for each contact
-	// using $lookup and $project
-	pipeline := []bson.M{
-		{
-			"$match": bson.M{"_id": id},
-		},
-		{
-			"$lookup": bson.M{
-				"from":         "clients",
-				"localField":   "attached_to_client._id",
-				"foreignField": "_id",
-				"as":           "client",
-			},
-		},
-		{
-			"$project": bson.M{
-				"_id":                1,
-				"first_name":         1,
-				"last_name":          1,
-				"full_name":          1,
-				"email":              1,
-				"phone_number":       1,
-				"role":               1,
-				"created_on":         1,
-				"modified_on":        1,
-				"client._id":         1,
-				"client.client_name": 1,
-			},
-		},
-	}
-
-	// execute the pipeline
-	cursor, err := contactsCollection.Aggregate(context.TODO(), pipeline)
-	if err != nil {
-		response := "Bad request"
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(response))
+	id, ok := pathID(w, r, "id", "contact")
+	if !ok {
 		return
 	}
 
-	// make sure cursor has a next document
-	if !cursor.Next(context.TODO()) {
-		response := "No contact found with id: " + id.Hex()
-		log.Error(response)
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(response))
+	// get the contact with the client name and client id
+	contact, err := h.store.Contacts.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No contact found with id: "+id.Hex())
 		return
 	}
 
-	// Decode the document into the contact struct
-	err = cursor.Decode(&contact)
 	if err != nil {
-		log.Error("failed to decode cursor", err.Error())
+		writeInternalError(w, r, "Failed to get contact", err)
+		return
+	}
+
+	// answer with 304 when the caller already has this version
+	if notModified(w, r, contact.Version) {
 		return
 	}
 
@@ -179,24 +79,30 @@ func GetContactById(w http.ResponseWriter, r *http.Request) {
 }
 
 // AddContact adds a new contact to the db
-func AddContact(w http.ResponseWriter, r *http.Request) {
-	var contact ContactsBase
+func (h *Handler) AddContact(w http.ResponseWriter, r *http.Request) {
+	var contact models.ContactsBase
 
 	//validate the request body
 	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
-		response := "Invalid request payload: "
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
 		return
 	}
 
 	// validate the body to ensure all required fields are present
 	if validationErr := validate.Struct(contact); validationErr != nil {
-		response := "Body missing required fields: " + validationErr.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// every attached client has to exist
+	attached, ok := h.checkClientReferences(w, r, contact.AttachedToClient, nil)
+	if !ok {
+		return
+	}
+	contact.AttachedToClient = attached
+
+	// only the roles granted by the access policy may set protected fields
+	if !authorizeFields(w, r, "contacts", models.ContactsBase{}, contact) {
 		return
 	}
 
@@ -208,128 +114,275 @@ func AddContact(w http.ResponseWriter, r *http.Request) {
 	contact.ModifiedOn = time.Now()
 
 	// insert the contact into the db
-	result, err := contactsCollection.InsertOne(context.TODO(), contact)
+	id, err := h.store.Contacts.Insert(r.Context(), contact)
 	if err != nil {
-		response := "Failed to insert contact: "
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to insert contact", err)
 		return
 	}
 
-	log.Info("Created contact: ", result.InsertedID.(primitive.ObjectID).Hex())
+	contact.ID, contact.Version = id, 1
+
+	log.Info("Created contact: ", id.Hex())
+	h.recordAudit(r, models.AuditCreate, "contacts", id, nil, contact)
 
 	// return the id of the new contact
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(result.InsertedID)
+	json.NewEncoder(w).Encode(id)
 
 }
 
-// UpdateContact updates an existing contact in the db
-func UpdateContact(w http.ResponseWriter, r *http.Request) {
-	var contact ContactsBase
+// UpdateContact replaces an existing contact in the db (PUT)
+func (h *Handler) UpdateContact(w http.ResponseWriter, r *http.Request) {
+	var contact models.ContactsBase
 
 	//retrive the id from the request and convert to ObjectID
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	id, ok := pathID(w, r, "id", "contact")
+	if !ok {
+		return
+	}
 
 	// validate the request body
 	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
-		response := "Invalid request payload: " + err.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
 		return
 	}
 
 	// validate the body to ensure all required fields are present
 	if validationErr := validate.Struct(contact); validationErr != nil {
-		response := "Body missing required fields: " + validationErr.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// load the stored document for the field permissions and the audit log
+	current, err := h.store.Contacts.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Contact does not exist, id: "+id.Hex())
 		return
 	}
 
-	// verify that the id exists in the collection
-	count, err := contactsCollection.CountDocuments(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		response := "Failed to check if contact id exists"
-		log.Error(response, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to get contact", err)
+		return
+	}
+
+	// the caller has to prove it saw the current version, a concurrent change fails with 412
+	if !checkIfMatch(w, r, current.Version, true) {
 		return
 	}
-	if count == 0 {
-		response := "Contact doest not exist, id: " + id.Hex()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+
+	// every newly attached client has to exist
+	attached, ok := h.checkClientReferences(w, r, contact.AttachedToClient, current.AttachedToClient)
+	if !ok {
+		return
+	}
+	contact.AttachedToClient = attached
+
+	// only the roles granted by the access policy may change protected fields
+	if !authorizeFields(w, r, "contacts", current, contact) {
 		return
 	}
 
 	// set the modified on field
 	contact.ModifiedOn = time.Now()
 
-	//update the contact in the colllection
-	result, err := contactsCollection.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": contact})
-	if err != nil {
-		response := "Failed to update contact: "
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+	// full_name is derived from the first and last name
+	contact.FullName = contact.FirstName + " " + contact.LastName
+
+	// PUT replaces the whole document, only the creation time is kept
+	contact.CreatedOn = current.CreatedOn
+
+	// replace the contact and retrieve the new document
+	updatedContact, err := h.store.Contacts.Replace(r.Context(), id, current.Version, contact)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
 		return
 	}
 
-	log.Info("Updated contact: ", id.Hex())
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Contact doest not exist, id: "+id.Hex())
+		return
+	}
 
-	var updatedContact ContactsBase
-	if result.MatchedCount == 1 {
-		err := contactsCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&updatedContact)
-		if err != nil {
-			response := "Failed to retrieve updated contact"
-			log.Error(response, err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(response)
-			return
-		}
+	if err != nil {
+		writeInternalError(w, r, "Failed to update contact", err)
+		return
 	}
 
+	log.Info("Updated contact: ", id.Hex())
+	h.recordAudit(r, models.AuditUpdate, "contacts", id, current, updatedContact)
+
 	// return the updated contact
+	w.Header().Set("ETag", etag(updatedContact.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updatedContact)
 
 }
 
+// PatchContact applies a JSON merge patch or JSON patch to a contact and only updates the fields it changes
+func (h *Handler) PatchContact(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "contact")
+	if !ok {
+		return
+	}
+
+	current, err := h.store.Contacts.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Contact does not exist, id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get contact", err)
+		return
+	}
+
+	// the caller has to prove it saw the current version, a concurrent change fails with 412
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	var contact models.ContactsBase
+	if !applyPatch(w, r, current, &contact) {
+		return
+	}
+
+	// the id, the timestamps and the version are maintained by the API and can't be patched
+	contact.ID, contact.CreatedOn, contact.ModifiedOn, contact.Version = current.ID, current.CreatedOn, current.ModifiedOn, current.Version
+
+	// full_name is derived from the first and last name
+	contact.FullName = contact.FirstName + " " + contact.LastName
+
+	// the patched document has to be valid as a whole
+	if validationErr := validate.Struct(contact); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// every newly attached client has to exist
+	attached, ok := h.checkClientReferences(w, r, contact.AttachedToClient, current.AttachedToClient)
+	if !ok {
+		return
+	}
+	contact.AttachedToClient = attached
+
+	// only the roles granted by the access policy may change protected fields
+	if !authorizeFields(w, r, "contacts", current, contact) {
+		return
+	}
+
+	changes, err := patchChanges(current, contact)
+	if err != nil {
+		writeInternalError(w, r, "Failed to compute the changed fields", err)
+		return
+	}
+
+	// nothing to write, e.g. the patch sets the current values
+	if len(changes.Set) == 0 && len(changes.Unset) == 0 {
+		w.Header().Set("ETag", etag(current.Version))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+	changes.Set["modified_on"] = time.Now()
+
+	patched, err := h.store.Contacts.Patch(r.Context(), id, current.Version, changes)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Contact does not exist, id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to patch contact: "+id.Hex(), err)
+		return
+	}
+
+	log.Info("Contact patched, id: ", id.Hex())
+	h.recordAudit(r, models.AuditUpdate, "contacts", id, current, patched)
+
+	w.Header().Set("ETag", etag(patched.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(patched)
+}
+
 // DeleteContact deletes a contact from the collection
-func DeleteContact(w http.ResponseWriter, r *http.Request) {
-	var contact ContactsBase
+func (h *Handler) DeleteContact(w http.ResponseWriter, r *http.Request) {
 	// retreive the id from the request and convert to ObjectID
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
-
-	// find the contact in the collection based on the id
-	err := contactsCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&contact)
+	id, ok := pathID(w, r, "id", "contact")
+	if !ok {
+		return
+	}
 	idString := id.Hex()
+
+	// keep the stored document for the audit log
+	current, err := h.store.Contacts.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Failed to find contact: "+idString)
+		return
+	}
+
 	if err != nil {
-		response := "Failed to find contact: " + idString
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to get contact: "+idString, err)
+		return
+	}
+
+	// deleting is only conditional when the caller sends If-Match
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
+
+	// move the contact to the trash, it can be restored until it is purged
+	identity, _ := auth.IdentityFromContext(r.Context())
+	err = h.store.Contacts.Delete(r.Context(), id, current.Version, identity.Subject)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Failed to find contact: "+idString)
 		return
 	}
 
-	// delete the contact from the collection
-	_, err = contactsCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		response := "Failed to delete contact: " + idString
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to delete contact: "+idString, err)
 		return
 	}
 
-	response := "Client deleted, id: " + idString
+	response := "Contact deleted, id: " + idString
 	log.Info(response)
+	h.recordAudit(r, models.AuditDelete, "contacts", id, current, nil)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 
-}
\ No newline at end of file
+}
+
+// RestoreContact takes a deleted contact out of the trash
+func (h *Handler) RestoreContact(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "contact")
+	if !ok {
+		return
+	}
+
+	restored, err := h.store.Contacts.Restore(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No deleted contact found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to restore contact: "+id.Hex(), err)
+		return
+	}
+
+	log.Info("Contact restored, id: ", id.Hex())
+	h.recordAudit(r, models.AuditRestore, "contacts", id, nil, restored)
+
+	w.Header().Set("ETag", etag(restored.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(restored)
+}
@@ -0,0 +1,50 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func TestContactCRUD(t *testing.T) {
+	api := newTestAPI(t)
+
+	clientID := api.create("/api/clients", `{"client_name":"Acme"}`)
+	id := api.create("/api/contacts", `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example","attached_to_client":[{"client_id":"`+clientID+`"}]}`)
+
+	w := api.request(http.MethodGet, "/api/contacts/"+id, "")
+	expectStatus(t, w, http.StatusOK)
+	var contact models.ContactResponse
+	decode(t, w, &contact)
+	if contact.FirstName != "Jane" || contact.Email != "jane@acme.example" {
+		t.Fatalf("unexpected contact %+v", contact)
+	}
+
+	w = api.request(http.MethodPut, "/api/contacts/"+id, `{"first_name":"Jane","last_name":"Roe","email":"jane@acme.example","role":"CTO"}`, "If-Match", w.Header().Get("ETag"))
+	expectStatus(t, w, http.StatusOK)
+
+	w = api.request(http.MethodGet, "/api/contacts?role=CTO", "")
+	expectStatus(t, w, http.StatusOK)
+	var contacts []models.ContactResponse
+	decode(t, w, &contacts)
+	if len(contacts) != 1 || contacts[0].LastName != "Roe" {
+		t.Fatalf("unexpected contacts %+v", contacts)
+	}
+
+	expectStatus(t, api.request(http.MethodDelete, "/api/contacts/"+id, ""), http.StatusOK)
+	expectProblem(t, api.request(http.MethodGet, "/api/contacts/"+id, ""), http.StatusNotFound, controllers.CodeNotFound)
+}
+
+func TestAddContactValidation(t *testing.T) {
+	api := newTestAPI(t)
+
+	w := api.request(http.MethodPost, "/api/contacts", `{"first_name":"Jane","last_name":"Doe","email":"not an email"}`)
+	expectProblem(t, w, http.StatusBadRequest, controllers.CodeValidationFailed)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "email" {
+		t.Fatalf("unexpected field errors %+v", problem.Errors)
+	}
+}
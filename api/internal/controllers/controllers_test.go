@@ -0,0 +1,141 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/app"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// testSigningKey signs the tokens issued at login and verifies bearer tokens
+var testSigningKey = []byte("0123456789abcdef0123456789abcdef")
+
+// testOrigin is the origin browsers may call the API from
+const testOrigin = "http://localhost:3000"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testAPI serves the API from an in-memory store, the requests are authenticated with an API key of the roles
+// it was created with
+type testAPI struct {
+	t       *testing.T
+	store   *repository.Store
+	streams *controllers.Streams
+	router  http.Handler
+	key     string
+}
+
+// newTestAPI returns an API on an empty in-memory store for callers with roles, admin by default
+func newTestAPI(t *testing.T, roles ...string) *testAPI {
+	t.Helper()
+
+	keys, err := auth.ParseKeySet([]byte(`{"keys":[{"kty":"oct","kid":"login","k":"` + base64.RawURLEncoding.EncodeToString(testSigningKey) + `"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.NewTokenIssuer(keys, "login", "", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := repository.NewMemoryStore()
+	streams := controllers.NewStreams()
+	router := app.NewRouter(store, auth.NewAuthenticator(store.APIKeys, keys, "", ""), tokens, streams, []string{testOrigin})
+
+	a := &testAPI{t: t, store: store, streams: streams, router: router}
+	return a.as(roles...)
+}
+
+// as returns a copy of the API for callers with roles on the same store, the api key is named after the roles
+func (a *testAPI) as(roles ...string) *testAPI {
+	a.t.Helper()
+
+	if len(roles) == 0 {
+		roles = []string{auth.RoleAdmin}
+	}
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	apiKey := models.APIKey{Name: strings.Join(roles, ","), KeyHash: auth.HashAPIKey(key), Roles: roles}
+	if _, err := a.store.APIKeys.Insert(context.Background(), apiKey); err != nil {
+		a.t.Fatal(err)
+	}
+
+	copy := *a
+	copy.key = key
+	return &copy
+}
+
+// request sends a request with a JSON body, headers are pairs of names and values
+func (a *testAPI) request(method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if a.key != "" {
+		r.Header.Set(auth.APIKeyHeader, a.key)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, r)
+	return w
+}
+
+// create posts document to path and returns the id of the created document
+func (a *testAPI) create(path string, document string) string {
+	a.t.Helper()
+
+	w := a.request(http.MethodPost, path, document)
+	expectStatus(a.t, w, http.StatusCreated)
+	var id string
+	decode(a.t, w, &id)
+	return id
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+}
+
+// expectProblem checks the status and the code of a problem response
+func expectProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	expectStatus(t, w, status)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if problem.Code != code {
+		t.Fatalf("problem code = %q, want %q: %s", problem.Code, code, w.Body.String())
+	}
+}
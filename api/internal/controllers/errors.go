@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator"
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/money"
+	"github.com/terrpan/clientdb/internal/util"
+)
+
+// Error codes returned in the code member of a Problem, clients can rely on them not changing
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidID            = "invalid_id"
+	CodeInvalidQuery         = "invalid_query"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnknownReference     = "unknown_reference"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeAlreadyExists        = "already_exists"
+	CodeConflict             = "conflict"
+	CodeHasDependents        = "has_dependents"
+	CodeInvalidTransition    = "invalid_transition"
+	CodeNothingToInvoice     = "nothing_to_invoice"
+	CodeMixedCurrencies      = "mixed_currencies"
+	CodeUnknownFrequency     = "unknown_frequency"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeInvalidPatch         = "invalid_patch"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInvalidResumeToken   = "invalid_resume_token"
+	CodeUnavailable          = "unavailable"
+	CodeInternal             = "internal_error"
+)
+
+// ProblemContentType is the media type of error responses
+// https://datatracker.ietf.org/doc/html/rfc7807
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 problem details body returned for every error
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Dependents are the documents preventing a delete
+	Dependents []models.Dependent `json:"dependents,omitempty"`
+}
+
+// FieldError describes why a single field failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// newValidator returns a validator reporting fields by their json name
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("currency", func(field validator.FieldLevel) bool {
+		return money.IsCurrency(field.Field().String())
+	})
+	v.RegisterValidation("event", func(field validator.FieldLevel) bool {
+		return validEventFilter(field.Field().String())
+	})
+	return v
+}
+
+// writeProblem renders a problem for a client error and logs it
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	renderProblem(w, r, Problem{Status: status, Code: code, Message: message})
+}
+
+// writeInternalError renders a 500 problem, err is logged but not exposed to the client
+func writeInternalError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	log.WithField("request_id", util.RequestIDFromContext(r.Context())).Error(message, ": ", err)
+	renderProblem(w, r, Problem{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message})
+}
+
+// writeValidationError renders a 400 problem listing every field that failed validation
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := Problem{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidationFailed,
+		Message: "Body missing required fields or containing invalid values",
+	}
+
+	problem.Errors = fieldErrors(err)
+	if len(problem.Errors) == 0 {
+		problem.Message = err.Error()
+	}
+
+	renderProblem(w, r, problem)
+}
+
+// fieldErrors returns an error for every field that failed validation, err is what validate.Struct returned
+func fieldErrors(err error) []FieldError {
+	var errs []FieldError
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		for _, fieldError := range validationErrors {
+			errs = append(errs, FieldError{
+				Field:   fieldPath(fieldError.Namespace()),
+				Rule:    fieldError.Tag(),
+				Message: fieldMessage(fieldError),
+			})
+		}
+	}
+	return errs
+}
+
+// fieldPath strips the struct name from a validator namespace, e.g. ClientBase.client_name becomes client_name
+func fieldPath(namespace string) string {
+	if dot := strings.Index(namespace, "."); dot >= 0 {
+		return namespace[dot+1:]
+	}
+	return namespace
+}
+
+func fieldMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return fieldError.Field() + " is required"
+	case "email":
+		return fieldError.Field() + " must be a valid email address"
+	case "oneof":
+		return fieldError.Field() + " must be one of: " + fieldError.Param()
+	case "currency":
+		return fieldError.Field() + " must be an ISO 4217 currency code, e.g. SEK"
+	case "event":
+		return fieldError.Field() + " must be an event type like service.updated, an entity like client.* or *"
+	case "url":
+		return fieldError.Field() + " must be an absolute URL"
+	}
+	return fieldError.Field() + " failed the " + fieldError.Tag() + " rule"
+}
+
+func renderProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problem.Type = "urn:clientdb:problem:" + problem.Code
+	problem.Title = http.StatusText(problem.Status)
+	problem.Instance = r.URL.Path
+	problem.RequestID = util.RequestIDFromContext(r.Context())
+
+	if problem.Status < http.StatusInternalServerError {
+		log.WithFields(log.Fields{"request_id": problem.RequestID, "code": problem.Code}).Warn(problem.Message)
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// NotFound renders a problem for requests that don't match any route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No route matches "+r.URL.Path)
+}
+
+// MethodNotAllowed renders a problem for requests using a method the route doesn't support
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
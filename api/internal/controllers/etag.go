@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns the entity tag of a document version. The tag covers the stored document,
+// fields joined from other collections (e.g. the client names of a service) don't change it.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// matchesETag reports whether the comma separated list of entity tags in header contains tag or is "*",
+// weak tags only match when weak is true
+func matchesETag(header string, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch requires an If-Match header matching the current version of a document before it is changed,
+// it writes 428 when the header is missing and required, 412 when it doesn't match, and returns false then
+// https://datatracker.ietf.org/doc/html/rfc7232#section-3.1
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int64, required bool) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if !required {
+			return true
+		}
+		writeProblem(w, r, http.StatusPreconditionRequired, CodePreconditionRequired,
+			"If-Match header with the ETag of the document is required")
+		return false
+	}
+
+	if !matchesETag(header, etag(version), false) {
+		w.Header().Set("ETag", etag(version))
+		writeVersionConflict(w, r)
+		return false
+	}
+
+	return true
+}
+
+// writeVersionConflict renders the 412 returned when a document was changed by someone else
+func writeVersionConflict(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusPreconditionFailed, CodePreconditionFailed,
+		"The document was changed since it was read, fetch it again and retry")
+}
+
+// notModified sets the ETag of the document and writes 304 when If-None-Match matches it,
+// it returns true when the response is complete
+// https://datatracker.ietf.org/doc/html/rfc7232#section-3.2
+func notModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	w.Header().Set("ETag", etag(version))
+
+	if header := r.Header.Get("If-None-Match"); header != "" && matchesETag(header, etag(version), true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
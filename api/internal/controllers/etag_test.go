@@ -0,0 +1,58 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+)
+
+func TestETags(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	w := api.request(http.MethodGet, "/api/clients/"+id, "")
+	expectStatus(t, w, http.StatusOK)
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+
+	expectStatus(t, api.request(http.MethodGet, "/api/clients/"+id, "", "If-None-Match", `"1"`), http.StatusNotModified)
+	expectStatus(t, api.request(http.MethodGet, "/api/clients/"+id, "", "If-None-Match", `"2"`), http.StatusOK)
+}
+
+func TestIfMatch(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	// updates must be conditional
+	expectProblem(t, api.request(http.MethodPut, "/api/clients/"+id, `{"client_name":"Acme Inc"}`), http.StatusPreconditionRequired, controllers.CodePreconditionRequired)
+
+	w := api.request(http.MethodPut, "/api/clients/"+id, `{"client_name":"Acme Inc"}`, "If-Match", `"1"`)
+	expectStatus(t, w, http.StatusOK)
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf("ETag = %q, want \"2\"", etag)
+	}
+
+	// a concurrent update based on the old version is refused
+	expectProblem(t, api.request(http.MethodPut, "/api/clients/"+id, `{"client_name":"Acme Ltd"}`, "If-Match", `"1"`), http.StatusPreconditionFailed, controllers.CodePreconditionFailed)
+	expectProblem(t, api.request(http.MethodPatch, "/api/clients/"+id, `{"web_url":"https://acme.example"}`, "If-Match", `"1"`, "Content-Type", controllers.MergePatchContentType), http.StatusPreconditionFailed, controllers.CodePreconditionFailed)
+	expectProblem(t, api.request(http.MethodDelete, "/api/clients/"+id, "", "If-Match", `"1"`), http.StatusPreconditionFailed, controllers.CodePreconditionFailed)
+
+	expectStatus(t, api.request(http.MethodPatch, "/api/clients/"+id, `{"web_url":"https://acme.example"}`, "If-Match", `*`, "Content-Type", controllers.MergePatchContentType), http.StatusOK)
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+id, "", "If-Match", `"3"`), http.StatusNoContent)
+}
+
+func TestIfMatchDetectsLostUpdates(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/contacts", `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example"}`)
+
+	// both callers read version 1, only the first write wins
+	first := api.request(http.MethodPut, "/api/contacts/"+id, `{"first_name":"Jane","last_name":"Roe","email":"jane@acme.example"}`, "If-Match", `"1"`)
+	expectStatus(t, first, http.StatusOK)
+	second := api.request(http.MethodPut, "/api/contacts/"+id, `{"first_name":"Janet","last_name":"Doe","email":"jane@acme.example"}`, "If-Match", `"1"`)
+	expectProblem(t, second, http.StatusPreconditionFailed, controllers.CodePreconditionFailed)
+}
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventStreamContentType is the media type of Server-Sent Events
+const EventStreamContentType = "text/event-stream"
+
+const (
+	// eventHeartbeat is how often an idle feed sends a heartbeat, so proxies keep the connection open and the
+	// clients notice when it is gone
+	eventHeartbeat = 15 * time.Second
+	// eventWriteTimeout is the time the client gets to read every event, the feed stays open as long as it does
+	eventWriteTimeout = 30 * time.Second
+	// eventRetry is the reconnection delay EventSource clients are asked to wait, in milliseconds
+	eventRetry = 3000
+	// eventReadLimit limits the messages clients send on the WebSocket feed, they are read and dropped
+	eventReadLimit = 64 << 10
+)
+
+// FeedEvent is a change of a client, service or contact sent on the event feed, ID is the token to resume the
+// feed after it. Data is the document after the change, it is null once the document is purged.
+type FeedEvent struct {
+	ID         string             `json:"id"`
+	Type       string             `json:"type"`
+	OccurredOn time.Time          `json:"occurred_on"`
+	Entity     string             `json:"entity"`
+	EntityID   primitive.ObjectID `json:"entity_id"`
+	Data       interface{}        `json:"data"`
+}
+
+func newFeedEvent(change models.Change) FeedEvent {
+	return FeedEvent{
+		ID:         change.Token,
+		Type:       eventEntities[change.Entity] + "." + change.Action,
+		OccurredOn: change.OccurredOn,
+		Entity:     change.Entity,
+		EntityID:   change.EntityID,
+		Data:       change.Data,
+	}
+}
+
+// watchChanges opens the change stream of the entities picked with ?type= that the caller may read, all of them by
+// default. The stream resumes after the token in the Last-Event-ID header, which EventSource sends when it
+// reconnects, or the last_event_id parameter. It writes a problem and returns false when the stream can't be
+// opened.
+func (h *Handler) watchChanges(w http.ResponseWriter, r *http.Request) (repository.ChangeStream, bool) {
+	query := r.URL.Query()
+	types := map[string]bool{}
+	for _, t := range query["type"] {
+		if _, ok := eventEntities[t]; !ok {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "type must be one of: clients, services, contacts")
+			return nil, false
+		}
+		types[t] = true
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	var entities []string
+	for _, entity := range []string{"clients", "services", "contacts"} {
+		if len(types) > 0 && !types[entity] {
+			continue
+		}
+		// only stream the resources the caller may read
+		if identity.Can(auth.ReadPermission(entity)) {
+			entities = append(entities, entity)
+		}
+	}
+	if len(entities) == 0 {
+		writeProblem(w, r, http.StatusForbidden, CodeForbidden, "Permission to read clients, services or contacts is required")
+		return nil, false
+	}
+
+	token := r.Header.Get("Last-Event-ID")
+	if token == "" {
+		token = query.Get("last_event_id")
+	}
+
+	stream, err := h.store.Changes.Watch(r.Context(), entities, token)
+	if errors.Is(err, repository.ErrInvalidToken) {
+		// the changes since the token are lost, the client has to reload what it shows and start over
+		writeProblem(w, r, http.StatusGone, CodeInvalidResumeToken, "The feed can't be resumed at "+token+", reconnect without last_event_id")
+		return nil, false
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to watch changes", err)
+		return nil, false
+	}
+
+	return stream, true
+}
+
+// openStream tracks a feed served for r until done is called, the feed runs with the returned context, which is
+// cancelled when the server shuts down. It writes a 503 and returns false when the server is already shutting down.
+func (h *Handler) openStream(w http.ResponseWriter, r *http.Request) (context.Context, func(), bool) {
+	ctx, done, ok := h.streams.open(r.Context())
+	if !ok {
+		writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "The server is shutting down, reconnect later")
+	}
+	return ctx, done, ok
+}
+
+// checkOrigin reports whether a browser may open the WebSocket feed from the origin of r. WebSockets aren't
+// covered by cors, so the origins allowed by the cors configuration are checked here, no configured origin allows
+// every origin like it does for cors. Clients other than browsers don't send an origin.
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(h.allowedOrigins) == 0 {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, allowed := range h.allowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// a wildcard matches a part of the origin, e.g. https://*.example.com
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok && len(origin) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextChanges waits for the next change of stream and calls send with it, heartbeat is called when no change came
+// for eventHeartbeat. It returns once ctx is cancelled, send or heartbeat fail or the stream fails.
+func nextChanges(ctx context.Context, stream repository.ChangeStream, send func(models.Change) error, heartbeat func() error) error {
+	last := time.Now()
+	for {
+		if stream.TryNext(ctx) {
+			if err := send(stream.Change()); err != nil {
+				return err
+			}
+			last = time.Now()
+			continue
+		}
+
+		if err := stream.Err(); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(last) >= eventHeartbeat {
+			if err := heartbeat(); err != nil {
+				return err
+			}
+			last = time.Now()
+		}
+	}
+}
+
+// GetEvents streams the changes of clients, services and contacts as Server-Sent Events as they are committed, e.g.
+// /api/events?type=clients&type=services. Every event has the resume token as id and its type as event name, e.g.
+// service.updated, and the heartbeats carry the token of the latest position, so a client reconnecting with
+// Last-Event-ID misses nothing. A 410 means the feed can't be resumed at the token anymore. The feed ends when the
+// server shuts down, the client reconnects like after any other disconnect.
+func (h *Handler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	ctx, done, ok := h.openStream(w, r)
+	if !ok {
+		return
+	}
+	defer done()
+
+	stream, ok := h.watchChanges(w, r)
+	if !ok {
+		return
+	}
+	defer stream.Close(context.Background())
+
+	logger := log.WithField("request_id", util.RequestIDFromContext(r.Context()))
+
+	controller, err := startStream(w, logger, eventWriteTimeout)
+	if err != nil {
+		writeInternalError(w, r, "Failed to start the event feed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses unless told otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	flush := func() error {
+		return flushStream(controller, eventWriteTimeout)
+	}
+
+	// a message with an id and no data moves the position of the client without dispatching an event
+	position := func() error {
+		if _, err := fmt.Fprintf(w, ": heartbeat\nid: %s\n\n", stream.Token()); err != nil {
+			return err
+		}
+		return flush()
+	}
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n", eventRetry); err != nil {
+		return
+	}
+	if err := position(); err != nil {
+		logger.Error("Failed to start the event feed: ", err)
+		return
+	}
+
+	send := func(change models.Change) error {
+		event := newFeedEvent(change)
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		return flush()
+	}
+
+	err = nextChanges(ctx, stream, send, position)
+	switch {
+	case errors.Is(err, repository.ErrInvalidToken):
+		// the client reconnects at its last event and is told to start over
+		logger.Warn("Event feed fell behind the change history")
+	case err != nil && ctx.Err() == nil:
+		logger.Error("Event feed stopped: ", err)
+	}
+}
+
+// GetEventsWebSocket streams the same events as GetEvents over a WebSocket, one JSON message per event. Clients
+// resume with the id of the last event they got in the last_event_id parameter. Browsers may only connect from
+// the allowed origins of the cors configuration. The feed is closed with 1001 (going away) when the server shuts
+// down or the feed can't keep up with the changes.
+func (h *Handler) GetEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeProblem(w, r, http.StatusUpgradeRequired, CodeInvalidRequest, "The event feed requires a WebSocket handshake")
+		return
+	}
+
+	ctx, done, ok := h.openStream(w, r)
+	if !ok {
+		return
+	}
+	defer done()
+
+	stream, ok := h.watchChanges(w, r)
+	if !ok {
+		return
+	}
+	defer stream.Close(context.Background())
+
+	logger := log.WithField("request_id", util.RequestIDFromContext(r.Context()))
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: h.checkOrigin,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			code := CodeInvalidRequest
+			if status == http.StatusForbidden {
+				code = CodeForbidden
+			}
+			writeProblem(w, r, status, code, "Invalid WebSocket handshake: "+reason.Error())
+		},
+	}
+
+	// the failed handshakes are answered by the upgrader
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// the messages of the client are read and dropped, which answers its pings and closes. The feed stops when the
+	// client closes the connection or goes away.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn.SetReadLimit(eventReadLimit)
+	conn.SetCloseHandler(func(code int, text string) error {
+		// the close is answered with a normal closure, the code of the client isn't echoed as it may not be sent,
+		// e.g. 1005 for a close without code
+		message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(eventWriteTimeout))
+		return nil
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(change models.Change) error {
+		message, err := json.Marshal(newFeedEvent(change))
+		if err != nil {
+			return err
+		}
+		if err := conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil {
+			return err
+		}
+		return conn.WriteMessage(websocket.TextMessage, message)
+	}
+
+	ping := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout))
+	}
+
+	err = nextChanges(ctx, stream, send, ping)
+	code, reason := websocket.CloseNormalClosure, ""
+	switch {
+	case errors.Is(err, repository.ErrInvalidToken):
+		code, reason = websocket.CloseGoingAway, "feed fell behind, reconnect without last_event_id"
+	case err != nil && ctx.Err() == nil:
+		logger.Error("Event feed stopped: ", err)
+		code = websocket.CloseInternalServerErr
+	case errors.Is(context.Cause(ctx), errStreamsClosed):
+		code, reason = websocket.CloseGoingAway, errStreamsClosed.Error()
+	}
+
+	// a client that closed the connection has been answered already
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(eventWriteTimeout)); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		logger.Debug("Failed to close the event feed: ", err)
+	}
+}
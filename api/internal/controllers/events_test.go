@@ -0,0 +1,191 @@
+package controllers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+)
+
+// serve serves the API on a local listener, the event feeds need a real connection
+func (a *testAPI) serve() *httptest.Server {
+	a.t.Helper()
+
+	server := httptest.NewServer(a.router)
+	a.t.Cleanup(server.Close)
+	return server
+}
+
+// readEvent reads the lines of the next server-sent event, comments included
+func readEvent(t *testing.T, reader *bufio.Reader) []string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("feed ended after %q: %v", lines, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(lines) > 0 {
+			return lines
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestGetEvents(t *testing.T) {
+	api := newTestAPI(t)
+	server := api.serve()
+
+	r, err := http.NewRequest(http.MethodGet, server.URL+"/api/events?type=clients", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set(auth.APIKeyHeader, api.key)
+	response, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != controllers.EventStreamContentType {
+		t.Fatalf("unexpected response %d %v", response.StatusCode, response.Header)
+	}
+
+	reader := bufio.NewReader(response.Body)
+	if lines := readEvent(t, reader); len(lines) != 3 || lines[0] != "retry: 3000" || lines[1] != ": heartbeat" {
+		t.Fatalf("unexpected start of the feed %q", lines)
+	}
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	api.create("/api/services", newService("Hosting"))
+	lines := readEvent(t, reader)
+	if len(lines) != 3 || lines[1] != "event: client.created" {
+		t.Fatalf("unexpected event %q", lines)
+	}
+	var event controllers.FeedEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.EntityID.Hex() != acme || "id: "+event.ID != lines[0] {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// the feed ends when the server shuts down and new feeds are refused
+	api.streams.Close()
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Fatal("the feed is still open after the shutdown")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := api.streams.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectProblem(t, api.request(http.MethodGet, "/api/events", ""), http.StatusServiceUnavailable, controllers.CodeUnavailable)
+}
+
+// dial opens the WebSocket feed from origin
+func dial(t *testing.T, api *testAPI, server *httptest.Server, origin string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	header := http.Header{}
+	header.Set(auth.APIKeyHeader, api.key)
+	header.Set("Origin", origin)
+	conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/events/ws", header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, response, err
+}
+
+// expectClose reads until the server closes conn and checks the close code
+func expectClose(t *testing.T, conn *websocket.Conn, code int) *websocket.CloseError {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != code {
+			t.Fatalf("err = %v, want a close with %d", err, code)
+		}
+		return closeErr
+	}
+}
+
+func TestGetEventsWebSocket(t *testing.T) {
+	api := newTestAPI(t)
+	server := api.serve()
+
+	// browsers may only connect from the origins allowed by cors
+	_, response, err := dial(t, api, server, "http://evil.example")
+	if err == nil || response == nil || response.StatusCode != http.StatusForbidden {
+		t.Fatalf("handshake from another origin: %v", err)
+	}
+
+	conn, _, err := dial(t, api, server, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	var event controllers.FeedEvent
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != "client.created" || event.EntityID.Hex() != acme || event.ID == "" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// the close of the client is answered with a normal closure, whatever its code
+	message := websocket.FormatCloseMessage(4000, "bye")
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, conn, websocket.CloseNormalClosure)
+
+	expectProblem(t, api.request(http.MethodGet, "/api/events/ws", ""), http.StatusUpgradeRequired, controllers.CodeInvalidRequest)
+}
+
+func TestGetEventsWebSocketAtShutdown(t *testing.T) {
+	api := newTestAPI(t)
+	server := api.serve()
+
+	conn, _, err := dial(t, api, server, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an event shows the feed is running
+	api.create("/api/clients", `{"client_name":"Acme"}`)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	api.streams.Close()
+	if closeErr := expectClose(t, conn, websocket.CloseGoingAway); closeErr.Text != "server is shutting down" {
+		t.Fatalf("unexpected close %v", closeErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := api.streams.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
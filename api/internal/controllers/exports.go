@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/export"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+)
+
+// Export formats, selected with ?format=, csv is the default
+const (
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// XLSXContentType is the media type of exports rendered as spreadsheets
+const XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+const (
+	// exportFlushRows is the number of documents after which the rows written so far are sent to the client
+	exportFlushRows = 100
+	// exportWriteTimeout is the time the client gets to read every flushed batch of an export, exports may take
+	// longer than the write timeout of the server as long as they make progress
+	exportWriteTimeout = 30 * time.Second
+)
+
+var (
+	exportContentTypes = map[string]string{
+		FormatCSV:    CSVContentType + "; charset=utf-8",
+		FormatNDJSON: NDJSONContentType,
+		FormatXLSX:   XLSXContentType,
+	}
+
+	// exportParams configure an export, the other parameters filter the documents like on the list endpoints
+	exportParams = []string{"format", "flatten", "unwind", "separator", "fields"}
+)
+
+// exportRequest holds the parameters of an export
+type exportRequest struct {
+	format    string
+	opts      repository.ListOptions
+	flattener export.Flattener
+}
+
+// parseExport reads the parameters of an export of documents like model, sorted and filtered on fields. It writes
+// a 400 and returns false when a parameter is invalid.
+func parseExport(w http.ResponseWriter, r *http.Request, model interface{}, fields filterFields) (exportRequest, bool) {
+	query := r.URL.Query()
+	request := exportRequest{format: query.Get("format")}
+	if request.format == "" {
+		request.format = FormatCSV
+	}
+
+	if _, ok := exportContentTypes[request.format]; !ok {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "format must be one of: csv, ndjson, xlsx")
+		return request, false
+	}
+
+	columns := export.Columns(model)
+	if names := query.Get("fields"); names != "" {
+		var err error
+		if columns, err = export.SelectColumns(columns, strings.Split(names, ",")); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid fields: "+err.Error())
+			return request, false
+		}
+	}
+
+	request.flattener = export.Flattener{Columns: columns, Mode: query.Get("flatten"), Unwind: query.Get("unwind"), Separator: export.DefaultSeparator}
+	if separator, ok := query["separator"]; ok {
+		request.flattener.Separator = separator[0]
+	}
+
+	switch request.flattener.Mode {
+	case "":
+		request.flattener.Mode = export.Join
+	case export.Join:
+	case export.Rows:
+		// the array is optional when the documents have a single one
+		arrays := exportArrays(export.Columns(model))
+		if request.flattener.Unwind == "" && len(arrays) == 1 {
+			request.flattener.Unwind = arrays[0]
+		}
+		if !contains(arrays, request.flattener.Unwind) {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "flatten=rows requires unwind, one of: "+strings.Join(arrays, ", "))
+			return request, false
+		}
+	default:
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "flatten must be either join or rows")
+		return request, false
+	}
+
+	var err error
+	request.opts, err = parseListParams(r, fields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return request, false
+	}
+
+	// an export contains every matching document
+	request.opts.Start, request.opts.End = 0, 0
+
+	for _, param := range exportParams {
+		query.Del(param)
+	}
+	request.opts.Filters, err = parseFilters(query, fields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return request, false
+	}
+
+	return request, true
+}
+
+// exportArrays returns the names of the arrays among columns
+func exportArrays(columns []export.Column) []string {
+	var arrays []string
+	for _, column := range columns {
+		if column.Array != "" && !contains(arrays, column.Array) {
+			arrays = append(arrays, column.Array)
+		}
+	}
+	return arrays
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// streamExport writes the documents of cursor to the response as they are read, next returns a pointer to decode
+// the next document into. The status is sent with the first rows, later errors can only be logged and leave the
+// export truncated.
+func streamExport(w http.ResponseWriter, r *http.Request, entity string, request exportRequest, cursor repository.Cursor, next func() interface{}) {
+	logger := log.WithField("request_id", util.RequestIDFromContext(r.Context()))
+	defer cursor.Close(r.Context())
+
+	controller, err := startStream(w, logger, exportWriteTimeout)
+	if err != nil {
+		writeInternalError(w, r, "Failed to start "+entity+" export", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[request.format])
+	w.Header().Set("Content-Disposition", `attachment; filename="`+entity+`.`+request.format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	var writer export.Writer
+	var encoder *json.Encoder
+	switch request.format {
+	case FormatNDJSON:
+		encoder = json.NewEncoder(w)
+	case FormatXLSX:
+		var err error
+		if writer, err = export.NewXLSX(w, entity); err != nil {
+			logger.Error("Failed to start ", entity, " export: ", err)
+			return
+		}
+	default:
+		writer = export.NewCSV(w)
+	}
+
+	if writer != nil {
+		if err := writer.WriteRow(request.flattener.Header()); err != nil {
+			logger.Error("Failed to write ", entity, " export: ", err)
+			return
+		}
+	}
+
+	count := 0
+	for cursor.Next(r.Context()) {
+		document := next()
+		if err := cursor.Decode(document); err != nil {
+			logger.Error("Failed to decode exported document: ", err)
+			return
+		}
+
+		if encoder != nil {
+			if err := encoder.Encode(document); err != nil {
+				logger.Error("Failed to write ", entity, " export: ", err)
+				return
+			}
+		} else {
+			rows, err := request.flattener.Rows(document)
+			if err != nil {
+				logger.Error("Failed to flatten exported document: ", err)
+				return
+			}
+			for _, row := range rows {
+				if err := writer.WriteRow(row); err != nil {
+					logger.Error("Failed to write ", entity, " export: ", err)
+					return
+				}
+			}
+		}
+
+		if count++; count%exportFlushRows == 0 {
+			if err := flushStream(controller, exportWriteTimeout); err != nil {
+				logger.Error("Failed to write ", entity, " export: ", err)
+				return
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		logger.Error("Failed to read ", entity, " export: ", err)
+		return
+	}
+
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			logger.Error("Failed to complete ", entity, " export: ", err)
+			return
+		}
+	}
+
+	logger.Info("Exported ", count, " ", entity)
+}
+
+// ExportClients streams the clients with their managed services and contacts as csv, ndjson or xlsx, filtered and
+// sorted like on /api/clients. In csv and xlsx the services and contacts are joined in one cell per field or, with
+// flatten=rows, written a row each for the array named by unwind.
+// e.g. /api/export/clients?format=xlsx&flatten=rows&unwind=managed_services&fields=client_name,managed_services
+func (h *Handler) ExportClients(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseExport(w, r, models.ClientResponse{}, clientFilterFields)
+	if !ok {
+		return
+	}
+
+	cursor, err := h.store.Clients.Export(r.Context(), request.opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to export clients", err)
+		return
+	}
+
+	streamExport(w, r, "clients", request, cursor, func() interface{} { return &models.ClientResponse{} })
+}
+
+// ExportServices streams the services with their clients as csv, ndjson or xlsx, filtered and sorted like on
+// /api/services, e.g. /api/export/services?format=csv&service_status=active&separator=|
+func (h *Handler) ExportServices(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseExport(w, r, models.ServiceResponse{}, serviceFilterFields)
+	if !ok {
+		return
+	}
+
+	cursor, err := h.store.Services.Export(r.Context(), request.opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to export services", err)
+		return
+	}
+
+	streamExport(w, r, "services", request, cursor, func() interface{} { return &models.ServiceResponse{} })
+}
+
+// ExportContacts streams the contacts with their clients as csv, ndjson or xlsx, filtered and sorted like on
+// /api/contacts, e.g. /api/export/contacts?format=ndjson&role=CTO
+func (h *Handler) ExportContacts(w http.ResponseWriter, r *http.Request) {
+	request, ok := parseExport(w, r, models.ContactResponse{}, contactFilterFields)
+	if !ok {
+		return
+	}
+
+	cursor, err := h.store.Contacts.Export(r.Context(), request.opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to export contacts", err)
+		return
+	}
+
+	streamExport(w, r, "contacts", request, cursor, func() interface{} { return &models.ContactResponse{} })
+}
@@ -0,0 +1,88 @@
+package controllers_test
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func exportCSV(t *testing.T, api *testAPI, path string) [][]string {
+	t.Helper()
+
+	w := api.request(http.MethodGet, path, "")
+	expectStatus(t, w, http.StatusOK)
+	if contentType := w.Header().Get("Content-Type"); contentType != controllers.CSVContentType+"; charset=utf-8" {
+		t.Fatalf("Content-Type = %s", contentType)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestExportClients(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	api.create("/api/clients", `{"client_name":"Globex"}`)
+	api.create("/api/services", newService("Hosting", acme))
+	api.create("/api/services", newService("Support", acme))
+
+	rows := exportCSV(t, api, "/api/export/clients?fields=client_name,managed_services.service_name&_sort=client_name&_order=ASC")
+	want := [][]string{{"client_name", "managed_services.service_name"}, {"Acme", "Hosting; Support"}, {"Globex", ""}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %v, want %v", rows, want)
+	}
+
+	// a row per service, filtered like the list
+	rows = exportCSV(t, api, "/api/export/clients?flatten=rows&unwind=managed_services&fields=client_name,managed_services.service_name&client_name=Acme&separator=|")
+	want = [][]string{{"client_name", "managed_services.service_name"}, {"Acme", "Hosting"}, {"Acme", "Support"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %v, want %v", rows, want)
+	}
+
+	w := api.request(http.MethodGet, "/api/export/clients?format=ndjson", "")
+	expectStatus(t, w, http.StatusOK)
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="clients.ndjson"` {
+		t.Fatalf("Content-Disposition = %s", disposition)
+	}
+	var clients []models.ClientResponse
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var client models.ClientResponse
+		if err := json.Unmarshal(scanner.Bytes(), &client); err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, client)
+	}
+	if len(clients) != 2 {
+		t.Fatalf("unexpected clients %+v", clients)
+	}
+
+	w = api.request(http.MethodGet, "/api/export/clients?format=xlsx", "")
+	expectStatus(t, w, http.StatusOK)
+	if contentType := w.Header().Get("Content-Type"); contentType != controllers.XLSXContentType {
+		t.Fatalf("Content-Type = %s", contentType)
+	}
+}
+
+func TestExportParameters(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, query := range []string{"format=pdf", "fields=nope", "flatten=nope", "flatten=rows", "nope=1"} {
+		expectProblem(t, api.request(http.MethodGet, "/api/export/clients?"+query, ""), http.StatusBadRequest, controllers.CodeInvalidQuery)
+	}
+
+	// contacts have a single array to unwind
+	rows := exportCSV(t, api, "/api/export/contacts?flatten=rows")
+	if len(rows) != 1 {
+		t.Fatalf("rows = %v", rows)
+	}
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/money"
+	"github.com/terrpan/clientdb/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// filterField maps a filterable json field name to the document path and the type its values are parsed into
+type filterField struct {
+	Path string
+	Type reflect.Type
+}
+
+// filterFields holds the fields that can be used for filtering and sorting a collection, keyed by json name
+type filterFields map[string]filterField
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	amountType   = reflect.TypeOf(money.Amount{})
+
+	// filterOperators are the operators accepted as field[op]=value
+	filterOperators = map[string]bool{
+		repository.OpEq:  true,
+		repository.OpNe:  true,
+		repository.OpGt:  true,
+		repository.OpGte: true,
+		repository.OpLt:  true,
+		repository.OpLte: true,
+		repository.OpIn:  true,
+		repository.OpNin: true,
+	}
+
+	// reservedParams are query parameters that are never treated as filters
+	reservedParams = map[string]bool{
+		"_start": true,
+		"_end":   true,
+		"_sort":  true,
+		"_order": true,
+		"q":      true,
+	}
+)
+
+// newFilterFields builds the filterable fields from the json and bson struct tags of a model.
+// Fields of nested structs (e.g. attached_to_client) are available both by their own json name (client_id)
+// and by their dotted json path (attached_to_client.client_id).
+func newFilterFields(model interface{}) filterFields {
+	fields := filterFields{}
+	addFilterFields(fields, reflect.TypeOf(model), "", "")
+	return fields
+}
+
+func addFilterFields(fields filterFields, t reflect.Type, jsonPrefix string, bsonPrefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName := tagName(field.Tag.Get("json"))
+		bsonName := tagName(field.Tag.Get("bson"))
+		if jsonName == "" || jsonName == "-" || bsonName == "" || bsonName == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Slice {
+			fieldType = fieldType.Elem()
+		}
+
+		// nested documents, mongoDB matches arrays of documents on any element
+		if fieldType.Kind() == reflect.Struct && fieldType != timeType && fieldType != objectIDType && fieldType != amountType {
+			addFilterFields(fields, fieldType, jsonPrefix+jsonName+".", bsonPrefix+bsonName+".")
+			continue
+		}
+
+		filter := filterField{Path: bsonPrefix + bsonName, Type: fieldType}
+		fields[jsonPrefix+jsonName] = filter
+		if _, exists := fields[jsonName]; !exists {
+			fields[jsonName] = filter
+		}
+	}
+}
+
+// tagName returns the name part of a struct tag, e.g. "_id" for `bson:"_id,omitempty"`
+func tagName(tag string) string {
+	return strings.Split(tag, ",")[0]
+}
+
+// parseFilters turns the query string into filters, e.g. ?service_status=active&invoice_amount[gte]=1000
+// Repeated parameters are combined, so ?id=a&id=b (used by react-admin getMany) matches either id.
+// Unknown fields, operators or values that can't be parsed into the field type are returned as error.
+func parseFilters(query url.Values, fields filterFields) ([]repository.Filter, error) {
+	var filters []repository.Filter
+
+	for param, values := range query {
+		if reservedParams[param] {
+			continue
+		}
+
+		name, operator := param, repository.OpEq
+		if open := strings.Index(param, "["); open > 0 && strings.HasSuffix(param, "]") {
+			name, operator = param[:open], param[open+1:len(param)-1]
+		}
+
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field: %s", name)
+		}
+
+		if !filterOperators[operator] {
+			return nil, fmt.Errorf("unknown filter operator: %s", operator)
+		}
+
+		// in and nin take a comma separated list
+		list := operator == repository.OpIn || operator == repository.OpNin
+		if list {
+			var split []string
+			for _, value := range values {
+				split = append(split, strings.Split(value, ",")...)
+			}
+			values = split
+		}
+
+		parsed := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			v, err := parseFilterValue(value, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %s", param, err.Error())
+			}
+			parsed = append(parsed, v)
+		}
+
+		switch {
+		case list:
+			filters = append(filters, repository.Filter{Path: field.Path, Operator: operator, Value: parsed})
+		case operator == repository.OpEq && len(parsed) > 1:
+			filters = append(filters, repository.Filter{Path: field.Path, Operator: repository.OpIn, Value: parsed})
+		case len(parsed) > 1:
+			return nil, fmt.Errorf("filter %s can only be given once", param)
+		default:
+			filters = append(filters, repository.Filter{Path: field.Path, Operator: operator, Value: parsed[0]})
+		}
+	}
+
+	return filters, nil
+}
+
+// parseFilterValue converts a query string value into the type of the filtered field
+func parseFilterValue(value string, t reflect.Type) (interface{}, error) {
+	switch {
+	case t == objectIDType:
+		return primitive.ObjectIDFromHex(value)
+	case t == timeType:
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+			return parsed, nil
+		}
+		return time.Parse("2006-01-02", value)
+	case t == amountType:
+		// amounts are compared as decimals, e.g. invoice_amount[gte]=1000.50
+		amount, err := money.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		return amount.Decimal128()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	}
+
+	return nil, fmt.Errorf("filtering on %s fields is not supported", t.String())
+}
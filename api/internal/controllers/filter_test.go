@@ -0,0 +1,60 @@
+package controllers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func listServices(t *testing.T, api *testAPI, query string) []string {
+	t.Helper()
+
+	w := api.request(http.MethodGet, "/api/services?"+query, "")
+	expectStatus(t, w, http.StatusOK)
+	var services []models.ServiceResponse
+	decode(t, w, &services)
+
+	names := []string{}
+	for _, service := range services {
+		names = append(names, service.ServiceName)
+	}
+	return names
+}
+
+func TestListFilters(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	globex := api.create("/api/clients", `{"client_name":"Globex"}`)
+	hosting := api.create("/api/services", strings.Replace(newService("Hosting", acme), `"1500.00"`, `"500.00"`, 1))
+	api.create("/api/services", newService("Backups", globex))
+	api.create("/api/services", strings.Replace(newService("Support", acme, globex), `"active"`, `"proposed"`, 1))
+
+	tests := map[string]string{
+		"invoice_amount[gte]=1000":                                           "Backups,Support",
+		"invoice_amount[lt]=1000.50":                                         "Hosting",
+		"service_status[ne]=active":                                          "Support",
+		"service_status[in]=proposed,onboarding":                             "Support",
+		"client_id=" + acme:                                                  "Hosting,Support",
+		"attached_to_client.client_id=" + globex:                             "Backups,Support",
+		"id=" + hosting + "&service_name=Hosting":                            "Hosting",
+		"service_name=Hosting&service_name=Backups&_sort=service_name":       "Backups,Hosting",
+		"created_on[gte]=2000-01-01&service_type=hosting&_sort=service_name": "Backups,Hosting,Support",
+	}
+	for query, want := range tests {
+		if got := strings.Join(listServices(t, api, query), ","); got != want {
+			t.Errorf("%s: got %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestListFiltersRejectInvalidParams(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, query := range []string{"password=x", "service_name[like]=x", "invoice_amount[gte]=lots", "id=nope", "created_on[gt]=yesterday", "service_name[gt]=a&service_name[gt]=b"} {
+		expectProblem(t, api.request(http.MethodGet, "/api/services?"+query, ""), http.StatusBadRequest, controllers.CodeInvalidQuery)
+	}
+}
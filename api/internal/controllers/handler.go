@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// Handler serves the HTTP API, the repositories are injected so the API can run on any store
+type Handler struct {
+	store *repository.Store
+	// tokens issues the tokens of users logging in, password login is disabled when it is nil
+	tokens *auth.TokenIssuer
+	// streams tracks the open event feeds so they can be closed at shutdown
+	streams *Streams
+	// allowedOrigins are the origins browsers may open the WebSocket feed from, like the cors origins
+	allowedOrigins []string
+}
+
+// NewHandler returns a Handler serving the API from store, users logging in get tokens issued by tokens. The event
+// feeds are tracked in streams and browsers may only open WebSockets from allowedOrigins.
+func NewHandler(store *repository.Store, tokens *auth.TokenIssuer, streams *Streams, allowedOrigins []string) *Handler {
+	return &Handler{store: store, tokens: tokens, streams: streams, allowedOrigins: allowedOrigins}
+}
+
+// RegisterPublicRoutes adds the routes that don't require credentials to r, which is mounted on /api in front of
+// the authenticated routes. They aren't covered by the access policy.
+func (h *Handler) RegisterPublicRoutes(r *mux.Router) {
+	r.HandleFunc("/login", h.Login).Methods("POST").Name("Login")
+}
+
+// RegisterRoutes adds the API routes to r, which is mounted on /api. Every route is named,
+// the names are used by the access policy in the auth package.
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/clients", h.GetClients).Methods("GET").Name("GetClients")
+	r.HandleFunc("/clients/{id}", h.GetClientbyId).Methods("GET").Name("GetClientById")
+	r.HandleFunc("/clients", h.AddClient).Methods("POST").Name("AddClient")
+	r.HandleFunc("/clients/{id}", h.UpdateClient).Methods("PUT").Name("UpdateClient")
+	r.HandleFunc("/clients/{id}", h.PatchClient).Methods("PATCH").Name("PatchClient")
+	r.HandleFunc("/clients/{id}", h.DeleteClient).Methods("DELETE").Name("DeleteClient")
+	r.HandleFunc("/clients/{id}/restore", h.RestoreClient).Methods("POST").Name("RestoreClient")
+	r.HandleFunc("/clients/{id}/services", h.GetClientServices).Methods("GET").Name("GetClientServices")
+	r.HandleFunc("/clients/{id}/services/{serviceId}", h.AttachClientService).Methods("POST").Name("AttachClientService")
+	r.HandleFunc("/clients/{id}/services/{serviceId}", h.DetachClientService).Methods("DELETE").Name("DetachClientService")
+	r.HandleFunc("/clients/{id}/contacts", h.GetClientContacts).Methods("GET").Name("GetClientContacts")
+	r.HandleFunc("/clients/{id}/contacts/{contactId}", h.AttachClientContact).Methods("POST").Name("AttachClientContact")
+	r.HandleFunc("/clients/{id}/contacts/{contactId}", h.DetachClientContact).Methods("DELETE").Name("DetachClientContact")
+	r.HandleFunc("/clients/{id}/invoices", h.GetClientInvoices).Methods("GET").Name("GetClientInvoices")
+	r.HandleFunc("/clients/{id}/invoices", h.AddClientInvoice).Methods("POST").Name("AddClientInvoice")
+	r.HandleFunc("/services", h.GetServices).Methods("GET").Name("GetServices")
+	r.HandleFunc("/services/{id}", h.GetServiceById).Methods("GET").Name("GetServiceById")
+	r.HandleFunc("/services", h.AddService).Methods("POST").Name("AddService")
+	r.HandleFunc("/services/{id}", h.UpdateService).Methods("PUT").Name("UpdateService")
+	r.HandleFunc("/services/{id}", h.PatchService).Methods("PATCH").Name("PatchService")
+	r.HandleFunc("/services/{id}", h.DeleteService).Methods("DELETE").Name("DeleteService")
+	r.HandleFunc("/services/{id}/restore", h.RestoreService).Methods("POST").Name("RestoreService")
+	r.HandleFunc("/services/{id}/transitions", h.TransitionService).Methods("POST").Name("TransitionService")
+	r.HandleFunc("/contacts", h.GetContacts).Methods("GET").Name("GetContacts")
+	r.HandleFunc("/contacts/{id}", h.GetContactById).Methods("GET").Name("GetContactById")
+	r.HandleFunc("/contacts", h.AddContact).Methods("POST").Name("AddContact")
+	r.HandleFunc("/contacts/{id}", h.UpdateContact).Methods("PUT").Name("UpdateContact")
+	r.HandleFunc("/contacts/{id}", h.PatchContact).Methods("PATCH").Name("PatchContact")
+	r.HandleFunc("/contacts/{id}", h.DeleteContact).Methods("DELETE").Name("DeleteContact")
+	r.HandleFunc("/contacts/{id}/restore", h.RestoreContact).Methods("POST").Name("RestoreContact")
+	r.HandleFunc("/invoices", h.GetInvoices).Methods("GET").Name("GetInvoices")
+	r.HandleFunc("/invoices/{id}", h.GetInvoiceById).Methods("GET").Name("GetInvoiceById")
+	r.HandleFunc("/invoices/{id}/transitions", h.TransitionInvoice).Methods("POST").Name("TransitionInvoice")
+	r.HandleFunc("/import/clients", h.ImportClients).Methods("POST").Name("ImportClients")
+	r.HandleFunc("/import/services", h.ImportServices).Methods("POST").Name("ImportServices")
+	r.HandleFunc("/import/contacts", h.ImportContacts).Methods("POST").Name("ImportContacts")
+	r.HandleFunc("/export/clients", h.ExportClients).Methods("GET").Name("ExportClients")
+	r.HandleFunc("/export/services", h.ExportServices).Methods("GET").Name("ExportServices")
+	r.HandleFunc("/export/contacts", h.ExportContacts).Methods("GET").Name("ExportContacts")
+	r.HandleFunc("/batch", h.Batch).Methods("POST").Name("Batch")
+	r.HandleFunc("/webhooks", h.GetWebhooks).Methods("GET").Name("GetWebhooks")
+	r.HandleFunc("/webhooks/{id}", h.GetWebhookById).Methods("GET").Name("GetWebhookById")
+	r.HandleFunc("/webhooks", h.AddWebhook).Methods("POST").Name("AddWebhook")
+	r.HandleFunc("/webhooks/{id}", h.UpdateWebhook).Methods("PUT").Name("UpdateWebhook")
+	r.HandleFunc("/webhooks/{id}", h.DeleteWebhook).Methods("DELETE").Name("DeleteWebhook")
+	r.HandleFunc("/webhooks/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET").Name("GetWebhookDeliveries")
+	r.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}/redeliver", h.RedeliverWebhookDelivery).Methods("POST").Name("RedeliverWebhookDelivery")
+	r.HandleFunc("/reports/revenue", h.GetRevenueReport).Methods("GET").Name("GetRevenueReport")
+	r.HandleFunc("/search", h.Search).Methods("GET").Name("Search")
+	r.HandleFunc("/trash", h.GetTrash).Methods("GET").Name("GetTrash")
+	r.HandleFunc("/audit", h.GetAudit).Methods("GET").Name("GetAudit")
+	r.HandleFunc("/events", h.GetEvents).Methods("GET").Name("GetEvents")
+	r.HandleFunc("/events/ws", h.GetEventsWebSocket).Methods("GET").Name("GetEventsWebSocket")
+}
@@ -0,0 +1,642 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NDJSONContentType is the media type of newline delimited json, one document per line
+const NDJSONContentType = "application/x-ndjson"
+
+const (
+	// maxImportRows limits the rows of an import, every row is checked before anything is stored
+	maxImportRows = 1000
+	// maxImportBytes limits the size of an import body
+	maxImportBytes = 10 << 20
+)
+
+// Statuses of the rows of an import, rows fail when they can't be stored
+const (
+	ImportValid    = "valid"
+	ImportInvalid  = "invalid"
+	ImportImported = "imported"
+	ImportFailed   = "failed"
+)
+
+// clientNameColumn holds the names of the clients a service or contact is attached to, csv cells list several
+// names separated by ;
+const clientNameColumn = "client_name"
+
+// ImportReport is the outcome of an import. The rows are only stored when every row is valid, a dry run checks
+// the rows without storing them.
+type ImportReport struct {
+	Entity   string         `json:"entity"`
+	DryRun   bool           `json:"dry_run"`
+	Rows     int            `json:"rows"`
+	Invalid  int            `json:"invalid"`
+	Imported int            `json:"imported"`
+	Results  []ImportResult `json:"results"`
+}
+
+// ImportResult is the outcome of a row of an import, Line is the line of the row in the imported file
+type ImportResult struct {
+	Line   int                 `json:"line"`
+	Status string              `json:"status"`
+	ID     *primitive.ObjectID `json:"id,omitempty"`
+	Code   string              `json:"code,omitempty"`
+	Errors []FieldError        `json:"errors,omitempty"`
+}
+
+// fail marks the row invalid, the code of the first failed check is kept
+func (result *ImportResult) fail(code string, errs ...FieldError) {
+	if result.Status != ImportInvalid {
+		result.Status, result.Code = ImportInvalid, code
+	}
+	result.Errors = append(result.Errors, errs...)
+}
+
+// importRow is a row of an imported file with the json value of every column keyed by field name
+type importRow struct {
+	line        int
+	fields      map[string]json.RawMessage
+	clientNames []string
+	err         error
+}
+
+// readImport reads the csv or ndjson rows of an import request, the names in the client_name column are taken
+// out of the fields when withClientNames is set. It returns whether the import is a dry run and writes a problem
+// and returns false when the body can't be read.
+func readImport(w http.ResponseWriter, r *http.Request, withClientNames bool) ([]importRow, bool, bool) {
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "dry_run must be true or false")
+			return nil, false, false
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != CSVContentType && mediaType != NDJSONContentType) {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"Imports require a "+CSVContentType+" or "+NDJSONContentType+" body")
+		return nil, false, false
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var rows []importRow
+	if mediaType == CSVContentType {
+		rows, err = readCSVRows(body, withClientNames)
+	} else {
+		rows, err = readNDJSONRows(body, withClientNames)
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid import: "+err.Error())
+		return nil, false, false
+	}
+
+	if len(rows) == 0 {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid import: no rows")
+		return nil, false, false
+	}
+
+	return rows, dryRun, true
+}
+
+// readCSVRows reads a csv file with a header row naming the json field of every column, empty cells are left out
+func readCSVRows(body io.Reader, withClientNames bool) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, errTooManyRows
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line, fields: map[string]json.RawMessage{}}
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+
+			if withClientNames && header[i] == clientNameColumn {
+				for _, name := range strings.Split(value, ";") {
+					if name = strings.TrimSpace(name); name != "" {
+						row.clientNames = append(row.clientNames, name)
+					}
+				}
+				continue
+			}
+
+			row.fields[header[i]], _ = json.Marshal(value)
+		}
+		rows = append(rows, row)
+	}
+}
+
+var errTooManyRows = errors.New("imports are limited to " + strconv.Itoa(maxImportRows) + " rows")
+
+// readNDJSONRows reads a json object per line, blank lines are skipped and a line that isn't an object makes its
+// row invalid. The client_name field holds a name or a list of names.
+func readNDJSONRows(body io.Reader, withClientNames bool) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportBytes)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, errTooManyRows
+		}
+
+		row := importRow{line: line}
+		if err := json.Unmarshal(text, &row.fields); err != nil {
+			row.err = err
+		} else if names, ok := row.fields[clientNameColumn]; ok && withClientNames {
+			delete(row.fields, clientNameColumn)
+			row.clientNames, row.err = decodeClientNames(names)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// decodeClientNames decodes a client name or a list of client names
+func decodeClientNames(value json.RawMessage) ([]string, error) {
+	var names []string
+	if err := json.Unmarshal(value, &names); err == nil {
+		return names, nil
+	}
+
+	var name string
+	if err := json.Unmarshal(value, &name); err != nil {
+		return nil, errors.New("client_name must be a string or a list of strings")
+	}
+	if name == "" {
+		return nil, nil
+	}
+	return []string{name}, nil
+}
+
+// decodeImportRow decodes the fields of a row into v like a request body, unknown fields are refused
+func decodeImportRow(row importRow, v interface{}) error {
+	if row.err != nil {
+		return row.err
+	}
+
+	data, err := json.Marshal(row.fields)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// newImportReport returns a report with a valid result for every row
+func newImportReport(entity string, dryRun bool, rows []importRow) ImportReport {
+	report := ImportReport{Entity: entity, DryRun: dryRun, Rows: len(rows), Results: make([]ImportResult, len(rows))}
+	for i, row := range rows {
+		report.Results[i] = ImportResult{Line: row.line, Status: ImportValid}
+	}
+	return report
+}
+
+// clientsByName returns the ids of the clients named in the client_name column of the rows, keyed by name
+func (h *Handler) clientsByName(ctx context.Context, rows []importRow) (map[string][]primitive.ObjectID, error) {
+	var names []string
+	for _, row := range rows {
+		names = append(names, row.clientNames...)
+	}
+
+	byName := map[string][]primitive.ObjectID{}
+	if len(names) == 0 {
+		return byName, nil
+	}
+
+	clients, err := h.store.Clients.FindByNames(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, client := range clients {
+		byName[client.ClientName] = append(byName[client.ClientName], client.ID)
+	}
+	return byName, nil
+}
+
+// resolveClientNames adds the clients named in the client_name column of row to attached, a name has to belong to
+// exactly one client
+func resolveClientNames(row importRow, byName map[string][]primitive.ObjectID, attached []models.Clients) ([]models.Clients, []FieldError) {
+	var errs []FieldError
+	for _, name := range row.clientNames {
+		switch ids := byName[name]; len(ids) {
+		case 0:
+			errs = append(errs, FieldError{Field: clientNameColumn, Rule: "exists", Message: "No client found with name: " + name})
+		case 1:
+			attached = append(attached, models.Clients{ClientID: ids[0]})
+		default:
+			errs = append(errs, FieldError{Field: clientNameColumn, Rule: "unique", Message: "More than one client is named: " + name})
+		}
+	}
+	return attached, errs
+}
+
+// writeImportReport counts the rows of the report and renders it
+func writeImportReport(w http.ResponseWriter, report ImportReport, status int) {
+	for _, result := range report.Results {
+		switch result.Status {
+		case ImportInvalid:
+			report.Invalid++
+		case ImportImported:
+			report.Imported++
+		}
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// errImportInvalid aborts the transaction of an import when a row turns out to be invalid
+var errImportInvalid = errors.New("import has invalid rows")
+
+// importCheck checks row i against the stored documents and fails result when the row can't be stored
+type importCheck func(ctx context.Context, i int, result *ImportResult) error
+
+// importInsert stores row i and returns its id and the stored document
+type importInsert func(ctx context.Context, i int) (primitive.ObjectID, interface{}, error)
+
+// runImport checks the valid rows of report with check and stores them with insert in a single transaction, so an
+// import is stored completely or not at all and the checks see the documents the import is stored next to. The
+// created documents are audited once the transaction is committed.
+func (h *Handler) runImport(w http.ResponseWriter, r *http.Request, report ImportReport, check importCheck, insert importInsert) {
+	checked := report.Results
+	documents := make([]interface{}, len(checked))
+	failed := -1
+
+	err := h.store.Transactions.Run(r.Context(), func(ctx context.Context) error {
+		// the transaction is retried on transient errors
+		report.Results, failed = make([]ImportResult, len(checked)), -1
+		for i, result := range checked {
+			result.Errors = append([]FieldError(nil), result.Errors...)
+			report.Results[i] = result
+		}
+
+		if check != nil {
+			for i := range report.Results {
+				if report.Results[i].Status == ImportInvalid {
+					continue
+				}
+				if err := check(ctx, i, &report.Results[i]); err != nil {
+					return err
+				}
+			}
+		}
+
+		if invalidRows(report) {
+			return errImportInvalid
+		}
+
+		if report.DryRun {
+			return nil
+		}
+
+		for i := range report.Results {
+			id, document, err := insert(ctx, i)
+			if err != nil {
+				failed = i
+				return err
+			}
+			report.Results[i].Status, report.Results[i].ID = ImportImported, &id
+			documents[i] = document
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errImportInvalid):
+		writeImportReport(w, report, http.StatusUnprocessableEntity)
+		return
+	case err != nil && failed < 0:
+		writeInternalError(w, r, "Failed to check the "+report.Entity+" against the stored "+report.Entity, err)
+		return
+	case err != nil:
+		// nothing was stored, the rows before the failed row are valid again
+		log.WithField("request_id", util.RequestIDFromContext(r.Context())).
+			Error("Failed to insert the ", report.Entity, " on line ", report.Results[failed].Line, ", the import was rolled back: ", err)
+		for i := range report.Results {
+			report.Results[i].ID = nil
+			if report.Results[i].Status == ImportImported {
+				report.Results[i].Status = ImportValid
+			}
+		}
+		report.Results[failed].Status = ImportFailed
+		writeImportReport(w, report, http.StatusInternalServerError)
+		return
+	case report.DryRun:
+		writeImportReport(w, report, http.StatusOK)
+		return
+	}
+
+	for i, result := range report.Results {
+		h.recordAudit(r, models.AuditCreate, report.Entity, *result.ID, nil, documents[i])
+	}
+
+	log.Info("Imported ", len(report.Results), " ", report.Entity)
+	writeImportReport(w, report, http.StatusCreated)
+}
+
+// invalidRows reports whether a row of the report is invalid
+func invalidRows(report ImportReport) bool {
+	for _, result := range report.Results {
+		if result.Status == ImportInvalid {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportClients imports clients from a csv or ndjson body with the checks of AddClient, the rows are only stored
+// when every row is valid, e.g. POST /api/import/clients?dry_run=true
+//
+//	client_name,web_url
+//	Acme,https://acme.example
+func (h *Handler) ImportClients(w http.ResponseWriter, r *http.Request) {
+	rows, dryRun, ok := readImport(w, r, false)
+	if !ok {
+		return
+	}
+
+	report := newImportReport("clients", dryRun, rows)
+	clients := make([]models.ClientBase, len(rows))
+	seen := map[string]int{}
+	for i, row := range rows {
+		result, client := &report.Results[i], &clients[i]
+
+		if err := decodeImportRow(row, client); err != nil {
+			result.fail(CodeInvalidRequest, FieldError{Rule: "decode", Message: err.Error()})
+			continue
+		}
+
+		if validationErr := validate.Struct(*client); validationErr != nil {
+			result.fail(CodeValidationFailed, fieldErrors(validationErr)...)
+			continue
+		}
+
+		denied, err := deniedFields(r, "clients", models.ClientBase{}, *client)
+		if err != nil {
+			writeInternalError(w, r, "Failed to check field permissions", err)
+			return
+		}
+		if len(denied) > 0 {
+			result.fail(CodeForbidden, denied...)
+			continue
+		}
+
+		// Don't allow duplicate client names, neither in the file nor with the stored clients
+		if line, ok := seen[client.ClientName]; ok {
+			result.fail(CodeAlreadyExists, FieldError{Field: "client_name", Rule: "unique", Message: "Client is also on line " + strconv.Itoa(line)})
+			continue
+		}
+		seen[client.ClientName] = row.line
+	}
+
+	// the names are checked in the transaction the clients are stored in
+	check := func(ctx context.Context, i int, result *ImportResult) error {
+		exists, err := h.store.Clients.NameExists(ctx, clients[i].ClientName)
+		if exists {
+			result.fail(CodeAlreadyExists, FieldError{Field: "client_name", Rule: "unique", Message: "Client already exists"})
+		}
+		return err
+	}
+
+	insert := func(ctx context.Context, i int) (primitive.ObjectID, interface{}, error) {
+		client := clients[i]
+		client.CreatedOn = time.Now()
+		client.ModifiedOn = client.CreatedOn
+
+		id, err := h.store.Clients.Insert(ctx, client)
+		client.ID, client.Version = id, 1
+		return id, client, err
+	}
+
+	h.runImport(w, r, report, check, insert)
+}
+
+// ImportServices imports services from a csv or ndjson body with the checks of AddService, the client_name column
+// attaches the services to clients by name. The rows are only stored when every row is valid,
+// e.g. POST /api/import/services?dry_run=true
+//
+//	service_name,service_type,service_owner,currency,client_name
+//	Hosting,hosting,Jane Doe,SEK,Acme;Globex
+func (h *Handler) ImportServices(w http.ResponseWriter, r *http.Request) {
+	rows, dryRun, ok := readImport(w, r, true)
+	if !ok {
+		return
+	}
+
+	byName, err := h.clientsByName(r.Context(), rows)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get the referenced clients", err)
+		return
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	report := newImportReport("services", dryRun, rows)
+	services := make([]models.ServiceBase, len(rows))
+	seen := map[string]int{}
+	for i, row := range rows {
+		result, service := &report.Results[i], &services[i]
+
+		if err := decodeImportRow(row, service); err != nil {
+			result.fail(CodeInvalidRequest, FieldError{Rule: "decode", Message: err.Error()})
+			continue
+		}
+
+		// new services start their lifecycle as proposed unless they are registered in another status
+		if service.ServiceStatus == "" {
+			service.ServiceStatus = models.StatusProposed
+		}
+
+		if validationErr := validate.Struct(*service); validationErr != nil {
+			result.fail(CodeValidationFailed, fieldErrors(validationErr)...)
+			continue
+		}
+
+		// every attached client has to exist
+		attached, unknown := resolveClientNames(row, byName, service.AttachedToClient)
+		if len(unknown) > 0 {
+			result.fail(CodeUnknownReference, unknown...)
+			continue
+		}
+
+		service.AttachedToClient, unknown, err = h.clientReferences(r.Context(), attached, nil)
+		if err != nil {
+			writeInternalError(w, r, "Failed to check the attached clients", err)
+			return
+		}
+		if len(unknown) > 0 {
+			result.fail(CodeUnknownReference, unknown...)
+			continue
+		}
+
+		denied, err := deniedFields(r, "services", newServiceFields(*service), *service)
+		if err != nil {
+			writeInternalError(w, r, "Failed to check field permissions", err)
+			return
+		}
+		if len(denied) > 0 {
+			result.fail(CodeForbidden, denied...)
+			continue
+		}
+
+		// Don't allow duplicate service names, neither in the file nor with the stored services
+		if line, ok := seen[service.ServiceName]; ok {
+			result.fail(CodeAlreadyExists, FieldError{Field: "service_name", Rule: "unique", Message: "Service is also on line " + strconv.Itoa(line)})
+			continue
+		}
+		seen[service.ServiceName] = row.line
+	}
+
+	// the names are checked in the transaction the services are stored in
+	check := func(ctx context.Context, i int, result *ImportResult) error {
+		exists, err := h.store.Services.NameExists(ctx, services[i].ServiceName)
+		if exists {
+			result.fail(CodeAlreadyExists, FieldError{Field: "service_name", Rule: "unique", Message: "Service already exists"})
+		}
+		return err
+	}
+
+	insert := func(ctx context.Context, i int) (primitive.ObjectID, interface{}, error) {
+		service := services[i]
+		service.CreatedOn = time.Now()
+		service.ModifiedOn = service.CreatedOn
+
+		// the initial status counts as the first transition
+		service.StatusChangedOn, service.StatusChangedBy = service.CreatedOn, identity.Subject
+
+		id, err := h.store.Services.Insert(ctx, service)
+		service.ID, service.Version = id, 1
+		return id, service, err
+	}
+
+	h.runImport(w, r, report, check, insert)
+}
+
+// ImportContacts imports contacts from a csv or ndjson body with the checks of AddContact, the client_name column
+// attaches the contacts to clients by name. The rows are only stored when every row is valid,
+// e.g. POST /api/import/contacts?dry_run=true
+//
+//	{"first_name": "Jane", "last_name": "Doe", "email": "jane@acme.example", "client_name": "Acme"}
+func (h *Handler) ImportContacts(w http.ResponseWriter, r *http.Request) {
+	rows, dryRun, ok := readImport(w, r, true)
+	if !ok {
+		return
+	}
+
+	byName, err := h.clientsByName(r.Context(), rows)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get the referenced clients", err)
+		return
+	}
+
+	report := newImportReport("contacts", dryRun, rows)
+	contacts := make([]models.ContactsBase, len(rows))
+	for i, row := range rows {
+		result, contact := &report.Results[i], &contacts[i]
+
+		if err := decodeImportRow(row, contact); err != nil {
+			result.fail(CodeInvalidRequest, FieldError{Rule: "decode", Message: err.Error()})
+			continue
+		}
+
+		if validationErr := validate.Struct(*contact); validationErr != nil {
+			result.fail(CodeValidationFailed, fieldErrors(validationErr)...)
+			continue
+		}
+
+		// every attached client has to exist
+		attached, unknown := resolveClientNames(row, byName, contact.AttachedToClient)
+		if len(unknown) > 0 {
+			result.fail(CodeUnknownReference, unknown...)
+			continue
+		}
+
+		contact.AttachedToClient, unknown, err = h.clientReferences(r.Context(), attached, nil)
+		if err != nil {
+			writeInternalError(w, r, "Failed to check the attached clients", err)
+			return
+		}
+		if len(unknown) > 0 {
+			result.fail(CodeUnknownReference, unknown...)
+			continue
+		}
+
+		denied, err := deniedFields(r, "contacts", models.ContactsBase{}, *contact)
+		if err != nil {
+			writeInternalError(w, r, "Failed to check field permissions", err)
+			return
+		}
+		if len(denied) > 0 {
+			result.fail(CodeForbidden, denied...)
+		}
+	}
+
+	insert := func(ctx context.Context, i int) (primitive.ObjectID, interface{}, error) {
+		contact := contacts[i]
+		// Merge Firsname and Lastname into FullName
+		contact.FullName = contact.FirstName + " " + contact.LastName
+		contact.CreatedOn = time.Now()
+		contact.ModifiedOn = contact.CreatedOn
+
+		id, err := h.store.Contacts.Insert(ctx, contact)
+		contact.ID, contact.Version = id, 1
+		return id, contact, err
+	}
+
+	h.runImport(w, r, report, nil, insert)
+}
@@ -0,0 +1,127 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingClients fails to insert the client named fail
+type failingClients struct {
+	repository.ClientRepository
+	fail string
+}
+
+func (c failingClients) Insert(ctx context.Context, client models.ClientBase) (primitive.ObjectID, error) {
+	if client.ClientName == c.fail {
+		return primitive.NilObjectID, errors.New("disk full")
+	}
+	return c.ClientRepository.Insert(ctx, client)
+}
+
+func importClients(t *testing.T, api *testAPI, query string, body string, status int) controllers.ImportReport {
+	t.Helper()
+
+	w := api.request(http.MethodPost, "/api/import/clients"+query, body, "Content-Type", "text/csv")
+	expectStatus(t, w, status)
+	var report controllers.ImportReport
+	decode(t, w, &report)
+	return report
+}
+
+func countClients(t *testing.T, api *testAPI) string {
+	t.Helper()
+
+	w := api.request(http.MethodGet, "/api/clients", "")
+	expectStatus(t, w, http.StatusOK)
+	return w.Header().Get("X-Total-Count")
+}
+
+func TestImportClients(t *testing.T) {
+	api := newTestAPI(t)
+	api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	body := "client_name,web_url\nGlobex,https://globex.example\nInitech,https://initech.example\n"
+
+	// a dry run checks the rows without storing them
+	report := importClients(t, api, "?dry_run=true", body, http.StatusOK)
+	if !report.DryRun || report.Rows != 2 || report.Imported != 0 || report.Results[0].Status != controllers.ImportValid {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if count := countClients(t, api); count != "1" {
+		t.Fatalf("X-Total-Count = %s, want 1", count)
+	}
+
+	report = importClients(t, api, "", body, http.StatusCreated)
+	if report.Imported != 2 || report.Results[1].Line != 3 || report.Results[1].ID == nil {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if entries := auditLog(t, api, "entity=clients&id="+report.Results[1].ID.Hex()); len(entries) != 1 || entries[0].Action != models.AuditCreate {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+
+	// the names are unique in the file and with the stored clients
+	report = importClients(t, api, "", "client_name\nAcme\nHooli\nHooli\n", http.StatusUnprocessableEntity)
+	if report.Invalid != 2 || report.Results[0].Code != controllers.CodeAlreadyExists || report.Results[1].Status != controllers.ImportValid ||
+		report.Results[2].Code != controllers.CodeAlreadyExists {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if count := countClients(t, api); count != "3" {
+		t.Fatalf("X-Total-Count = %s, want 3", count)
+	}
+
+	expectProblem(t, api.request(http.MethodPost, "/api/import/clients", body), http.StatusUnsupportedMediaType, controllers.CodeUnsupportedMediaType)
+}
+
+func TestImportClientsRollsBack(t *testing.T) {
+	api := newTestAPI(t)
+	api.store.Clients = failingClients{ClientRepository: api.store.Clients, fail: "Initech"}
+
+	// a failed insert leaves none of the rows stored
+	report := importClients(t, api, "", "client_name\nGlobex\nInitech\nHooli\n", http.StatusInternalServerError)
+	if report.Imported != 0 || report.Results[0].Status != controllers.ImportValid || report.Results[0].ID != nil ||
+		report.Results[1].Status != controllers.ImportFailed || report.Results[2].Status != controllers.ImportValid {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if count := countClients(t, api); count != "0" {
+		t.Fatalf("X-Total-Count = %s, want 0", count)
+	}
+	if entries := auditLog(t, api, "entity=clients"); len(entries) != 0 {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+}
+
+func TestImportServicesAndContacts(t *testing.T) {
+	api := newTestAPI(t)
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	// clients are referenced by name, an editor may choose the currency of a new service
+	w := api.as(auth.RoleEditor).request(http.MethodPost, "/api/import/services", "service_name,service_type,service_owner,currency,client_name\nHosting,hosting,Jane Doe,SEK,Acme\n",
+		"Content-Type", "text/csv")
+	expectStatus(t, w, http.StatusCreated)
+
+	w = api.request(http.MethodGet, "/api/clients/"+acme+"/services", "")
+	expectStatus(t, w, http.StatusOK)
+	var services []models.ServiceResponse
+	decode(t, w, &services)
+	if len(services) != 1 || services[0].ServiceStatus != models.StatusProposed {
+		t.Fatalf("unexpected services %+v", services)
+	}
+
+	body := `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example","client_name":"Acme"}` + "\n" +
+		`{"first_name":"John","last_name":"Roe","email":"john@globex.example","client_name":"Globex"}` + "\n"
+	w = api.request(http.MethodPost, "/api/import/contacts", body, "Content-Type", controllers.NDJSONContentType)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	var report controllers.ImportReport
+	decode(t, w, &report)
+	if report.Invalid != 1 || report.Results[1].Code != controllers.CodeUnknownReference {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/billing"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	invoiceFilterFields = newFilterFields(models.Invoice{})
+)
+
+// GetInvoices returns a page of invoices, e.g. /api/invoices?status=issued&period_start[gte]=2026-01-01T00:00:00Z
+func (h *Handler) GetInvoices(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, invoiceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	// invoices have no text index
+	if opts.Query != "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invoices don't support full text search")
+		return
+	}
+
+	opts.Filters, err = parseFilters(r.URL.Query(), invoiceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	invoices, total, err := h.store.Invoices.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get invoices", err)
+		return
+	}
+
+	setRangeHeaders(w, "invoices", opts.Start, len(invoices), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invoices)
+}
+
+// GetClientInvoices returns a page of the invoices of a client
+// e.g. /api/clients/{id}/invoices?_start=0&_end=10&_sort=period_start&_order=DESC
+func (h *Handler) GetClientInvoices(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	opts, err := parseListParams(r, invoiceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	if opts.Query != "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invoices don't support full text search")
+		return
+	}
+
+	opts.Filters, err = parseFilters(r.URL.Query(), invoiceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	// an unknown client is a 404 rather than an empty page
+	if !h.findClient(w, r, clientID) {
+		return
+	}
+
+	opts.Filters = append(opts.Filters, repository.Filter{Path: "client_id", Operator: repository.OpEq, Value: clientID})
+
+	invoices, total, err := h.store.Invoices.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get invoices", err)
+		return
+	}
+
+	setRangeHeaders(w, "invoices", opts.Start, len(invoices), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invoices)
+}
+
+// GetInvoiceById returns a single invoice
+func (h *Handler) GetInvoiceById(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invoice")
+	if !ok {
+		return
+	}
+
+	invoice, err := h.store.Invoices.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No invoice found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get invoice", err)
+		return
+	}
+
+	if notModified(w, r, invoice.Version) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// AddClientInvoice generates a draft invoice billing the active services of a client for a period, the period end
+// is exclusive, e.g. POST /api/clients/{id}/invoices
+// {"period_start": "2026-10-01T00:00:00Z", "period_end": "2026-11-01T00:00:00Z", "currency": "SEK"}
+func (h *Handler) AddClientInvoice(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	var request models.InvoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if validationErr := validate.Struct(request); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	client, err := h.store.Clients.Find(r.Context(), clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No client found with id: "+clientID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get client", err)
+		return
+	}
+
+	// only active services are billed
+	services, _, err := h.store.Services.List(r.Context(), repository.ListOptions{
+		Sort:  "_id",
+		Order: 1,
+		Filters: []repository.Filter{
+			{Path: "attached_to_client._id", Operator: repository.OpEq, Value: clientID},
+			{Path: "service_status", Operator: repository.OpEq, Value: models.StatusActive},
+		},
+	})
+	if err != nil {
+		writeInternalError(w, r, "Failed to get services", err)
+		return
+	}
+
+	// an invoice is in a single currency, the request picks it when the client is billed in several
+	currency := request.Currency
+	if currency == "" {
+		currencies := billedCurrencies(services)
+		switch len(currencies) {
+		case 0:
+			writeProblem(w, r, http.StatusUnprocessableEntity, CodeNothingToInvoice, "Client has no active services to bill for the period")
+			return
+		case 1:
+			currency = currencies[0]
+		default:
+			writeProblem(w, r, http.StatusUnprocessableEntity, CodeMixedCurrencies, "Client is billed in "+
+				strings.Join(currencies, ", ")+", pick the currency of the invoice")
+			return
+		}
+	}
+
+	var billed []models.ServiceResponse
+	for _, service := range services {
+		if service.Currency == currency {
+			billed = append(billed, service)
+		}
+	}
+
+	// a service that can't be billed fails the whole invoice rather than leaving it out unnoticed
+	invoice, err := billing.Draft(client, currency, billed, request.PeriodStart, request.PeriodEnd)
+	var unknownFrequency *billing.UnknownFrequencyError
+	if errors.As(err, &unknownFrequency) {
+		writeProblem(w, r, http.StatusUnprocessableEntity, CodeUnknownFrequency, "Failed to bill "+err.Error())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to generate invoice", err)
+		return
+	}
+
+	if len(invoice.Lines) == 0 {
+		writeProblem(w, r, http.StatusUnprocessableEntity, CodeNothingToInvoice, "Client has no active "+currency+" services to bill for the period")
+		return
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	invoice.CreatedOn, invoice.CreatedBy = time.Now(), identity.Subject
+	invoice.ModifiedOn = invoice.CreatedOn
+
+	// a period is billed once per currency, void the existing invoice to generate it again. The check and the
+	// insert run in one transaction, the unique index on the period start catches drafts generated at once.
+	var id primitive.ObjectID
+	err = h.store.Transactions.Run(r.Context(), func(ctx context.Context) error {
+		overlaps, err := h.store.Invoices.Overlaps(ctx, clientID, currency, request.PeriodStart, request.PeriodEnd)
+		if err != nil {
+			return err
+		}
+		if overlaps {
+			return repository.ErrAlreadyExists
+		}
+
+		id, err = h.store.Invoices.Insert(ctx, invoice)
+		return err
+	})
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		writeProblem(w, r, http.StatusConflict, CodeAlreadyExists, "Client already has a "+currency+" invoice for a period overlapping "+
+			request.PeriodStart.Format(time.RFC3339)+" to "+request.PeriodEnd.Format(time.RFC3339))
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to insert invoice", err)
+		return
+	}
+	invoice.ID, invoice.Version = id, 1
+
+	log.Info("Invoice created ", id.Hex(), " for client ", clientID.Hex())
+	h.recordAudit(r, models.AuditCreate, "invoices", id, nil, invoice)
+
+	w.Header().Set("ETag", etag(invoice.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// TransitionInvoice moves an invoice to another status, issuing an invoice assigns its number
+// e.g. POST /api/invoices/{id}/transitions {"to": "issued"}
+func (h *Handler) TransitionInvoice(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invoice")
+	if !ok {
+		return
+	}
+
+	var transition models.InvoiceTransition
+	if err := json.NewDecoder(r.Body).Decode(&transition); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if validationErr := validate.Struct(transition); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	current, err := h.store.Invoices.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No invoice found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get invoice", err)
+		return
+	}
+
+	// the transition is only conditional when the caller sends If-Match
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
+
+	if !models.CanTransitionInvoice(current.Status, transition.To) {
+		message := "Invoice status " + current.Status + " is final"
+		if allowed := models.NextInvoiceStatuses(current.Status); len(allowed) > 0 {
+			message = "Invoice can't move from " + current.Status + " to " + transition.To +
+				", allowed: " + strings.Join(allowed, ", ")
+		}
+		writeProblem(w, r, http.StatusConflict, CodeInvalidTransition, message)
+		return
+	}
+
+	now := time.Now()
+	changes := repository.Changes{Set: map[string]interface{}{
+		"status":      transition.To,
+		"modified_on": now,
+	}}
+
+	switch transition.To {
+	case models.InvoiceIssued:
+		// numbers are taken from the sequence of the year of issue, a failed update below leaves a gap
+		sequence, err := h.store.Invoices.NextNumber(r.Context(), now.Year())
+		if err != nil {
+			writeInternalError(w, r, "Failed to number invoice", err)
+			return
+		}
+		changes.Set["number"] = billing.Number(now.Year(), sequence)
+		changes.Set["issued_on"] = now
+	case models.InvoicePaid:
+		changes.Set["paid_on"] = now
+	case models.InvoiceVoid:
+		changes.Set["voided_on"] = now
+	}
+
+	invoice, err := h.store.Invoices.Patch(r.Context(), id, current.Version, changes)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No invoice found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to change the invoice status", err)
+		return
+	}
+
+	log.Info("Invoice ", id.Hex(), " moved from ", current.Status, " to ", invoice.Status)
+	h.recordAudit(r, models.AuditUpdate, "invoices", id, current, invoice)
+
+	w.Header().Set("ETag", etag(invoice.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// billedCurrencies returns the sorted currencies of the services with an amount to bill
+func billedCurrencies(services []models.ServiceResponse) []string {
+	seen := map[string]bool{}
+	var currencies []string
+	for _, service := range services {
+		if billing.Billable(service) && !seen[service.Currency] {
+			seen[service.Currency] = true
+			currencies = append(currencies, service.Currency)
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
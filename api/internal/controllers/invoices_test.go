@@ -0,0 +1,106 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const january = `{"period_start":"2026-01-01T00:00:00Z","period_end":"2026-02-01T00:00:00Z"}`
+
+// december is before the january period, services active since then are billed for all of it
+var december = time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+// activeSince moves the status change of the service at version 1 to since, the services of a test are created now
+// and aren't billed for a period before that
+func activeSince(t *testing.T, api *testAPI, id string, since time.Time) {
+	t.Helper()
+
+	serviceID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := repository.Changes{Set: map[string]interface{}{"status_changed_on": since}}
+	if _, err := api.store.Services.Patch(context.Background(), serviceID, 1, changes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddClientInvoice(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	hosting := api.create("/api/services", newService("Hosting", acme))
+	activeSince(t, api, hosting, december)
+	pilot := api.create("/api/services", strings.Replace(newService("Pilot", acme), `"active"`, `"proposed"`, 1))
+	activeSince(t, api, pilot, december)
+	// activated after the period
+	api.create("/api/services", newService("Backups", acme))
+
+	w := api.request(http.MethodPost, "/api/clients/"+acme+"/invoices", january)
+	expectStatus(t, w, http.StatusCreated)
+	var invoice models.Invoice
+	decode(t, w, &invoice)
+	// only the service that was active during the period is billed
+	if len(invoice.Lines) != 1 || invoice.Total.String() != "1500" || invoice.Currency != "SEK" || invoice.Status != models.InvoiceDraft {
+		t.Fatalf("unexpected invoice %+v", invoice)
+	}
+
+	// a period is billed once per currency
+	expectProblem(t, api.request(http.MethodPost, "/api/clients/"+acme+"/invoices", january), http.StatusConflict, controllers.CodeAlreadyExists)
+	expectProblem(t, api.request(http.MethodPost, "/api/clients/"+acme+"/invoices", `{"period_start":"2026-01-15T00:00:00Z","period_end":"2026-02-15T00:00:00Z"}`),
+		http.StatusConflict, controllers.CodeAlreadyExists)
+
+	// a void invoice frees its period
+	expectStatus(t, api.request(http.MethodPost, "/api/invoices/"+invoice.ID.Hex()+"/transitions", `{"to":"void"}`), http.StatusOK)
+	expectStatus(t, api.request(http.MethodPost, "/api/clients/"+acme+"/invoices", january), http.StatusCreated)
+
+	w = api.request(http.MethodGet, "/api/clients/"+acme+"/invoices", "")
+	expectStatus(t, w, http.StatusOK)
+	var invoices []models.Invoice
+	decode(t, w, &invoices)
+	if len(invoices) != 2 {
+		t.Fatalf("unexpected invoices %+v", invoices)
+	}
+
+	expectStatus(t, api.as(auth.RoleViewer).request(http.MethodPost, "/api/clients/"+acme+"/invoices", january), http.StatusForbidden)
+}
+
+func TestAddClientInvoiceWithUnknownFrequency(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	activeSince(t, api, api.create("/api/services", newService("Hosting", acme)), december)
+	odd := api.create("/api/services", strings.Replace(newService("Odd", acme), `"Monthly"`, `"Whenever"`, 1))
+	activeSince(t, api, odd, december)
+
+	w := api.request(http.MethodPost, "/api/clients/"+acme+"/invoices", january)
+	expectProblem(t, w, http.StatusUnprocessableEntity, controllers.CodeUnknownFrequency)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if !strings.Contains(problem.Message, "Whenever") {
+		t.Fatalf("unexpected message %q", problem.Message)
+	}
+}
+
+func TestInsertInvoiceForTheSamePeriod(t *testing.T) {
+	api := newTestAPI(t)
+
+	// the store refuses the same period even when the overlap check was raced
+	invoice := models.Invoice{Currency: "SEK", PeriodStart: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Status: models.InvoiceDraft}
+	if _, err := api.store.Invoices.Insert(context.Background(), invoice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.store.Invoices.Insert(context.Background(), invoice); !errors.Is(err, repository.ErrAlreadyExists) {
+		t.Fatalf("err = %v, want %v", err, repository.ErrAlreadyExists)
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// parseListParams reads the pagination, sorting and search parameters sent by react-admin (ra-data-json-server)
+// e.g. ?_start=0&_end=10&_sort=client_name&_order=ASC&q=acme
+// _sort is checked against the filterable fields, passing nil fields disables sorting on anything but _id.
+func parseListParams(r *http.Request, fields filterFields) (repository.ListOptions, error) {
+	query := r.URL.Query()
+	params := repository.ListOptions{Sort: "_id", Order: 1, Query: strings.TrimSpace(query.Get("q"))}
+
+	if start := query.Get("_start"); start != "" {
+		value, err := strconv.Atoi(start)
+		if err != nil || value < 0 {
+			return params, errors.New("_start must be a non-negative integer")
+		}
+		params.Start = value
+	}
+
+	if end := query.Get("_end"); end != "" {
+		value, err := strconv.Atoi(end)
+		if err != nil || value < 0 {
+			return params, errors.New("_end must be a non-negative integer")
+		}
+		if value < params.Start {
+			return params, errors.New("_end must be greater than or equal to _start")
+		}
+		params.End = value
+	}
+
+	// map the json field name to the document path, e.g. react-admin sorts on "id" while documents are keyed on "_id"
+	switch sort := query.Get("_sort"); sort {
+	case "":
+	case repository.ScoreField:
+		params.Sort = repository.ScoreField
+	default:
+		field, ok := fields[sort]
+		if !ok {
+			return params, errors.New("unknown sort field: " + sort)
+		}
+		params.Sort = field.Path
+	}
+
+	switch strings.ToUpper(query.Get("_order")) {
+	case "", "ASC":
+		params.Order = 1
+	case "DESC":
+		params.Order = -1
+	default:
+		return params, errors.New("_order must be either ASC or DESC")
+	}
+
+	// rank search results by relevance unless the caller asked for a specific order
+	if params.Query != "" && query.Get("_sort") == "" {
+		params.Sort = repository.ScoreField
+		params.Order = -1
+	}
+
+	if params.Sort == repository.ScoreField && params.Query == "" {
+		return params, errors.New("_sort=" + repository.ScoreField + " requires a search query")
+	}
+
+	return params, nil
+}
+
+// setRangeHeaders sets X-Total-Count (used by ra-data-json-server) and Content-Range, e.g. "clients 0-9/42"
+func setRangeHeaders(w http.ResponseWriter, resource string, start int, count int, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if count == 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("%s */%d", resource, total))
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("%s %d-%d/%d", resource, start, start+count-1, total))
+}
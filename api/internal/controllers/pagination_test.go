@@ -0,0 +1,45 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func TestListPagination(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, name := range []string{"Beta", "Delta", "Alpha", "Gamma"} {
+		api.create("/api/clients", `{"client_name":"`+name+`"}`)
+	}
+
+	w := api.request(http.MethodGet, "/api/clients?_start=1&_end=3&_sort=client_name&_order=DESC", "")
+	expectStatus(t, w, http.StatusOK)
+	var clients []models.ClientResponse
+	decode(t, w, &clients)
+	if len(clients) != 2 || clients[0].ClientName != "Delta" || clients[1].ClientName != "Beta" {
+		t.Fatalf("unexpected page %+v", clients)
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "4" {
+		t.Fatalf("X-Total-Count = %q, want 4", total)
+	}
+	if contentRange := w.Header().Get("Content-Range"); contentRange != "clients 1-2/4" {
+		t.Fatalf("Content-Range = %q, want clients 1-2/4", contentRange)
+	}
+
+	w = api.request(http.MethodGet, "/api/clients?_start=10&_end=20", "")
+	expectStatus(t, w, http.StatusOK)
+	if contentRange := w.Header().Get("Content-Range"); contentRange != "clients */4" {
+		t.Fatalf("Content-Range = %q, want clients */4", contentRange)
+	}
+}
+
+func TestListPaginationRejectsInvalidParams(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, query := range []string{"_start=-1", "_start=5&_end=2", "_sort=password", "_order=UP", "_sort=score"} {
+		expectProblem(t, api.request(http.MethodGet, "/api/services?"+query, ""), http.StatusBadRequest, controllers.CodeInvalidQuery)
+	}
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// Media types accepted by the PATCH endpoints
+const (
+	// https://datatracker.ietf.org/doc/html/rfc7396
+	MergePatchContentType = "application/merge-patch+json"
+	// https://datatracker.ietf.org/doc/html/rfc6902
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// applyPatch applies the JSON merge patch or JSON patch in the body of r to the json representation of current
+// and decodes the result into patched. Plain application/json bodies are treated as merge patches.
+// It writes a problem and returns false when the patch can't be applied.
+func applyPatch(w http.ResponseWriter, r *http.Request, current interface{}, patched interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	if mediaType != MergePatchContentType && mediaType != JSONPatchContentType && mediaType != "application/json" {
+		w.Header().Set("Accept-Patch", MergePatchContentType+", "+JSONPatchContentType)
+		writeProblem(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"PATCH requires an "+MergePatchContentType+" or "+JSONPatchContentType+" body")
+		return false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to read request body: "+err.Error())
+		return false
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		writeInternalError(w, r, "Failed to encode the stored document", err)
+		return false
+	}
+
+	var result []byte
+	if mediaType == JSONPatchContentType {
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON patch: "+err.Error())
+			return false
+		}
+
+		result, err = patch.Apply(original)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			writeProblem(w, r, http.StatusConflict, CodeConflict, "JSON patch test operation failed: "+err.Error())
+			return false
+		}
+		if err != nil {
+			writeProblem(w, r, http.StatusUnprocessableEntity, CodeInvalidPatch, "Failed to apply JSON patch: "+err.Error())
+			return false
+		}
+	} else {
+		if !json.Valid(body) {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid merge patch: body is not valid json")
+			return false
+		}
+
+		result, err = jsonpatch.MergePatch(original, body)
+		if err != nil {
+			writeProblem(w, r, http.StatusUnprocessableEntity, CodeInvalidPatch, "Failed to apply merge patch: "+err.Error())
+			return false
+		}
+	}
+
+	// unknown fields are refused, they would silently be dropped otherwise
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(patched); err != nil {
+		writeProblem(w, r, http.StatusUnprocessableEntity, CodeInvalidPatch, "Patched document is invalid: "+err.Error())
+		return false
+	}
+
+	return true
+}
+
+// patchChanges returns the fields that differ between the bson documents of current and patched,
+// fields missing from patched are removed
+func patchChanges(current interface{}, patched interface{}) (repository.Changes, error) {
+	changes := repository.Changes{Set: map[string]interface{}{}}
+
+	currentDocument, err := document(current)
+	if err != nil {
+		return changes, err
+	}
+	patchedDocument, err := document(patched)
+	if err != nil {
+		return changes, err
+	}
+
+	for field, value := range patchedDocument {
+		if field != "_id" && !reflect.DeepEqual(value, currentDocument[field]) {
+			changes.Set[field] = value
+		}
+	}
+	for field := range currentDocument {
+		if _, ok := patchedDocument[field]; !ok && field != "_id" {
+			changes.Unset = append(changes.Unset, field)
+		}
+	}
+
+	return changes, nil
+}
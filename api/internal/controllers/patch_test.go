@@ -0,0 +1,57 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+// patch sends a PATCH with the media type of the patch, unconditionally
+func patch(api *testAPI, path string, mediaType string, body string) *httptest.ResponseRecorder {
+	return api.request(http.MethodPatch, path, body, "Content-Type", mediaType, "If-Match", "*")
+}
+
+func TestMergePatch(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme","slack_channel":"#acme","web_url":"https://acme.example"}`)
+
+	w := patch(api, "/api/clients/"+id, controllers.MergePatchContentType, `{"slack_channel":null,"web_url":"https://acme.test"}`)
+	expectStatus(t, w, http.StatusOK)
+	var client models.ClientBase
+	decode(t, w, &client)
+	if client.ClientName != "Acme" || client.SlackChannel != "" || client.WebUrl != "https://acme.test" || client.Version != 2 {
+		t.Fatalf("unexpected patched client %+v", client)
+	}
+
+	expectProblem(t, patch(api, "/api/clients/"+id, controllers.MergePatchContentType, `{"client_name":""}`), http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectProblem(t, patch(api, "/api/clients/"+id, controllers.MergePatchContentType, `{"nickname":"acme"}`), http.StatusUnprocessableEntity, controllers.CodeInvalidPatch)
+	expectProblem(t, patch(api, "/api/clients/"+id, controllers.MergePatchContentType, `{`), http.StatusBadRequest, controllers.CodeInvalidRequest)
+	expectProblem(t, patch(api, "/api/clients/"+id, "text/plain", `slack_channel=#acme`), http.StatusUnsupportedMediaType, controllers.CodeUnsupportedMediaType)
+}
+
+func TestJSONPatch(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	globex := api.create("/api/clients", `{"client_name":"Globex"}`)
+	id := api.create("/api/services", newService("Hosting", acme))
+
+	w := patch(api, "/api/services/"+id, controllers.JSONPatchContentType,
+		`[{"op":"test","path":"/service_owner","value":"ops"},{"op":"replace","path":"/service_owner","value":"platform"},`+
+			`{"op":"add","path":"/attached_to_client/-","value":{"client_id":"`+globex+`"}}]`)
+	expectStatus(t, w, http.StatusOK)
+	var service models.ServiceBase
+	decode(t, w, &service)
+	if service.ServiceOwner != "platform" || len(service.AttachedToClient) != 2 || service.AttachedToClient[1].ClientID.Hex() != globex {
+		t.Fatalf("unexpected patched service %+v", service)
+	}
+
+	expectProblem(t, patch(api, "/api/services/"+id, controllers.JSONPatchContentType, `[{"op":"test","path":"/service_owner","value":"ops"}]`), http.StatusConflict, controllers.CodeConflict)
+	expectProblem(t, patch(api, "/api/services/"+id, controllers.JSONPatchContentType, `[{"op":"remove","path":"/nope"}]`), http.StatusUnprocessableEntity, controllers.CodeInvalidPatch)
+	expectProblem(t, patch(api, "/api/services/"+id, controllers.JSONPatchContentType, `{"op":"remove"}`), http.StatusBadRequest, controllers.CodeInvalidRequest)
+	expectProblem(t, patch(api, "/api/services/"+id, controllers.JSONPatchContentType, `[{"op":"add","path":"/attached_to_client/-","value":{"client_id":"000000000000000000000000"}}]`), http.StatusUnprocessableEntity, controllers.CodeUnknownReference)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkClientReferences removes repeated ids from the attached_to_client list of a service or contact and checks
+// that the clients exist, references already stored in current are kept as they are. It writes a 422 listing the
+// unknown ids and returns false when a response was written.
+func (h *Handler) checkClientReferences(w http.ResponseWriter, r *http.Request, attached []models.Clients, current []models.Clients) ([]models.Clients, bool) {
+	unique, unknown, err := h.clientReferences(r.Context(), attached, current)
+	if err != nil {
+		writeInternalError(w, r, "Failed to check the attached clients", err)
+		return nil, false
+	}
+
+	if len(unknown) > 0 {
+		renderProblem(w, r, Problem{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    CodeUnknownReference,
+			Message: "attached_to_client references clients that don't exist",
+			Errors:  unknown,
+		})
+		return nil, false
+	}
+
+	return unique, true
+}
+
+// clientReferences removes repeated ids from attached and returns an error for every added reference to a client
+// that doesn't exist
+func (h *Handler) clientReferences(ctx context.Context, attached []models.Clients, current []models.Clients) ([]models.Clients, []FieldError, error) {
+	if len(attached) == 0 {
+		return attached, nil, nil
+	}
+
+	stored := map[primitive.ObjectID]bool{}
+	for _, reference := range current {
+		stored[reference.ClientID] = true
+	}
+
+	var unique []models.Clients
+	var added []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{}
+	for _, reference := range attached {
+		if seen[reference.ClientID] {
+			continue
+		}
+		seen[reference.ClientID] = true
+		unique = append(unique, reference)
+
+		if !stored[reference.ClientID] {
+			added = append(added, reference.ClientID)
+		}
+	}
+
+	if len(added) == 0 {
+		return unique, nil, nil
+	}
+
+	missing, err := h.store.Clients.Missing(ctx, added)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unknown []FieldError
+	for _, id := range missing {
+		unknown = append(unknown, FieldError{
+			Field:   "attached_to_client",
+			Rule:    "exists",
+			Message: "No client found with id: " + id.Hex(),
+		})
+	}
+
+	return unique, unknown, nil
+}
@@ -0,0 +1,51 @@
+package controllers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+const unknownClient = "000000000000000000000000"
+
+func TestUnknownClientReferences(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	w := api.request(http.MethodPost, "/api/services", newService("Hosting", acme, unknownClient, "111111111111111111111111"))
+	expectProblem(t, w, http.StatusUnprocessableEntity, controllers.CodeUnknownReference)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if len(problem.Errors) != 2 || !strings.HasSuffix(problem.Errors[0].Message, unknownClient) || problem.Errors[0].Field != "attached_to_client" {
+		t.Fatalf("unexpected field errors %+v", problem.Errors)
+	}
+
+	// clients in the trash can't be referenced
+	globex := api.create("/api/clients", `{"client_name":"Globex"}`)
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+globex, ""), http.StatusNoContent)
+	expectProblem(t, api.request(http.MethodPost, "/api/contacts", `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example","attached_to_client":[{"client_id":"`+globex+`"}]}`),
+		http.StatusUnprocessableEntity, controllers.CodeUnknownReference)
+
+	contact := api.create("/api/contacts", `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example"}`)
+	w = api.request(http.MethodPut, "/api/contacts/"+contact, `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example","attached_to_client":[{"client_id":"`+unknownClient+`"}]}`, "If-Match", `"1"`)
+	expectProblem(t, w, http.StatusUnprocessableEntity, controllers.CodeUnknownReference)
+}
+
+func TestRepeatedClientReferences(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	id := api.create("/api/services", newService("Hosting", acme, acme))
+
+	w := api.request(http.MethodGet, "/api/services/"+id, "")
+	expectStatus(t, w, http.StatusOK)
+	var service models.ServiceResponse
+	decode(t, w, &service)
+	if len(service.Client) != 1 || service.Client[0].ID != acme {
+		t.Fatalf("unexpected clients %+v", service.Client)
+	}
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pathID parses the id in the path variable name, it writes a 400 and returns false for invalid ids
+func pathID(w http.ResponseWriter, r *http.Request, name string, entity string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)[name])
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid "+entity+" id: "+mux.Vars(r)[name])
+		return id, false
+	}
+	return id, true
+}
+
+// findClient checks that the client in the path exists, it writes a 404 and returns false otherwise
+func (h *Handler) findClient(w http.ResponseWriter, r *http.Request, id primitive.ObjectID) bool {
+	_, err := h.store.Clients.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No client found with id: "+id.Hex())
+		return false
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get client", err)
+		return false
+	}
+
+	return true
+}
+
+// GetClientServices returns a page of the services attached to a client
+// e.g. /api/clients/{id}/services?_start=0&_end=10&_sort=service_name
+func (h *Handler) GetClientServices(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	opts, err := parseListParams(r, serviceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	opts.Filters, err = parseFilters(r.URL.Query(), serviceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	// an unknown client is a 404 rather than an empty page
+	if !h.findClient(w, r, clientID) {
+		return
+	}
+
+	opts.Filters = append(opts.Filters, repository.Filter{Path: "attached_to_client._id", Operator: repository.OpEq, Value: clientID})
+
+	services, total, err := h.store.Services.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get services", err)
+		return
+	}
+
+	setRangeHeaders(w, "services", opts.Start, len(services), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(services)
+}
+
+// AttachClientService attaches a service to a client, attaching it again changes nothing
+func (h *Handler) AttachClientService(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	serviceID, ok := pathID(w, r, "serviceId", "service")
+	if !ok {
+		return
+	}
+
+	if !h.findClient(w, r, clientID) {
+		return
+	}
+
+	// keep the stored document for the audit log
+	current, err := h.store.Services.Find(r.Context(), serviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No service found with id: "+serviceID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get service", err)
+		return
+	}
+
+	service, err := h.store.Services.Attach(r.Context(), serviceID, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No service found with id: "+serviceID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to attach service", err)
+		return
+	}
+
+	if service.Version != current.Version {
+		log.Info("Service ", serviceID.Hex(), " attached to client ", clientID.Hex())
+		h.recordAudit(r, models.AuditUpdate, "services", serviceID, current, service)
+	}
+
+	w.Header().Set("ETag", etag(service.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(service)
+}
+
+// DetachClientService removes a service from a client, the client itself may already be deleted
+func (h *Handler) DetachClientService(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	serviceID, ok := pathID(w, r, "serviceId", "service")
+	if !ok {
+		return
+	}
+
+	// keep the stored document for the audit log
+	current, err := h.store.Services.Find(r.Context(), serviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No service found with id: "+serviceID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get service", err)
+		return
+	}
+
+	service, err := h.store.Services.Detach(r.Context(), serviceID, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Service "+serviceID.Hex()+" is not attached to client "+clientID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to detach service", err)
+		return
+	}
+
+	log.Info("Service ", serviceID.Hex(), " detached from client ", clientID.Hex())
+	h.recordAudit(r, models.AuditUpdate, "services", serviceID, current, service)
+
+	w.Header().Set("ETag", etag(service.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(service)
+}
+
+// GetClientContacts returns a page of the contacts attached to a client
+// e.g. /api/clients/{id}/contacts?_start=0&_end=10&_sort=last_name
+func (h *Handler) GetClientContacts(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	opts, err := parseListParams(r, contactFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	opts.Filters, err = parseFilters(r.URL.Query(), contactFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	// an unknown client is a 404 rather than an empty page
+	if !h.findClient(w, r, clientID) {
+		return
+	}
+
+	opts.Filters = append(opts.Filters, repository.Filter{Path: "attached_to_client._id", Operator: repository.OpEq, Value: clientID})
+
+	contacts, total, err := h.store.Contacts.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get contacts", err)
+		return
+	}
+
+	setRangeHeaders(w, "contacts", opts.Start, len(contacts), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(contacts)
+}
+
+// AttachClientContact attaches a contact to a client, attaching it again changes nothing
+func (h *Handler) AttachClientContact(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	contactID, ok := pathID(w, r, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	if !h.findClient(w, r, clientID) {
+		return
+	}
+
+	// keep the stored document for the audit log
+	current, err := h.store.Contacts.Find(r.Context(), contactID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No contact found with id: "+contactID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get contact", err)
+		return
+	}
+
+	contact, err := h.store.Contacts.Attach(r.Context(), contactID, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No contact found with id: "+contactID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to attach contact", err)
+		return
+	}
+
+	if contact.Version != current.Version {
+		log.Info("Contact ", contactID.Hex(), " attached to client ", clientID.Hex())
+		h.recordAudit(r, models.AuditUpdate, "contacts", contactID, current, contact)
+	}
+
+	w.Header().Set("ETag", etag(contact.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(contact)
+}
+
+// DetachClientContact removes a contact from a client, the client itself may already be deleted
+func (h *Handler) DetachClientContact(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := pathID(w, r, "id", "client")
+	if !ok {
+		return
+	}
+
+	contactID, ok := pathID(w, r, "contactId", "contact")
+	if !ok {
+		return
+	}
+
+	// keep the stored document for the audit log
+	current, err := h.store.Contacts.Find(r.Context(), contactID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No contact found with id: "+contactID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get contact", err)
+		return
+	}
+
+	contact, err := h.store.Contacts.Detach(r.Context(), contactID, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Contact "+contactID.Hex()+" is not attached to client "+clientID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to detach contact", err)
+		return
+	}
+
+	log.Info("Contact ", contactID.Hex(), " detached from client ", clientID.Hex())
+	h.recordAudit(r, models.AuditUpdate, "contacts", contactID, current, contact)
+
+	w.Header().Set("ETag", etag(contact.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(contact)
+}
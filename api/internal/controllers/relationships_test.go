@@ -0,0 +1,90 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func TestAttachAndDetachService(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	service := api.create("/api/services", newService("Hosting"))
+	path := "/api/clients/" + acme + "/services/" + service
+
+	w := api.request(http.MethodPost, path, "")
+	expectStatus(t, w, http.StatusOK)
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf("ETag = %s, want \"2\"", etag)
+	}
+
+	// attaching again changes nothing
+	w = api.request(http.MethodPost, path, "")
+	expectStatus(t, w, http.StatusOK)
+	var attached models.ServiceBase
+	decode(t, w, &attached)
+	if attached.Version != 2 || len(attached.AttachedToClient) != 1 || attached.AttachedToClient[0].ClientID.Hex() != acme {
+		t.Fatalf("unexpected service %+v", attached)
+	}
+
+	w = api.request(http.MethodGet, "/api/clients/"+acme+"/services", "")
+	expectStatus(t, w, http.StatusOK)
+	var services []models.ServiceResponse
+	decode(t, w, &services)
+	if len(services) != 1 || services[0].ID.Hex() != service || w.Header().Get("X-Total-Count") != "1" {
+		t.Fatalf("unexpected services %+v", services)
+	}
+
+	expectStatus(t, api.request(http.MethodDelete, path, ""), http.StatusOK)
+	expectProblem(t, api.request(http.MethodDelete, path, ""), http.StatusNotFound, controllers.CodeNotFound)
+
+	w = api.request(http.MethodGet, "/api/clients/"+acme+"/services", "")
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &services)
+	if len(services) != 0 {
+		t.Fatalf("unexpected services %+v", services)
+	}
+
+	// both sides have to exist to attach
+	expectProblem(t, api.request(http.MethodPost, "/api/clients/"+unknownClient+"/services/"+service, ""), http.StatusNotFound, controllers.CodeNotFound)
+	expectProblem(t, api.request(http.MethodPost, "/api/clients/"+acme+"/services/"+unknownClient, ""), http.StatusNotFound, controllers.CodeNotFound)
+	expectProblem(t, api.request(http.MethodGet, "/api/clients/"+unknownClient+"/services", ""), http.StatusNotFound, controllers.CodeNotFound)
+}
+
+func TestAttachAndDetachContact(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	var contacts []string
+	for _, name := range []string{"Doe", "Roe", "Poe"} {
+		contact := api.create("/api/contacts", `{"first_name":"Jane","last_name":"`+name+`","email":"jane@acme.example"}`)
+		expectStatus(t, api.request(http.MethodPost, "/api/clients/"+acme+"/contacts/"+contact, ""), http.StatusOK)
+		contacts = append(contacts, contact)
+	}
+
+	// the contacts of a client are paginated like every list
+	w := api.request(http.MethodGet, "/api/clients/"+acme+"/contacts?_start=0&_end=2&_sort=last_name&_order=ASC", "")
+	expectStatus(t, w, http.StatusOK)
+	var page []models.ContactResponse
+	decode(t, w, &page)
+	if len(page) != 2 || page[0].LastName != "Doe" || page[1].LastName != "Poe" || w.Header().Get("X-Total-Count") != "3" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	w = api.request(http.MethodDelete, "/api/clients/"+acme+"/contacts/"+contacts[0], "")
+	expectStatus(t, w, http.StatusOK)
+	var detached models.ContactsBase
+	decode(t, w, &detached)
+	if len(detached.AttachedToClient) != 0 {
+		t.Fatalf("unexpected contact %+v", detached)
+	}
+
+	// the detach is audited like any other update of the contact
+	entries := auditLog(t, api, "entity=contacts&id="+contacts[0]+"&action=update")
+	if len(entries) != 2 || entries[0].Changes[0].Field != "attached_to_client" {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/billing"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/money"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/util"
+)
+
+// Report formats, selected with ?format= or the Accept header
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// CSVContentType is the media type of reports rendered as csv
+const CSVContentType = "text/csv"
+
+var (
+	// revenueGroups maps the group_by values of the revenue report to the grouped document path
+	revenueGroups = map[string]string{
+		"client":         repository.RevenueByClient,
+		"service_type":   "service_type",
+		"service_owner":  "service_owner",
+		"service_status": "service_status",
+	}
+
+	// revenueColumns is the header row of the csv revenue report
+	revenueColumns = []string{"group_by", "key", "name", "currency", "services", "unnormalized", "monthly", "annual"}
+)
+
+// parseRates parses the exchange rates of a report, e.g. EUR:11.52,USD:10.61 for 1 EUR = 11.52 and 1 USD = 10.61 of
+// the currency the report is converted to
+func parseRates(value string) (map[string]money.Amount, error) {
+	rates := map[string]money.Amount{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("rate %q must be CURRENCY:RATE", pair)
+		}
+
+		currency := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if !money.IsCurrency(currency) {
+			return nil, fmt.Errorf("unknown currency %q", parts[0])
+		}
+
+		rate, err := money.Parse(strings.TrimSpace(parts[1]))
+		if err != nil || rate.Cmp(money.Zero) <= 0 {
+			return nil, fmt.Errorf("rate of %s must be a positive number", currency)
+		}
+		rates[currency] = rate
+	}
+	return rates, nil
+}
+
+// reportFormat returns the format a report is rendered in, ?format= takes precedence over the Accept header and
+// json is the default
+func reportFormat(r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case FormatJSON, FormatCSV:
+		return format, true
+	case "":
+	default:
+		return format, false
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil && mediaType == CSVContentType {
+			return FormatCSV, true
+		}
+	}
+	return FormatJSON, true
+}
+
+// GetRevenueReport returns the recurring revenue of the services normalized across invoice frequencies to monthly
+// and annual figures, grouped by client, service_type, service_owner or service_status (group_by, client by default).
+// Figures in different currencies are only summed up when they are converted to convert_to with the exchange rates
+// in rates. The other parameters filter the services like on /api/services,
+// e.g. /api/reports/revenue?group_by=service_type&service_status=active&format=csv
+// or /api/reports/revenue?convert_to=SEK&rates=EUR:11.52,USD:10.61
+func (h *Handler) GetRevenueReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	groupBy := query.Get("group_by")
+	if groupBy == "" {
+		groupBy = "client"
+	}
+
+	path, ok := revenueGroups[groupBy]
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "group_by must be one of: client, service_owner, service_status, service_type")
+		return
+	}
+
+	format, ok := reportFormat(r)
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "format must be either json or csv")
+		return
+	}
+
+	if query.Get("q") != "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Reports don't support full text search")
+		return
+	}
+
+	convertTo := strings.ToUpper(query.Get("convert_to"))
+	if convertTo != "" && !money.IsCurrency(convertTo) {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "convert_to must be an ISO 4217 currency code")
+		return
+	}
+
+	var rates map[string]money.Amount
+	if query.Get("rates") != "" {
+		if convertTo == "" {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "rates require convert_to")
+			return
+		}
+
+		var err error
+		if rates, err = parseRates(query.Get("rates")); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid rates: "+err.Error())
+			return
+		}
+	}
+
+	// the remaining parameters are filters on the services
+	for _, param := range []string{"group_by", "format", "convert_to", "rates"} {
+		query.Del(param)
+	}
+	filters, err := parseFilters(query, serviceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	groups, err := h.store.Services.Revenue(r.Context(), path, filters, billing.MonthlyFactors())
+	if err != nil {
+		writeInternalError(w, r, "Failed to compute revenue", err)
+		return
+	}
+
+	report := models.RevenueReport{GroupBy: groupBy, Currency: convertTo, Groups: []models.RevenueGroup{}}
+	if convertTo == "" {
+		// amounts in different currencies can't be summed up without rates
+		currencies := revenueCurrencies(groups)
+		if len(currencies) > 1 {
+			writeProblem(w, r, http.StatusUnprocessableEntity, CodeMixedCurrencies, "Services are billed in "+
+				strings.Join(currencies, ", ")+", convert the report with convert_to and rates")
+			return
+		}
+		if len(currencies) == 1 {
+			report.Currency = currencies[0]
+		}
+	} else {
+		report.Rates = map[string]money.Amount{}
+		for i, group := range groups {
+			if group.Currency == convertTo {
+				continue
+			}
+
+			rate, ok := rates[group.Currency]
+			if !ok {
+				writeProblem(w, r, http.StatusUnprocessableEntity, CodeMixedCurrencies, "No rate converting "+
+					group.Currency+" to "+convertTo+", add it to rates")
+				return
+			}
+			report.Rates[group.Currency] = rate
+			groups[i].Monthly = group.Monthly.Mul(rate)
+			groups[i].Currency = convertTo
+		}
+	}
+
+	// a key billed in several currencies is a single group once converted
+	merged := map[string]int{}
+	for _, group := range groups {
+		i, ok := merged[group.Key]
+		if !ok {
+			merged[group.Key] = len(report.Groups)
+			report.Groups = append(report.Groups, group)
+			continue
+		}
+		report.Groups[i].Services += group.Services
+		report.Groups[i].Unnormalized += group.Unnormalized
+		report.Groups[i].Monthly = report.Groups[i].Monthly.Add(group.Monthly)
+	}
+
+	// the figures are rounded once they are summed up
+	places := money.MinorUnits(report.Currency)
+	for i := range report.Groups {
+		group := &report.Groups[i]
+		if group.Name == "" && groupBy != "client" {
+			group.Name = group.Key
+		}
+		report.Monthly = report.Monthly.Add(group.Monthly)
+		group.Annual = group.Monthly.MulFloat(12).Round(places)
+		group.Monthly = group.Monthly.Round(places)
+	}
+	report.Annual = report.Monthly.MulFloat(12).Round(places)
+	report.Monthly = report.Monthly.Round(places)
+
+	// largest revenue first
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if c := report.Groups[i].Monthly.Cmp(report.Groups[j].Monthly); c != 0 {
+			return c > 0
+		}
+		return report.Groups[i].Key < report.Groups[j].Key
+	})
+
+	if format == FormatCSV {
+		writeRevenueCSV(w, r, report)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeRevenueCSV renders the groups of the revenue report as csv, one row per group
+func writeRevenueCSV(w http.ResponseWriter, r *http.Request, report models.RevenueReport) {
+	w.Header().Set("Content-Type", CSVContentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="revenue-by-`+report.GroupBy+`.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	places := money.MinorUnits(report.Currency)
+	writer := csv.NewWriter(w)
+	writer.Write(revenueColumns)
+	for _, group := range report.Groups {
+		writer.Write([]string{
+			report.GroupBy,
+			group.Key,
+			group.Name,
+			group.Currency,
+			strconv.Itoa(group.Services),
+			strconv.Itoa(group.Unnormalized),
+			group.Monthly.StringFixed(places),
+			group.Annual.StringFixed(places),
+		})
+	}
+	writer.Flush()
+
+	// the status is already sent, the error can only be logged
+	if err := writer.Error(); err != nil {
+		log.WithField("request_id", util.RequestIDFromContext(r.Context())).Error("Failed to write revenue report: ", err)
+	}
+}
+
+// revenueCurrencies returns the sorted currencies of the revenue groups
+func revenueCurrencies(groups []models.RevenueGroup) []string {
+	seen := map[string]bool{}
+	var currencies []string
+	for _, group := range groups {
+		if !seen[group.Currency] {
+			seen[group.Currency] = true
+			currencies = append(currencies, group.Currency)
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
@@ -0,0 +1,77 @@
+package controllers_test
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func revenueReport(t *testing.T, api *testAPI, query string) models.RevenueReport {
+	t.Helper()
+
+	w := api.request(http.MethodGet, "/api/reports/revenue?"+query, "")
+	expectStatus(t, w, http.StatusOK)
+	var report models.RevenueReport
+	decode(t, w, &report)
+	return report
+}
+
+func TestRevenueReport(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	globex := api.create("/api/clients", `{"client_name":"Globex"}`)
+	api.create("/api/services", newService("Hosting", acme))
+	api.create("/api/services", strings.Replace(newService("Support", globex), `"Monthly"`, `"Yearly"`, 1))
+	api.create("/api/services", strings.Replace(newService("Backups", acme), `"hosting"`, `"backup"`, 1))
+
+	// a yearly amount is a twelfth per month
+	report := revenueReport(t, api, "")
+	if report.GroupBy != "client" || report.Currency != "SEK" || len(report.Groups) != 2 || report.Monthly.String() != "3125" || report.Annual.String() != "37500" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if first := report.Groups[0]; first.Key != acme || first.Name != "Acme" || first.Services != 2 || first.Monthly.String() != "3000" {
+		t.Fatalf("unexpected first group %+v", first)
+	}
+
+	report = revenueReport(t, api, "group_by=service_type&service_type=backup")
+	if len(report.Groups) != 1 || report.Groups[0].Key != "backup" || report.Groups[0].Annual.String() != "18000" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	w := api.request(http.MethodGet, "/api/reports/revenue?group_by=service_type", "", "Accept", "text/csv")
+	expectStatus(t, w, http.StatusOK)
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "group_by" || rows[1][1] != "hosting" || rows[1][6] != "1625.00" {
+		t.Fatalf("unexpected csv %v", rows)
+	}
+
+	expectProblem(t, api.request(http.MethodGet, "/api/reports/revenue?group_by=nope", ""), http.StatusBadRequest, controllers.CodeInvalidQuery)
+	expectStatus(t, api.as(auth.RoleEditor).request(http.MethodGet, "/api/reports/revenue", ""), http.StatusForbidden)
+}
+
+func TestRevenueReportInSeveralCurrencies(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	api.create("/api/services", newService("Hosting", acme))
+	api.create("/api/services", strings.Replace(strings.Replace(newService("Support", acme), `"SEK"`, `"EUR"`, 1), `"1500.00"`, `"100"`, 1))
+
+	expectProblem(t, api.request(http.MethodGet, "/api/reports/revenue", ""), http.StatusUnprocessableEntity, controllers.CodeMixedCurrencies)
+	expectProblem(t, api.request(http.MethodGet, "/api/reports/revenue?convert_to=SEK", ""), http.StatusUnprocessableEntity, controllers.CodeMixedCurrencies)
+	expectProblem(t, api.request(http.MethodGet, "/api/reports/revenue?rates=EUR:11.5", ""), http.StatusBadRequest, controllers.CodeInvalidQuery)
+
+	// the converted figures of a client are a single group
+	report := revenueReport(t, api, "convert_to=SEK&rates=EUR:11.5")
+	if len(report.Groups) != 1 || report.Groups[0].Services != 2 || report.Monthly.String() != "2650" || report.Rates["EUR"].String() != "11.5" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// Search runs a full text search across clients, services and contacts and returns typed hits, a q without any
+// whole word in the text indexes finds the documents containing every fragment of q instead. The hits of each
+// collection are ranked on their own, as the scores of different collections aren't comparable, and the rankings
+// are interleaved, so the best hit of every collection comes first.
+// e.g. /api/search?q=acme&type=clients&type=contacts&_start=0&_end=10
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, nil)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	if opts.Query == "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Missing search query parameter q")
+		return
+	}
+
+	// optionally restrict the search to some entity types
+	types := map[string]bool{}
+	for _, t := range r.URL.Query()["type"] {
+		types[t] = true
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+
+	sources := []struct {
+		Type     string
+		Searcher repository.Searcher
+	}{
+		{"clients", h.store.Clients},
+		{"services", h.store.Services},
+		{"contacts", h.store.Contacts},
+	}
+
+	var rankings [][]models.SearchHit
+	total := 0
+	for _, source := range sources {
+		if len(types) > 0 && !types[source.Type] {
+			continue
+		}
+
+		// only search the resources the caller may read
+		if !identity.Can(auth.ReadPermission(source.Type)) {
+			continue
+		}
+
+		// each collection can at most contribute the documents up to the end of the requested page
+		sourceHits, count, err := source.Searcher.Search(r.Context(), opts.Query, opts.End)
+		if err != nil {
+			writeInternalError(w, r, "Failed to search "+source.Type, err)
+			return
+		}
+
+		rankings = append(rankings, sourceHits)
+		total += count
+	}
+
+	hits := []models.SearchHit{}
+	for rank := 0; len(rankings) > 0; rank++ {
+		remaining := rankings[:0]
+		for _, ranking := range rankings {
+			if rank < len(ranking) {
+				hits = append(hits, ranking[rank])
+				remaining = append(remaining, ranking)
+			}
+		}
+		rankings = remaining
+	}
+
+	start, end := opts.Start, len(hits)
+	if start > end {
+		start = end
+	}
+	if opts.End > 0 && opts.End < end {
+		end = opts.End
+	}
+	hits = hits[start:end]
+
+	setRangeHeaders(w, "search", opts.Start, len(hits), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hits)
+}
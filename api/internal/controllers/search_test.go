@@ -0,0 +1,77 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func search(t *testing.T, api *testAPI, query string) []models.SearchHit {
+	t.Helper()
+
+	w := api.request(http.MethodGet, "/api/search?"+query, "")
+	expectStatus(t, w, http.StatusOK)
+	var hits []models.SearchHit
+	decode(t, w, &hits)
+	return hits
+}
+
+func TestSearchMatchesFragments(t *testing.T) {
+	api := newTestAPI(t)
+
+	acme := api.create("/api/clients", `{"client_name":"Acme Corporation"}`)
+	api.create("/api/clients", `{"client_name":"Globex"}`)
+	api.create("/api/services", newService("Backups", acme))
+
+	// whole words are found in the text index
+	hits := search(t, api, "q=ACME")
+	if len(hits) != 1 || hits[0].ID.Hex() != acme || hits[0].Type != "clients" {
+		t.Fatalf("unexpected hits for a word %+v", hits)
+	}
+
+	// a query without any indexed word is searched as fragments of words
+	hits = search(t, api, "q=ACM")
+	if len(hits) != 1 || hits[0].ID.Hex() != acme {
+		t.Fatalf("unexpected hits for a fragment %+v", hits)
+	}
+
+	// every fragment must match
+	if hits := search(t, api, "q=acm+orp"); len(hits) != 1 {
+		t.Fatalf("unexpected hits for two fragments %+v", hits)
+	}
+	if hits := search(t, api, "q=acm+lobe"); len(hits) != 0 {
+		t.Fatalf("unexpected hits for fragments of different documents %+v", hits)
+	}
+
+	// the fragments are only searched when no word was found
+	if hits := search(t, api, "q=acm+globex"); len(hits) != 1 || hits[0].Title != "Globex" {
+		t.Fatalf("unexpected hits for a word and a fragment %+v", hits)
+	}
+
+	// regular expression syntax is matched literally
+	if hits := search(t, api, "q=.%2A"); len(hits) != 0 {
+		t.Fatalf("unexpected hits for a pattern %+v", hits)
+	}
+}
+
+func TestSearchRanksEachCollection(t *testing.T) {
+	api := newTestAPI(t)
+
+	api.create("/api/clients", `{"client_name":"Nova"}`)
+	best := api.create("/api/clients", `{"client_name":"Nova Labs"}`)
+	service := api.create("/api/services", newService("Nova backups"))
+
+	hits := search(t, api, "q=nova+labs")
+	if len(hits) != 3 {
+		t.Fatalf("unexpected hits %+v", hits)
+	}
+	// the best hit of every collection comes before the second hit of any collection
+	if hits[0].ID.Hex() != best || hits[1].ID.Hex() != service || hits[2].Title != "Nova" {
+		t.Fatalf("unexpected ranking %+v", hits)
+	}
+
+	if hits := search(t, api, "q=nova&type=services"); len(hits) != 1 || hits[0].ID.Hex() != service {
+		t.Fatalf("unexpected hits for services %+v", hits)
+	}
+}
@@ -1,116 +1,45 @@
 package controllers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 	"time"
 
-	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
-	"github.com/terrpan/clientdb/internal/util"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
 )
 
 var (
-	servicesCollection *mongo.Collection = util.GetCollection(util.DB, "services")
+	serviceFilterFields = newFilterFields(models.ServiceBase{})
 )
 
-type ServiceBase struct {
-	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ServiceName        string             `json:"service_name" bson:"service_name" validate:"required"`
-	ServiceType        string             `json:"service_type" bson:"service_type" validate:"required"`
-	ServiceOwner       string             `json:"service_owner" bson:"service_owner" validate:"required"`
-	ServiceDescription string             `json:"service_description" bson:"service_description"`
-	ServiceStatus      string             `json:"service_status" bson:"service_status" validate:"required"`
-	AttachedToClient   []Clients          `json:"attached_to_client" bson:"attached_to_client"`
-	InvoiceFrequency   string             `json:"invoice_frequency" bson:"invoice_frequency"`
-	InvoiceAmount      float64            `json:"invoice_amount" bson:"invoice_amount"`
-	ManagementFee      float64            `json:"management_fee" bson:"management_fee"`
-	CreatedOn          time.Time          `json:"created_on" bson:"created_on,omitempty"`
-	ModifiedOn         time.Time          `json:"modified_on" bson:"modified_on,omitempty"`
-}
-
-type ServiceResponse struct {
-	ID                 primitive.ObjectID      `json:"id" bson:"_id,omitempty"`
-	ServiceName        string                  `json:"service_name" bson:"service_name"`
-	ServiceType        string                  `json:"service_type" bson:"service_type"`
-	ServiceOwner       string                  `json:"service_owner" bson:"service_owner"`
-	ServiceDescription string                  `json:"service_description" bson:"service_description"`
-	ServiceStatus      string                  `json:"service_status" bson:"service_status"`
-	Client             []ServiceClientResponse `json:"client" bson:"client"`
-	InvoiceFrequency   string                  `json:"invoice_frequency" bson:"invoice_frequency"`
-	InvoiceAmount      float64                 `json:"invoice_amount" bson:"invoice_amount"`
-	ManagementFee      float64                 `json:"management_fee" bson:"management_fee"`
-	CreatedOn          time.Time               `json:"created_on" bson:"created_on,omitempty"`
-	ModifiedOn         time.Time               `json:"modified_on" bson:"modified_on,omitempty"`
-}
-
-type ServiceClientResponse struct {
-	ID         string `json:"id" bson:"_id,omitempty"`
-	ClientName string `json:"client_name" bson:"client_name"`
-}
-
-type Clients struct {
-	ClientID primitive.ObjectID `json:"client_id" bson:"_id"`
-}
+// func GetServices returns a page of registered services from db
+func (h *Handler) GetServices(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, serviceFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
 
-// func GetServices returns all registered services from db
-func GetServices(w http.ResponseWriter, r *http.Request) {
-	services := []ServiceResponse{}
-
-	// aggregate the services with the clients collection to get the client name and id for each service using mongodb $lookup and $project
-	pipeline := []bson.M{
-		{
-			"$lookup": bson.M{
-				"from":         "clients",
-				"localField":   "attached_to_client._id",
-				"foreignField": "_id",
-				"as":           "client",
-			},
-		},
-		{
-			"$project": bson.M{
-				"_id":                 1,
-				"service_name":        1,
-				"service_type":        1,
-				"service_owner":       1,
-				"service_description": 1,
-				"service_status":      1,
-				"invoice_frequency":   1,
-				"invoice_amount":      1,
-				"management_fee":      1,
-				"created_on":          1,
-				"modified_on":         1,
-				"client._id":          1,
-				"client.client_name":  1,
-			},
-		},
-	}
-
-	// execute the pipeline
-	cursor, err := servicesCollection.Aggregate(context.TODO(), pipeline)
+	// filters are matched before the lookup so only the base documents are filtered
+	opts.Filters, err = parseFilters(r.URL.Query(), serviceFilterFields)
 	if err != nil {
-		response := "Failed to get services"
-		log.Error(response + err.Error())
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(response))
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
 		return
 	}
 
-	// iterate through the cursor and add the results to the services slice
-	for cursor.Next(context.TODO()) {
-		var result ServiceResponse
-		cursor.Decode(&result)
-		services = append(services, result)
+	// get the page of services with the client name and id for each service
+	services, total, err := h.store.Services.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get services", err)
+		return
 	}
 
-	// Count documents in array and return x-total-count header
-	w.Header().Add("X-Total-Count", (strconv.Itoa(len(services))))
+	// return the total number of services and the range of this page
+	setRangeHeaders(w, "services", opts.Start, len(services), total)
 
 	// Return the slice
 	w.WriteHeader(http.StatusOK)
@@ -119,67 +48,27 @@ func GetServices(w http.ResponseWriter, r *http.Request) {
 }
 
 // func GetServiceById returns a single service from db
-func GetServiceById(w http.ResponseWriter, r *http.Request) {
-	var service ServiceResponse
+func (h *Handler) GetServiceById(w http.ResponseWriter, r *http.Request) {
 	// get the id from the url
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
-
-	// aggregate the services collection with the clients collection to get the client name and client id for each contact
-	// using $lookup and $project
-	pipeline := []bson.M{
-		{
-			"$match": bson.M{"_id": id},
-		},
-		{
-			"$lookup": bson.M{
-				"from":         "clients",
-				"localField":   "attached_to_client._id",
-				"foreignField": "_id",
-				"as":           "client",
-			},
-		},
-		{
-			"$project": bson.M{
-				"_id":                 1,
-				"service_name":        1,
-				"service_type":        1,
-				"service_owner":       1,
-				"service_description": 1,
-				"service_status":      1,
-				"invoice_frequency":   1,
-				"invoice_amount":      1,
-				"management_fee":      1,
-				"created_on":          1,
-				"modified_on":         1,
-				"client._id":          1,
-				"client.client_name":  1,
-			},
-		},
-	}
-
-	// execute the pipeline
-	cursor, err := servicesCollection.Aggregate(context.TODO(), pipeline)
-	if err != nil {
-		response := "Failed to get service"
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(response))
+	id, ok := pathID(w, r, "id", "service")
+	if !ok {
 		return
 	}
 
-	// make sure cursor is not empty
-	if !cursor.Next(context.TODO()) {
-		response := "Service not found"
-		log.Error(response)
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(response))
+	// get the service with the client name and client id
+	service, err := h.store.Services.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Service not found")
 		return
 	}
 
-	// Decode the document into the client struct
-	err = cursor.Decode(&service)
 	if err != nil {
-		log.Error("failed to decode cursor", err.Error())
+		writeInternalError(w, r, "Failed to get service", err)
+		return
+	}
+
+	// answer with 304 when the caller already has this version
+	if notModified(w, r, service.Version) {
 		return
 	}
 
@@ -189,42 +78,47 @@ func GetServiceById(w http.ResponseWriter, r *http.Request) {
 }
 
 // func AddService adds a new service to the db
-func AddService(w http.ResponseWriter, r *http.Request) {
-	var service ServiceBase
+func (h *Handler) AddService(w http.ResponseWriter, r *http.Request) {
+	var service models.ServiceBase
 
 	// validate the request body
 	if err := json.NewDecoder(r.Body).Decode(&service); err != nil {
-		response := "Invalid request payload: "
-		log.Error(response, err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
 		return
 	}
 
+	// new services start their lifecycle as proposed unless they are registered in another status
+	if service.ServiceStatus == "" {
+		service.ServiceStatus = models.StatusProposed
+	}
+
 	// validate the body to ensure all required fields are present
 	if validationErr := validate.Struct(service); validationErr != nil {
-		response := "Body missing required fields: " + validationErr.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// every attached client has to exist
+	attached, ok := h.checkClientReferences(w, r, service.AttachedToClient, nil)
+	if !ok {
+		return
+	}
+	service.AttachedToClient = attached
+
+	// only the roles granted by the access policy may set protected fields
+	if !authorizeFields(w, r, "services", newServiceFields(service), service) {
 		return
 	}
 
 	// Don't allow duplicate service names
-	count, err := servicesCollection.CountDocuments(context.TODO(), bson.M{"service_name": service.ServiceName})
+	exists, err := h.store.Services.NameExists(r.Context(), service.ServiceName)
 	if err != nil {
-		response := "Failed to check if service exists"
-		log.Error(response, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to check if service exists", err)
 		return
 	}
 
-	if count > 0 {
-		response := "Service already exists"
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+	if exists {
+		writeProblem(w, r, http.StatusBadRequest, CodeAlreadyExists, "Service already exists")
 		return
 	}
 
@@ -232,127 +126,288 @@ func AddService(w http.ResponseWriter, r *http.Request) {
 	service.CreatedOn = time.Now()
 	service.ModifiedOn = time.Now()
 
+	// the initial status counts as the first transition
+	identity, _ := auth.IdentityFromContext(r.Context())
+	service.StatusChangedOn, service.StatusChangedBy = service.CreatedOn, identity.Subject
+
 	// insert the service into the collection
-	result, err := servicesCollection.InsertOne(context.TODO(), service)
+	id, err := h.store.Services.Insert(r.Context(), service)
 	if err != nil {
-		response := "Failed to insert service: "
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to insert service", err)
 		return
 	}
 
-	log.Info("Service created ", result.InsertedID.(primitive.ObjectID).Hex())
+	service.ID, service.Version = id, 1
+
+	log.Info("Service created ", id.Hex())
+	h.recordAudit(r, models.AuditCreate, "services", id, nil, service)
 
 	// return the service
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(result.InsertedID)
+	json.NewEncoder(w).Encode(id)
 }
 
-// func UpdateService updates an existing service
-func UpdateService(w http.ResponseWriter, r *http.Request) {
-	var service ServiceBase
+// func UpdateService replaces an existing service (PUT)
+func (h *Handler) UpdateService(w http.ResponseWriter, r *http.Request) {
+	var service models.ServiceBase
 	// get the id from the url
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	id, ok := pathID(w, r, "id", "service")
+	if !ok {
+		return
+	}
 
 	// validate the request body
 	if err := json.NewDecoder(r.Body).Decode(&service); err != nil {
-		response := "Invalid request payload: " + err.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
 		return
 	}
 
 	// validate the body to ensure all required fields are present
 	if validationErr := validate.Struct(service); validationErr != nil {
-		response := "Body missing required fields: " + validationErr.Error()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// load the stored document for the field permissions and the audit log
+	current, err := h.store.Services.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Service does not exist, id: "+id.Hex())
 		return
 	}
 
-	// verify that the id exists in the collection
-	count, err := servicesCollection.CountDocuments(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		response := "Failed to check if service id exists"
-		log.Error(response, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to get service", err)
 		return
 	}
 
-	if count == 0 {
-		response := "Service does not exist, id: " + id.Hex()
-		log.Error(response)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+	// the caller has to prove it saw the current version, a concurrent change fails with 412
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	// a status change has to follow the service lifecycle
+	if !checkTransition(w, r, current, &service) {
+		return
+	}
+
+	// every newly attached client has to exist
+	attached, ok := h.checkClientReferences(w, r, service.AttachedToClient, current.AttachedToClient)
+	if !ok {
+		return
+	}
+	service.AttachedToClient = attached
+
+	// only the roles granted by the access policy may change protected fields
+	if !authorizeFields(w, r, "services", current, service) {
 		return
 	}
 
 	// bump the timestamp
 	service.ModifiedOn = time.Now()
 
-	// update the service in the collection
-	result, err := servicesCollection.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": service})
-	if err != nil {
-		response := "Failed to update service: " + id.Hex()
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+	// PUT replaces the whole document, only the creation time is kept
+	service.CreatedOn = current.CreatedOn
+
+	// replace the service and retrieve the new document
+	updatedService, err := h.store.Services.Replace(r.Context(), id, current.Version, service)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
 		return
 	}
 
-	log.Info("Client updated, id: ", id.Hex())
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Service does not exist, id: "+id.Hex())
+		return
+	}
 
-	var updatedService ServiceBase
-	if result.MatchedCount == 1 {
-		err := servicesCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&updatedService)
-		if err != nil {
-			response := "Failed to retrieve updated service"
-			log.Error(response, err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(response)
-			return
-		}
+	if err != nil {
+		writeInternalError(w, r, "Failed to update service: "+id.Hex(), err)
+		return
 	}
 
+	log.Info("Service updated, id: ", id.Hex())
+	h.recordAudit(r, models.AuditUpdate, "services", id, current, updatedService)
+
 	// return the service
+	w.Header().Set("ETag", etag(updatedService.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updatedService)
 }
 
+// PatchService applies a JSON merge patch or JSON patch to a service and only updates the fields it changes
+func (h *Handler) PatchService(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "service")
+	if !ok {
+		return
+	}
+
+	current, err := h.store.Services.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Service does not exist, id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get service", err)
+		return
+	}
+
+	// the caller has to prove it saw the current version, a concurrent change fails with 412
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	var service models.ServiceBase
+	if !applyPatch(w, r, current, &service) {
+		return
+	}
+
+	// the id, the timestamps and the version are maintained by the API and can't be patched
+	service.ID, service.CreatedOn, service.ModifiedOn, service.Version = current.ID, current.CreatedOn, current.ModifiedOn, current.Version
+
+	// the patched document has to be valid as a whole
+	if validationErr := validate.Struct(service); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	// a status change has to follow the service lifecycle
+	if !checkTransition(w, r, current, &service) {
+		return
+	}
+
+	// every newly attached client has to exist
+	attached, ok := h.checkClientReferences(w, r, service.AttachedToClient, current.AttachedToClient)
+	if !ok {
+		return
+	}
+	service.AttachedToClient = attached
+
+	// only the roles granted by the access policy may change protected fields
+	if !authorizeFields(w, r, "services", current, service) {
+		return
+	}
+
+	changes, err := patchChanges(current, service)
+	if err != nil {
+		writeInternalError(w, r, "Failed to compute the changed fields", err)
+		return
+	}
+
+	// nothing to write, e.g. the patch sets the current values
+	if len(changes.Set) == 0 && len(changes.Unset) == 0 {
+		w.Header().Set("ETag", etag(current.Version))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+	changes.Set["modified_on"] = time.Now()
+
+	patched, err := h.store.Services.Patch(r.Context(), id, current.Version, changes)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Service does not exist, id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to patch service: "+id.Hex(), err)
+		return
+	}
+
+	log.Info("Service patched, id: ", id.Hex())
+	h.recordAudit(r, models.AuditUpdate, "services", id, current, patched)
+
+	w.Header().Set("ETag", etag(patched.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(patched)
+}
+
 // func DeleteService removes a registered service in the db
-func DeleteService(w http.ResponseWriter, r *http.Request) {
-	var service ServiceBase
+func (h *Handler) DeleteService(w http.ResponseWriter, r *http.Request) {
 	// get the id from the url
-	id, _ := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
-
-	// find the service in the collection
-	err := servicesCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&service)
+	id, ok := pathID(w, r, "id", "service")
+	if !ok {
+		return
+	}
 	idString := id.Hex()
+
+	// keep the stored document for the audit log
+	current, err := h.store.Services.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Failed to find service: "+idString)
+		return
+	}
+
 	if err != nil {
-		response := "Failed to find service: " + idString
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to get service: "+idString, err)
+		return
+	}
+
+	// deleting is only conditional when the caller sends If-Match
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
+
+	// move the service to the trash, it can be restored until it is purged
+	identity, _ := auth.IdentityFromContext(r.Context())
+	err = h.store.Services.Delete(r.Context(), id, current.Version, identity.Subject)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "Failed to find service: "+idString)
 		return
 	}
 
-	// delete the service from the collection
-	_, err = servicesCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
 	if err != nil {
-		response := "Failed to delete service: " + idString
-		log.Error(response + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeInternalError(w, r, "Failed to delete service: "+idString, err)
 		return
 	}
 
 	// return the service
-	response := "Client deleted, id: " + idString
+	response := "Service deleted, id: " + idString
 	log.Info(response)
+	h.recordAudit(r, models.AuditDelete, "services", id, current, nil)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// RestoreService takes a deleted service out of the trash
+func (h *Handler) RestoreService(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "service")
+	if !ok {
+		return
+	}
+
+	restored, err := h.store.Services.Restore(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No deleted service found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to restore service: "+id.Hex(), err)
+		return
+	}
+
+	log.Info("Service restored, id: ", id.Hex())
+	h.recordAudit(r, models.AuditRestore, "services", id, nil, restored)
+
+	w.Header().Set("ETag", etag(restored.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(restored)
+}
+
+// newServiceFields returns the values a new service is checked against by the field permissions. A service needs a
+// currency, so choosing it is allowed to every role that creates services and only changing it later requires
+// billing:write.
+func newServiceFields(service models.ServiceBase) models.ServiceBase {
+	return models.ServiceBase{Currency: service.Currency}
+}
@@ -0,0 +1,58 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+// newService returns a valid service document attached to the clients
+func newService(name string, clientIDs ...string) string {
+	attached := ""
+	for i, id := range clientIDs {
+		if i > 0 {
+			attached += ","
+		}
+		attached += `{"client_id":"` + id + `"}`
+	}
+	return `{"service_name":"` + name + `","service_type":"hosting","service_owner":"ops","service_status":"active",` +
+		`"currency":"SEK","invoice_amount":"1500.00","invoice_frequency":"Monthly","attached_to_client":[` + attached + `]}`
+}
+
+func TestServiceCRUD(t *testing.T) {
+	api := newTestAPI(t)
+
+	clientID := api.create("/api/clients", `{"client_name":"Acme"}`)
+	id := api.create("/api/services", newService("Hosting", clientID))
+
+	w := api.request(http.MethodGet, "/api/services/"+id, "")
+	expectStatus(t, w, http.StatusOK)
+	var service models.ServiceResponse
+	decode(t, w, &service)
+	if service.ServiceName != "Hosting" || service.InvoiceAmount.String() != "1500" || len(service.Client) != 1 || service.Client[0].ClientName != "Acme" {
+		t.Fatalf("unexpected service %+v", service)
+	}
+
+	w = api.request(http.MethodPut, "/api/services/"+id, newService("Managed hosting", clientID), "If-Match", w.Header().Get("ETag"))
+	expectStatus(t, w, http.StatusOK)
+
+	w = api.request(http.MethodGet, "/api/clients/"+clientID, "")
+	expectStatus(t, w, http.StatusOK)
+	var client models.ClientResponse
+	decode(t, w, &client)
+	if len(client.MangedServices) != 1 || client.MangedServices[0].ServiceName != "Managed hosting" {
+		t.Fatalf("unexpected managed services %+v", client.MangedServices)
+	}
+
+	expectStatus(t, api.request(http.MethodDelete, "/api/services/"+id, ""), http.StatusOK)
+	expectProblem(t, api.request(http.MethodGet, "/api/services/"+id, ""), http.StatusNotFound, controllers.CodeNotFound)
+}
+
+func TestAddServiceValidation(t *testing.T) {
+	api := newTestAPI(t)
+
+	expectProblem(t, api.request(http.MethodPost, "/api/services", `{"service_name":"Hosting"}`), http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectProblem(t, api.request(http.MethodPost, "/api/services", newService("Hosting", "000000000000000000000000")), http.StatusUnprocessableEntity, controllers.CodeUnknownReference)
+}
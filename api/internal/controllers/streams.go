@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errStreamsClosed is the cause of the cancelled context of a stream closed by Streams.Close
+var errStreamsClosed = errors.New("server is shutting down")
+
+// Streams tracks the event feeds that are open. A feed never ends on its own and a WebSocket isn't seen by the
+// shutdown of the server once it is hijacked, so the feeds are closed when the shutdown starts and the shutdown
+// waits for them before the database is disconnected.
+type Streams struct {
+	mu      sync.Mutex
+	streams map[*stream]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// stream is an open event feed
+type stream struct {
+	cancel context.CancelCauseFunc
+}
+
+// NewStreams returns an empty Streams
+func NewStreams() *Streams {
+	return &Streams{streams: map[*stream]struct{}{}}
+}
+
+// open tracks a stream served with ctx, the stream runs with the returned context and calls done once it ended. It
+// returns false once the streams are closed.
+func (s *Streams) open(ctx context.Context) (context.Context, func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ctx, nil, false
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	opened := &stream{cancel: cancel}
+	s.streams[opened] = struct{}{}
+	s.wg.Add(1)
+
+	done := func() {
+		s.mu.Lock()
+		delete(s.streams, opened)
+		s.mu.Unlock()
+		cancel(nil)
+		s.wg.Done()
+	}
+	return ctx, done, true
+}
+
+// Close cancels every open stream and refuses new ones, it is meant to be registered with
+// http.Server.RegisterOnShutdown
+func (s *Streams) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for opened := range s.streams {
+		opened.cancel(errStreamsClosed)
+	}
+}
+
+// Wait waits until the open streams ended or ctx is done
+func (s *Streams) Wait(ctx context.Context) error {
+	ended := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(ended)
+	}()
+
+	select {
+	case <-ended:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startStream prepares w for a response that is written as it is produced and returns its controller. A writer
+// that can't be flushed can't stream and fails the request. A writer without deadlines, e.g. a ResponseRecorder,
+// keeps the write timeout of the server, which ends the stream early.
+func startStream(w http.ResponseWriter, logger *log.Entry, timeout time.Duration) (*http.ResponseController, error) {
+	controller := http.NewResponseController(w)
+	err := controller.SetWriteDeadline(time.Now().Add(timeout))
+	if errors.Is(err, http.ErrNotSupported) {
+		logger.Warn("The response writer doesn't support write deadlines, the stream ends at the write timeout of the server")
+		err = nil
+	}
+	return controller, err
+}
+
+// flushStream sends what was written to the client and gives it timeout to read what is written next
+func flushStream(controller *http.ResponseController, timeout time.Duration) error {
+	if err := controller.SetWriteDeadline(time.Now().Add(timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return controller.Flush()
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// checkTransition enforces the service lifecycle when next changes the status of current and records who moved
+// the status and when on next. It writes a 409 and returns false for transitions the lifecycle doesn't allow.
+func checkTransition(w http.ResponseWriter, r *http.Request, current models.ServiceBase, next *models.ServiceBase) bool {
+	if next.ServiceStatus == current.ServiceStatus {
+		next.StatusChangedOn, next.StatusChangedBy = current.StatusChangedOn, current.StatusChangedBy
+		return true
+	}
+
+	if !models.CanTransition(current.ServiceStatus, next.ServiceStatus) {
+		message := "Service status " + current.ServiceStatus + " is final"
+		if !models.IsServiceStatus(current.ServiceStatus) {
+			message = "Service status " + current.ServiceStatus + " is not a defined status, it has to be migrated first"
+		} else if allowed := models.NextServiceStatuses(current.ServiceStatus); len(allowed) > 0 {
+			message = "Service can't move from " + current.ServiceStatus + " to " + next.ServiceStatus +
+				", allowed: " + strings.Join(allowed, ", ")
+		}
+		writeProblem(w, r, http.StatusConflict, CodeInvalidTransition, message)
+		return false
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	next.StatusChangedOn, next.StatusChangedBy = time.Now(), identity.Subject
+	return true
+}
+
+// TransitionService moves a service to another status of its lifecycle
+// e.g. POST /api/services/{id}/transitions {"to": "active"}
+func (h *Handler) TransitionService(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "service")
+	if !ok {
+		return
+	}
+
+	var transition models.ServiceTransition
+	if err := json.NewDecoder(r.Body).Decode(&transition); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if validationErr := validate.Struct(transition); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	current, err := h.store.Services.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No service found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get service", err)
+		return
+	}
+
+	// the transition is only conditional when the caller sends If-Match
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
+
+	if transition.To == current.ServiceStatus {
+		writeProblem(w, r, http.StatusConflict, CodeInvalidTransition, "Service is already "+current.ServiceStatus)
+		return
+	}
+
+	next := current
+	next.ServiceStatus = transition.To
+	if !checkTransition(w, r, current, &next) {
+		return
+	}
+
+	changes := repository.Changes{Set: map[string]interface{}{
+		"service_status":    next.ServiceStatus,
+		"status_changed_on": next.StatusChangedOn,
+		"status_changed_by": next.StatusChangedBy,
+		"modified_on":       time.Now(),
+	}}
+
+	// the status only moves if nobody changed the service since it was read
+	service, err := h.store.Services.Patch(r.Context(), id, current.Version, changes)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No service found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to change the service status", err)
+		return
+	}
+
+	log.Info("Service ", id.Hex(), " moved from ", current.ServiceStatus, " to ", service.ServiceStatus)
+	h.recordAudit(r, models.AuditUpdate, "services", id, current, service)
+
+	w.Header().Set("ETag", etag(service.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(service)
+}
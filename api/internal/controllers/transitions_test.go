@@ -0,0 +1,68 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func TestTransitionService(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/services", strings.Replace(newService("Hosting"), `"active"`, `"proposed"`, 1))
+	path := "/api/services/" + id + "/transitions"
+
+	expectProblem(t, api.request(http.MethodPost, path, `{"to":"active"}`), http.StatusConflict, controllers.CodeInvalidTransition)
+	expectProblem(t, api.request(http.MethodPost, path, `{"to":"proposed"}`), http.StatusConflict, controllers.CodeInvalidTransition)
+	expectProblem(t, api.request(http.MethodPost, path, `{"to":"Active"}`), http.StatusBadRequest, controllers.CodeValidationFailed)
+
+	w := api.request(http.MethodPost, path, `{"to":"onboarding"}`)
+	expectStatus(t, w, http.StatusOK)
+	var service models.ServiceBase
+	decode(t, w, &service)
+	if service.ServiceStatus != models.StatusOnboarding || service.StatusChangedBy != auth.RoleAdmin || service.StatusChangedOn.IsZero() {
+		t.Fatalf("unexpected service %+v", service)
+	}
+
+	// a replaced service has to follow the lifecycle as well
+	body := strings.Replace(newService("Hosting"), `"active"`, `"suspended"`, 1)
+	expectProblem(t, api.request(http.MethodPut, "/api/services/"+id, body, "If-Match", w.Header().Get("ETag")), http.StatusConflict, controllers.CodeInvalidTransition)
+
+	w = api.request(http.MethodPut, "/api/services/"+id, newService("Hosting"), "If-Match", w.Header().Get("ETag"))
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &service)
+	if service.ServiceStatus != models.StatusActive || service.StatusChangedBy != auth.RoleAdmin {
+		t.Fatalf("unexpected service %+v", service)
+	}
+
+	expectStatus(t, api.request(http.MethodPost, path, `{"to":"decommissioned"}`), http.StatusOK)
+	w = api.request(http.MethodPost, path, `{"to":"active"}`)
+	expectProblem(t, w, http.StatusConflict, controllers.CodeInvalidTransition)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if !strings.Contains(problem.Message, "final") {
+		t.Fatalf("unexpected message %q", problem.Message)
+	}
+}
+
+func TestTransitionLegacyService(t *testing.T) {
+	api := newTestAPI(t)
+
+	// services stored before the lifecycle have to be migrated before they can move
+	id, err := api.store.Services.Insert(context.Background(), models.ServiceBase{ServiceName: "Hosting", ServiceStatus: "Tools"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := api.request(http.MethodPost, "/api/services/"+id.Hex()+"/transitions", `{"to":"active"}`)
+	expectProblem(t, w, http.StatusConflict, controllers.CodeInvalidTransition)
+	var problem controllers.Problem
+	decode(t, w, &problem)
+	if !strings.Contains(problem.Message, "migrated") {
+		t.Fatalf("unexpected message %q", problem.Message)
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// GetTrash lists the deleted clients, services and contacts, most recently deleted first
+// e.g. /api/trash?type=clients&_start=0&_end=10
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, nil)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	// optionally restrict the listing to some entity types
+	types := map[string]bool{}
+	for _, t := range r.URL.Query()["type"] {
+		types[t] = true
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+
+	sources := []struct {
+		Type string
+		Bin  repository.TrashBin
+	}{
+		{"clients", h.store.Clients},
+		{"services", h.store.Services},
+		{"contacts", h.store.Contacts},
+	}
+
+	items := []models.TrashItem{}
+	total := 0
+	for _, source := range sources {
+		if len(types) > 0 && !types[source.Type] {
+			continue
+		}
+
+		// only list the resources the caller may read
+		if !identity.Can(auth.ReadPermission(source.Type)) {
+			continue
+		}
+
+		// each collection can at most contribute the documents up to the end of the requested page
+		sourceItems, count, err := source.Bin.Trash(r.Context(), opts.End)
+		if err != nil {
+			writeInternalError(w, r, "Failed to list deleted "+source.Type, err)
+			return
+		}
+
+		items = append(items, sourceItems...)
+		total += count
+	}
+
+	// merge the items of all collections by deletion time
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedOn.After(items[j].DeletedOn)
+	})
+
+	start, end := opts.Start, len(items)
+	if start > end {
+		start = end
+	}
+	if opts.End > 0 && opts.End < end {
+		end = opts.End
+	}
+	items = items[start:end]
+
+	setRangeHeaders(w, "trash", opts.Start, len(items), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(items)
+}
@@ -0,0 +1,68 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+)
+
+func TestTrashAndRestore(t *testing.T) {
+	api := newTestAPI(t)
+
+	clientID := api.create("/api/clients", `{"client_name":"Acme"}`)
+	serviceID := api.create("/api/services", newService("Hosting", clientID))
+	contactID := api.create("/api/contacts", `{"first_name":"Jane","last_name":"Doe","email":"jane@acme.example"}`)
+
+	expectStatus(t, api.request(http.MethodDelete, "/api/services/"+serviceID, ""), http.StatusOK)
+	expectStatus(t, api.request(http.MethodDelete, "/api/contacts/"+contactID, ""), http.StatusOK)
+
+	// deleted documents are hidden everywhere but in the trash
+	expectProblem(t, api.request(http.MethodGet, "/api/services/"+serviceID, ""), http.StatusNotFound, controllers.CodeNotFound)
+	expectProblem(t, api.request(http.MethodDelete, "/api/services/"+serviceID, ""), http.StatusNotFound, controllers.CodeNotFound)
+	w := api.request(http.MethodGet, "/api/clients/"+clientID, "")
+	var client models.ClientResponse
+	decode(t, w, &client)
+	if len(client.MangedServices) != 0 {
+		t.Fatalf("deleted service is joined %+v", client.MangedServices)
+	}
+
+	w = api.request(http.MethodGet, "/api/trash", "")
+	expectStatus(t, w, http.StatusOK)
+	var trash []models.TrashItem
+	decode(t, w, &trash)
+	if len(trash) != 2 {
+		t.Fatalf("unexpected trash %+v", trash)
+	}
+	decode(t, api.request(http.MethodGet, "/api/trash?type=services", ""), &trash)
+	if len(trash) != 1 || trash[0].ID.Hex() != serviceID || trash[0].Title != "Hosting" || trash[0].DeletedBy != auth.RoleAdmin {
+		t.Fatalf("unexpected trash of services %+v", trash)
+	}
+
+	expectStatus(t, api.request(http.MethodPost, "/api/services/"+serviceID+"/restore", ""), http.StatusOK)
+	expectProblem(t, api.request(http.MethodPost, "/api/services/"+serviceID+"/restore", ""), http.StatusNotFound, controllers.CodeNotFound)
+	expectStatus(t, api.request(http.MethodGet, "/api/services/"+serviceID, ""), http.StatusOK)
+
+	// the trash only lists the resources the caller may read
+	decode(t, api.as(auth.RoleViewer).request(http.MethodGet, "/api/trash", ""), &trash)
+	if len(trash) != 1 || trash[0].Type != "contacts" {
+		t.Fatalf("unexpected trash %+v", trash)
+	}
+}
+
+func TestPurgedDocumentsCantBeRestored(t *testing.T) {
+	api := newTestAPI(t)
+
+	id := api.create("/api/clients", `{"client_name":"Acme"}`)
+	expectStatus(t, api.request(http.MethodDelete, "/api/clients/"+id, ""), http.StatusNoContent)
+
+	purged, err := api.store.Clients.Purge(context.Background(), time.Now())
+	if err != nil || purged != 1 {
+		t.Fatalf("purged %d clients: %v", purged, err)
+	}
+	expectProblem(t, api.request(http.MethodPost, "/api/clients/"+id+"/restore", ""), http.StatusNotFound, controllers.CodeNotFound)
+}
@@ -0,0 +1,431 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"github.com/terrpan/clientdb/internal/webhooks"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// eventEntities maps the entities with change events to the prefix of their event types, e.g. service.updated
+	eventEntities = map[string]string{
+		"clients":  "client",
+		"services": "service",
+		"contacts": "contact",
+	}
+
+	// eventActions maps the audit actions to the suffix of their event types
+	eventActions = map[string]string{
+		models.AuditCreate:  "created",
+		models.AuditUpdate:  "updated",
+		models.AuditDelete:  "deleted",
+		models.AuditRestore: "restored",
+	}
+
+	// the secrets can't be used to look up webhooks and the payloads are only shown
+	webhookFilterFields  = withoutFilterFields(newFilterFields(models.Webhook{}), "secret")
+	deliveryFilterFields = withoutFilterFields(newFilterFields(models.WebhookDelivery{}), "payload")
+)
+
+func withoutFilterFields(fields filterFields, names ...string) filterFields {
+	for _, name := range names {
+		delete(fields, name)
+	}
+	return fields
+}
+
+// validEventFilter reports whether filter is an event type a webhook can subscribe to, e.g. service.updated,
+// client.* or *
+func validEventFilter(filter string) bool {
+	if filter == "*" {
+		return true
+	}
+
+	parts := strings.SplitN(filter, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	for _, prefix := range eventEntities {
+		if parts[0] != prefix {
+			continue
+		}
+		if parts[1] == "*" {
+			return true
+		}
+		for _, suffix := range eventActions {
+			if parts[1] == suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queueEvent queues a delivery of the change in entry to every webhook subscribed to it. The deliveries are stored
+// with the request context, so a change made in a transaction is only delivered once it is committed. Failures are
+// logged, the change itself has already been made.
+func (h *Handler) queueEvent(r *http.Request, entry models.AuditEntry, before interface{}, after interface{}) {
+	prefix, ok := eventEntities[entry.Entity]
+	if !ok {
+		return
+	}
+	event := models.Event{
+		ID:         primitive.NewObjectID(),
+		Type:       prefix + "." + eventActions[entry.Action],
+		OccurredOn: entry.Timestamp,
+		Actor:      entry.Actor,
+		RequestID:  entry.RequestID,
+		Entity:     entry.Entity,
+		EntityID:   entry.EntityID,
+		Data:       after,
+	}
+	if after == nil {
+		event.Data = before
+	}
+
+	logger := log.WithField("request_id", entry.RequestID)
+
+	subscribed, err := h.store.Webhooks.Subscribed(r.Context(), event.Type)
+	if err != nil {
+		logger.Error("Failed to get the webhooks subscribed to ", event.Type, ": ", err)
+		return
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode ", event.Type, " event: ", err)
+		return
+	}
+
+	deliveries := make([]models.WebhookDelivery, len(subscribed))
+	for i, webhook := range subscribed {
+		deliveries[i] = models.WebhookDelivery{
+			ID:            primitive.NewObjectID(),
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			Event:         event.Type,
+			Payload:       payload,
+			Status:        models.DeliveryPending,
+			Attempts:      []models.DeliveryAttempt{},
+			NextAttemptOn: &entry.Timestamp,
+			CreatedOn:     entry.Timestamp,
+		}
+	}
+
+	if err := h.store.Deliveries.Insert(r.Context(), deliveries); err != nil {
+		logger.Error("Failed to queue ", event.Type, " event for ", len(deliveries), " webhooks: ", err)
+	}
+}
+
+// GetWebhooks returns a page of webhooks, e.g. /api/webhooks?events=service.updated, the secrets are left out
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListParams(r, webhookFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	// webhooks have no text index
+	if opts.Query != "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Webhooks don't support full text search")
+		return
+	}
+
+	opts.Filters, err = parseFilters(r.URL.Query(), webhookFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	list, total, err := h.store.Webhooks.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get webhooks", err)
+		return
+	}
+
+	for i := range list {
+		list[i].Secret = ""
+	}
+
+	setRangeHeaders(w, "webhooks", opts.Start, len(list), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetWebhookById returns a single webhook without its secret
+func (h *Handler) GetWebhookById(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	webhook, err := h.store.Webhooks.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No webhook found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get webhook", err)
+		return
+	}
+
+	if notModified(w, r, webhook.Version) {
+		return
+	}
+
+	webhook.Secret = ""
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// AddWebhook subscribes a URL to change events, e.g. POST /api/webhooks
+// {"url": "https://example.com/hooks/clientdb", "events": ["service.updated", "client.deleted"]}
+// A secret is generated unless the body has one, the response is the only one containing it.
+func (h *Handler) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if validationErr := validate.Struct(webhook); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			writeInternalError(w, r, "Failed to generate webhook secret", err)
+			return
+		}
+		webhook.Secret = secret
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	webhook.ID = primitive.NilObjectID
+	webhook.CreatedBy = identity.Subject
+	webhook.CreatedOn = time.Now()
+	webhook.ModifiedOn = webhook.CreatedOn
+
+	id, err := h.store.Webhooks.Insert(r.Context(), webhook)
+	if err != nil {
+		writeInternalError(w, r, "Failed to add webhook", err)
+		return
+	}
+	webhook.ID, webhook.Version = id, 1
+
+	log.Info("Webhook added, id: ", id.Hex())
+
+	w.Header().Set("ETag", etag(webhook.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// UpdateWebhook replaces a webhook (PUT), the secret is kept unless the body has a new one
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if validationErr := validate.Struct(webhook); validationErr != nil {
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	current, err := h.store.Webhooks.Find(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No webhook found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get webhook", err)
+		return
+	}
+
+	// the caller has to prove it saw the current version, a concurrent change fails with 412
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	if webhook.Secret == "" {
+		webhook.Secret = current.Secret
+	}
+	webhook.CreatedBy, webhook.CreatedOn = current.CreatedBy, current.CreatedOn
+	webhook.ModifiedOn = time.Now()
+
+	updated, err := h.store.Webhooks.Replace(r.Context(), id, current.Version, webhook)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No webhook found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to update webhook: "+id.Hex(), err)
+		return
+	}
+
+	log.Info("Webhook updated, id: ", id.Hex())
+
+	updated.Secret = ""
+	w.Header().Set("ETag", etag(updated.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteWebhook removes a webhook, its deliveries are kept in the delivery log and the pending ones are dead
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	err := h.store.Webhooks.Delete(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No webhook found with id: "+id.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to delete webhook: "+id.Hex(), err)
+		return
+	}
+
+	log.Info("Webhook deleted, id: ", id.Hex())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns a page of the delivery log of a webhook, newest first, e.g. the dead letters with
+// /api/webhooks/{id}/deliveries?status=dead
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := pathID(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	opts, err := parseListParams(r, deliveryFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid list parameters: "+err.Error())
+		return
+	}
+
+	if opts.Query != "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Webhook deliveries don't support full text search")
+		return
+	}
+
+	if r.URL.Query().Get("_sort") == "" {
+		opts.Sort, opts.Order = "created_on", -1
+	}
+
+	opts.Filters, err = parseFilters(r.URL.Query(), deliveryFilterFields)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid filter: "+err.Error())
+		return
+	}
+
+	// the log of a deleted webhook can still be read
+	opts.Filters = append(opts.Filters, repository.Filter{Path: "webhook_id", Operator: repository.OpEq, Value: webhookID})
+
+	deliveries, total, err := h.store.Deliveries.List(r.Context(), opts)
+	if err != nil {
+		writeInternalError(w, r, "Failed to get webhook deliveries", err)
+		return
+	}
+
+	setRangeHeaders(w, "deliveries", opts.Start, len(deliveries), total)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RedeliverWebhookDelivery queues a delivered or dead delivery again, it is attempted as soon as possible with all
+// its attempts, e.g. POST /api/webhooks/{id}/deliveries/{deliveryId}/redeliver
+func (h *Handler) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := pathID(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	deliveryID, ok := pathID(w, r, "deliveryId", "delivery")
+	if !ok {
+		return
+	}
+
+	current, err := h.store.Deliveries.Find(r.Context(), deliveryID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && current.WebhookID != webhookID) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No delivery found with id: "+deliveryID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get webhook delivery", err)
+		return
+	}
+
+	// a delivery of a deleted or disabled webhook would be dead again right away
+	webhook, err := h.store.Webhooks.Find(r.Context(), webhookID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No webhook found with id: "+webhookID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to get webhook", err)
+		return
+	}
+
+	if webhook.Disabled {
+		writeProblem(w, r, http.StatusConflict, CodeConflict, "Webhook is disabled, enable it before redelivering")
+		return
+	}
+
+	delivery, err := h.store.Deliveries.Requeue(r.Context(), deliveryID, time.Now())
+	if errors.Is(err, repository.ErrPending) {
+		writeProblem(w, r, http.StatusConflict, CodeConflict, "Delivery is still pending")
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "No delivery found with id: "+deliveryID.Hex())
+		return
+	}
+
+	if err != nil {
+		writeInternalError(w, r, "Failed to redeliver webhook delivery: "+deliveryID.Hex(), err)
+		return
+	}
+
+	log.Info("Webhook delivery queued again, id: ", deliveryID.Hex())
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
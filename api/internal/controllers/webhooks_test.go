@@ -0,0 +1,109 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/auth"
+	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func deliveries(t *testing.T, api *testAPI, webhookID string, query string) []models.WebhookDelivery {
+	t.Helper()
+
+	w := api.request(http.MethodGet, "/api/webhooks/"+webhookID+"/deliveries?"+query, "")
+	expectStatus(t, w, http.StatusOK)
+	var deliveries []models.WebhookDelivery
+	decode(t, w, &deliveries)
+	return deliveries
+}
+
+func TestWebhooks(t *testing.T) {
+	api := newTestAPI(t)
+
+	w := api.request(http.MethodPost, "/api/webhooks", `{"url":"https://example.com/hooks","events":["client.*"]}`)
+	expectStatus(t, w, http.StatusCreated)
+	var webhook models.Webhook
+	decode(t, w, &webhook)
+	if webhook.Secret == "" || webhook.Version != 1 {
+		t.Fatalf("unexpected webhook %+v", webhook)
+	}
+	id := webhook.ID.Hex()
+
+	// the secret is only returned when the webhook is created
+	w = api.request(http.MethodGet, "/api/webhooks/"+id, "")
+	expectStatus(t, w, http.StatusOK)
+	var stored models.Webhook
+	decode(t, w, &stored)
+	if stored.Secret != "" || stored.URL != webhook.URL {
+		t.Fatalf("unexpected webhook %+v", stored)
+	}
+
+	acme := api.create("/api/clients", `{"client_name":"Acme"}`)
+	api.create("/api/services", newService("Hosting"))
+
+	queued := deliveries(t, api, id, "")
+	if len(queued) != 1 || queued[0].Event != "client.created" || queued[0].Status != models.DeliveryPending {
+		t.Fatalf("unexpected deliveries %+v", queued)
+	}
+	var event models.Event
+	if err := json.Unmarshal(queued[0].Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := event.Data.(map[string]interface{})
+	if event.EntityID.Hex() != acme || event.Actor != auth.RoleAdmin || data["id"] != acme || data["client_name"] != "Acme" || data["version"] != 1.0 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// a rolled back batch queues nothing
+	w = api.request(http.MethodPost, "/api/batch", `{"operations":[
+		{"op":"create","entity":"clients","body":{"client_name":"Globex"}},
+		{"op":"delete","entity":"clients","id":"`+unknownClient+`","version":1}
+	]}`)
+	expectStatus(t, w, http.StatusNotFound)
+	if queued := deliveries(t, api, id, ""); len(queued) != 1 {
+		t.Fatalf("unexpected deliveries %+v", queued)
+	}
+
+	expectProblem(t, api.request(http.MethodPost, "/api/webhooks", `{"url":"https://example.com/hooks","events":["invoice.paid"]}`),
+		http.StatusBadRequest, controllers.CodeValidationFailed)
+	expectStatus(t, api.as(auth.RoleEditor).request(http.MethodGet, "/api/webhooks", ""), http.StatusForbidden)
+}
+
+func TestRedeliverWebhookDelivery(t *testing.T) {
+	api := newTestAPI(t)
+
+	webhookID, err := api.store.Webhooks.Insert(context.Background(), models.Webhook{URL: "https://example.com/hooks", Events: []string{"*"}, Secret: "whsec_test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.create("/api/clients", `{"client_name":"Acme"}`)
+
+	delivery := deliveries(t, api, webhookID.Hex(), "")[0]
+	path := "/api/webhooks/" + webhookID.Hex() + "/deliveries/" + delivery.ID.Hex() + "/redeliver"
+	expectProblem(t, api.request(http.MethodPost, path, ""), http.StatusConflict, controllers.CodeConflict)
+
+	attempt := models.DeliveryAttempt{AttemptedOn: time.Now(), ResponseStatus: http.StatusServiceUnavailable}
+	if err := api.store.Deliveries.Record(context.Background(), delivery.ID, attempt, models.DeliveryDead, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dead := deliveries(t, api, webhookID.Hex(), "status=dead"); len(dead) != 1 {
+		t.Fatalf("unexpected deliveries %+v", dead)
+	}
+
+	// a redelivery keeps the attempts made so far
+	w := api.request(http.MethodPost, path, "")
+	expectStatus(t, w, http.StatusAccepted)
+	decode(t, w, &delivery)
+	if delivery.Status != models.DeliveryPending || delivery.Failures != 0 || len(delivery.Attempts) != 1 {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+
+	expectProblem(t, api.request(http.MethodPost, "/api/webhooks/"+primitive.NewObjectID().Hex()+"/deliveries/"+delivery.ID.Hex()+"/redeliver", ""),
+		http.StatusNotFound, controllers.CodeNotFound)
+}
@@ -0,0 +1,218 @@
+// Package export flattens the documents returned by the API into the rows of csv files and xlsx spreadsheets
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Flatten modes of the arrays of documents nested in a document, e.g. the managed_services of a client
+const (
+	// Join writes a row per document, the values of every element of an array share one cell
+	Join = "join"
+	// Rows writes a row per element of one array, the fields of the document are repeated on each row and the
+	// other arrays are joined
+	Rows = "rows"
+)
+
+// DefaultSeparator separates the joined values of an array
+const DefaultSeparator = "; "
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	amountType   = reflect.TypeOf(money.Amount{})
+)
+
+// Cell is a value of a row, Number marks values spreadsheets should treat as numbers
+type Cell struct {
+	Value  string
+	Number bool
+}
+
+// Writer writes the rows of an export as they are produced
+type Writer interface {
+	WriteRow(cells []Cell) error
+	// Close completes the file, the rows written so far may be unreadable without it
+	Close() error
+}
+
+// Column is a column of an export named by the json name of a field, columns of an array hold a field of its
+// elements and are named array.field, e.g. managed_services.service_name
+type Column struct {
+	Name  string
+	Array string
+	Field string
+}
+
+// Columns returns the columns of the documents of model in the order of its fields. Arrays of documents get a
+// column for each field of their elements.
+func Columns(model interface{}) []Column {
+	var columns []Column
+	for _, field := range jsonFields(reflect.TypeOf(model)) {
+		element := field.Type
+		if element.Kind() != reflect.Slice || element.Elem().Kind() != reflect.Struct || isValue(element.Elem()) {
+			columns = append(columns, Column{Name: field.Name, Field: field.Name})
+			continue
+		}
+
+		for _, nested := range jsonFields(element.Elem()) {
+			columns = append(columns, Column{Name: field.Name + "." + nested.Name, Array: field.Name, Field: nested.Name})
+		}
+	}
+	return columns
+}
+
+// isValue reports whether structs of type t are rendered as a single json value
+func isValue(t reflect.Type) bool {
+	return t == timeType || t == objectIDType || t == amountType
+}
+
+// jsonField is a struct field rendered in json
+type jsonField struct {
+	Name string
+	Type reflect.Type
+}
+
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{Name: name, Type: field.Type})
+	}
+	return fields
+}
+
+// SelectColumns returns the columns named by names in their order, the name of an array selects all its columns
+func SelectColumns(columns []Column, names []string) ([]Column, error) {
+	var selected []Column
+	for _, name := range names {
+		found := false
+		for _, column := range columns {
+			if column.Name == name || column.Array == name {
+				selected = append(selected, column)
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.New("unknown field: " + name)
+		}
+	}
+	return selected, nil
+}
+
+// Flattener turns documents into rows of the columns
+type Flattener struct {
+	Columns []Column
+	// Mode is Join or Rows, Unwind names the array written a row per element in Rows mode
+	Mode      string
+	Unwind    string
+	Separator string
+}
+
+// Header returns the row naming the columns
+func (f Flattener) Header() []Cell {
+	header := make([]Cell, len(f.Columns))
+	for i, column := range f.Columns {
+		header[i] = Cell{Value: column.Name}
+	}
+	return header
+}
+
+// Rows returns the rows of document, it is flattened from its json representation. A document without elements in
+// the unwound array still gets a row.
+func (f Flattener) Rows(document interface{}) ([][]Cell, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	if f.Mode != Rows {
+		return [][]Cell{f.row(values, nil)}, nil
+	}
+
+	elements, _ := values[f.Unwind].([]interface{})
+	if len(elements) == 0 {
+		return [][]Cell{f.row(values, nil)}, nil
+	}
+
+	rows := make([][]Cell, 0, len(elements))
+	for _, element := range elements {
+		unwound, _ := element.(map[string]interface{})
+		rows = append(rows, f.row(values, unwound))
+	}
+	return rows, nil
+}
+
+// row returns the cells of a row of the document values, unwound is the element of the unwound array on the row
+func (f Flattener) row(values map[string]interface{}, unwound map[string]interface{}) []Cell {
+	cells := make([]Cell, len(f.Columns))
+	for i, column := range f.Columns {
+		switch {
+		case column.Array == "":
+			cells[i] = cell(values[column.Field])
+		case f.Mode == Rows && column.Array == f.Unwind:
+			cells[i] = cell(unwound[column.Field])
+		default:
+			cells[i] = f.join(values[column.Array], column.Field)
+		}
+	}
+	return cells
+}
+
+// join returns the values of field of every element of array in one cell, empty values are kept so the joined
+// columns of an array line up
+func (f Flattener) join(array interface{}, field string) Cell {
+	elements, _ := array.([]interface{})
+	if len(elements) == 1 {
+		element, _ := elements[0].(map[string]interface{})
+		return cell(element[field])
+	}
+
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		element, _ := element.(map[string]interface{})
+		parts[i] = cell(element[field]).Value
+	}
+	return Cell{Value: strings.Join(parts, f.Separator)}
+}
+
+// cell renders a decoded json value
+func cell(value interface{}) Cell {
+	switch v := value.(type) {
+	case nil:
+		return Cell{}
+	case string:
+		return Cell{Value: v}
+	case json.Number:
+		return Cell{Value: v.String(), Number: true}
+	case bool:
+		return Cell{Value: strconv.FormatBool(v)}
+	}
+
+	// arrays of values and nested documents are kept as json
+	data, _ := json.Marshal(value)
+	return Cell{Value: string(data)}
+}
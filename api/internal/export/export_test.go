@@ -0,0 +1,147 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type line struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+type order struct {
+	ID    string   `json:"id"`
+	Tags  []string `json:"tags"`
+	Lines []line   `json:"lines"`
+	Notes string   `json:"-"`
+}
+
+func names(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+func values(cells []Cell) []string {
+	values := make([]string, len(cells))
+	for i, cell := range cells {
+		values[i] = cell.Value
+	}
+	return values
+}
+
+func TestColumns(t *testing.T) {
+	columns := Columns(order{})
+	if want := []string{"id", "tags", "lines.name", "lines.quantity"}; !reflect.DeepEqual(names(columns), want) {
+		t.Fatalf("Columns = %v, want %v", names(columns), want)
+	}
+
+	// an array selects the columns of all its fields
+	selected, err := SelectColumns(columns, []string{"lines", "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"lines.name", "lines.quantity", "id"}; !reflect.DeepEqual(names(selected), want) {
+		t.Fatalf("SelectColumns = %v, want %v", names(selected), want)
+	}
+
+	if _, err := SelectColumns(columns, []string{"notes"}); err == nil {
+		t.Fatal("SelectColumns of an unknown field succeeded")
+	}
+}
+
+func TestFlattener(t *testing.T) {
+	document := order{ID: "1", Tags: []string{"a", "b"}, Lines: []line{{"Hosting", 2}, {"Support", 1}}}
+	flattener := Flattener{Columns: Columns(order{}), Mode: Join, Separator: DefaultSeparator}
+
+	rows, err := flattener.Rows(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"1", `["a","b"]`, "Hosting; Support", "2; 1"}}; len(rows) != 1 || !reflect.DeepEqual(values(rows[0]), want[0]) {
+		t.Fatalf("Rows = %v, want %v", rows, want)
+	}
+
+	// a single element keeps the type of its value
+	rows, err = flattener.Rows(order{ID: "2", Lines: []line{{"Hosting", 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cell := rows[0][3]; cell.Value != "2" || !cell.Number {
+		t.Fatalf("quantity cell = %+v, want the number 2", cell)
+	}
+
+	flattener.Mode, flattener.Unwind = Rows, "lines"
+	rows, err = flattener.Rows(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || !reflect.DeepEqual(values(rows[1]), []string{"1", `["a","b"]`, "Support", "1"}) {
+		t.Fatalf("Rows = %v", rows)
+	}
+
+	// a document without elements still gets a row
+	rows, err = flattener.Rows(order{ID: "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || !reflect.DeepEqual(values(rows[0]), []string{"3", "", "", ""}) {
+		t.Fatalf("Rows = %v", rows)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var b bytes.Buffer
+	writer, err := NewXLSX(&b, "a & b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteRow([]Cell{{Value: "<name>"}, {Value: "12.5", Number: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[file.Name] = string(content)
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `name="a &amp; b"`) {
+		t.Fatalf("unexpected workbook %s", parts["xl/workbook.xml"])
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(sheet, `<c r="A1" t="inlineStr"><is><t xml:space="preserve">&lt;name&gt;</t></is></c>`) ||
+		!strings.Contains(sheet, `<c r="B1"><v>12.5</v></c>`) || !strings.HasSuffix(sheet, xlsxSheetEnd) {
+		t.Fatalf("unexpected sheet %s", sheet)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for index, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %s, want %s", index, got, want)
+		}
+	}
+}
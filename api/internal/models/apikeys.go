@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey is a static credential, only the SHA-256 hash of the key is stored
+type APIKey struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	KeyHash   string             `json:"-" bson:"key_hash"`
+	Roles     []string           `json:"roles" bson:"roles"`
+	CreatedOn time.Time          `json:"created_on,omitempty" bson:"created_on,omitempty"`
+	RevokedOn *time.Time         `json:"revoked_on,omitempty" bson:"revoked_on,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditEntry records who changed which fields of a client, service or contact
+type AuditEntry struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Timestamp  time.Time          `json:"timestamp" bson:"timestamp"`
+	Actor      string             `json:"actor" bson:"actor"`
+	AuthMethod string             `json:"auth_method" bson:"auth_method"`
+	RequestID  string             `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	Action     string             `json:"action" bson:"action"`
+	Entity     string             `json:"entity" bson:"entity"`
+	EntityID   primitive.ObjectID `json:"entity_id" bson:"entity_id"`
+	Changes    []FieldChange      `json:"changes" bson:"changes"`
+}
+
+// FieldChange is the value of a field before and after a change, a missing value is null
+type FieldChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Change actions, the suffix of the event types on the event feed, e.g. service.purged. Purged documents were
+// removed from the trash for good.
+const (
+	ChangeCreated  = "created"
+	ChangeUpdated  = "updated"
+	ChangeDeleted  = "deleted"
+	ChangeRestored = "restored"
+	ChangePurged   = "purged"
+)
+
+// Change is a change of a client, service or contact as it was written to the database. Token resumes the feed
+// right after the change, Data is the document after the change and nil when it is purged or no longer found.
+type Change struct {
+	Token      string
+	Entity     string
+	Action     string
+	EntityID   primitive.ObjectID
+	OccurredOn time.Time
+	Data       interface{}
+}
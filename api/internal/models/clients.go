@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/terrpan/clientdb/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ClientBase struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ClientName   string             `json:"client_name" bson:"client_name" validate:"required"`
+	SlackChannel string             `json:"slack_channel,omitempty" bson:"slack_channel,omitempty"`
+	WebUrl       string             `json:"web_url,omitempty" bson:"web_url,omitempty"`
+	CreatedOn    time.Time          `json:"created_on,omitempty" bson:"created_on,omitempty"`
+	ModifiedOn   time.Time          `json:"modified_on,omitempty" bson:"modified_on,omitempty"`
+	Version      int64              `json:"version" bson:"version"`
+	// DeletedOn and DeletedBy mark a document in the trash, they are maintained by the API
+	DeletedOn *time.Time `json:"-" bson:"deleted_on,omitempty"`
+	DeletedBy string     `json:"-" bson:"deleted_by,omitempty"`
+}
+
+type ClientResponse struct {
+	ID             primitive.ObjectID               `json:"id" bson:"_id,omitempty"`
+	ClientName     string                           `json:"client_name" bson:"client_name"`
+	SlackChannel   string                           `json:"slack_channel,omitempty" bson:"slack_channel,omitempty"`
+	WebUrl         string                           `json:"web_url,omitempty" bson:"web_url,omitempty"`
+	MangedServices []ClientsManagedServicesResponse `json:"managed_services" bson:"managed_services"`
+	ClientContacts []ClientsContactResponse         `json:"client_contacts" bson:"client_contacts"`
+	CreatedOn      time.Time                        `json:"created_on,omitempty" bson:"created_on,omitempty"`
+	ModifiedOn     time.Time                        `json:"modified_on,omitempty" bson:"modified_on,omitempty"`
+	Version        int64                            `json:"version" bson:"version"`
+}
+
+type ClientsManagedServicesResponse struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ServiceName      string             `json:"service_name" bson:"service_name" validate:"required"`
+	ServiceType      string             `json:"service_type" bson:"service_type" validate:"required"`
+	ServiceStatus    string             `json:"service_status" bson:"service_status" validate:"required"`
+	InvoiceFrequency string             `json:"invoice_frequency" bson:"invoice_frequency"`
+	InvoiceAmount    money.Amount       `json:"invoice_amount" bson:"invoice_amount"`
+	ManagementFee    money.Amount       `json:"management_fee" bson:"management_fee"`
+	Currency         string             `json:"currency" bson:"currency"`
+}
+
+type ClientsContactResponse struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FirstName   string             `json:"first_name" bson:"first_name" validate:"required"`
+	LastName    string             `json:"last_name" bson:"last_name" validate:"required"`
+	FullName    string             `json:"full_name,omitempty" bson:"full_name,omitempty"`
+	Email       string             `json:"email" bson:"email" validate:"required,email"`
+	PhoneNumber string             `json:"phone_number,omitempty" bson:"phone_number"`
+	Role        string             `json:"role,omitempty" bson:"role"`
+}
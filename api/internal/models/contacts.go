@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ContactsBase struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FirstName        string             `json:"first_name" bson:"first_name" validate:"required"`
+	LastName         string             `json:"last_name" bson:"last_name" validate:"required"`
+	FullName         string             `json:"full_name,omitempty" bson:"full_name,omitempty"`
+	Email            string             `json:"email" bson:"email" validate:"required,email"`
+	AttachedToClient []Clients          `json:"attached_to_client,omitempty" bson:"attached_to_client"`
+	PhoneNumber      string             `json:"phone_number,omitempty" bson:"phone_number"`
+	Role             string             `json:"role,omitempty" bson:"role"`
+	CreatedOn        time.Time          `json:"created_on" bson:"created_on,omitempty"`
+	ModifiedOn       time.Time          `json:"modified_on" bson:"modified_on,omitempty"`
+	Version          int64              `json:"version" bson:"version"`
+	// DeletedOn and DeletedBy mark a document in the trash, they are maintained by the API
+	DeletedOn *time.Time `json:"-" bson:"deleted_on,omitempty"`
+	DeletedBy string     `json:"-" bson:"deleted_by,omitempty"`
+}
+
+type ContactResponse struct {
+	ID          primitive.ObjectID      `json:"id" bson:"_id,omitempty"`
+	FirstName   string                  `json:"first_name" bson:"first_name"`
+	LastName    string                  `json:"last_name" bson:"last_name"`
+	FullName    string                  `json:"full_name,omitempty" bson:"full_name,omitempty"`
+	Email       string                  `json:"email" bson:"email"`
+	PhoneNumber string                  `json:"phone_number,omitempty" bson:"phone_number"`
+	Client      []ContactClientResponse `json:"client,omitempty" bson:"client"`
+	Role        string                  `json:"role,omitempty" bson:"role"`
+	CreatedOn   time.Time               `json:"created_on" bson:"created_on,omitempty"`
+	ModifiedOn  time.Time               `json:"modified_on" bson:"modified_on,omitempty"`
+	Version     int64                   `json:"version" bson:"version"`
+}
+
+type ContactClientResponse struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ClientName string             `json:"client_name" bson:"client_name"`
+}
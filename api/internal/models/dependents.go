@@ -0,0 +1,15 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Dependent is a service or contact attached to a client, Action is the cascade applied to it when the client
+// was deleted. Before and After are the stored documents around the cascade for the audit log, After is nil when
+// the dependent was deleted with the client
+type Dependent struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	Type   string             `json:"type" bson:"type"`
+	Title  string             `json:"title" bson:"title"`
+	Action string             `json:"action,omitempty" bson:"-"`
+	Before interface{}        `json:"-" bson:"-"`
+	After  interface{}        `json:"-" bson:"-"`
+}
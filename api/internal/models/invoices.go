@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"github.com/terrpan/clientdb/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invoice statuses, an invoice moves between them along invoiceTransitions
+const (
+	InvoiceDraft  = "draft"
+	InvoiceIssued = "issued"
+	InvoicePaid   = "paid"
+	InvoiceVoid   = "void"
+)
+
+// invoiceTransitions lists the statuses an invoice may move to from each status, paid and void are final
+var invoiceTransitions = map[string][]string{
+	InvoiceDraft:  {InvoiceIssued, InvoiceVoid},
+	InvoiceIssued: {InvoicePaid, InvoiceVoid},
+	InvoicePaid:   {},
+	InvoiceVoid:   {},
+}
+
+// Invoice bills the active services of a client in one currency for a billing period, the period end is exclusive
+type Invoice struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// Number is assigned when the invoice is issued, drafts don't have one so voided drafts leave no gaps
+	Number      string             `json:"number,omitempty" bson:"number,omitempty"`
+	ClientID    primitive.ObjectID `json:"client_id" bson:"client_id"`
+	ClientName  string             `json:"client_name" bson:"client_name"`
+	PeriodStart time.Time          `json:"period_start" bson:"period_start"`
+	PeriodEnd   time.Time          `json:"period_end" bson:"period_end"`
+	Status      string             `json:"status" bson:"status"`
+	Currency    string             `json:"currency" bson:"currency"`
+	Lines       []InvoiceLine      `json:"lines" bson:"lines"`
+	Total       money.Amount       `json:"total" bson:"total"`
+	IssuedOn    *time.Time         `json:"issued_on,omitempty" bson:"issued_on,omitempty"`
+	PaidOn      *time.Time         `json:"paid_on,omitempty" bson:"paid_on,omitempty"`
+	VoidedOn    *time.Time         `json:"voided_on,omitempty" bson:"voided_on,omitempty"`
+	CreatedOn   time.Time          `json:"created_on" bson:"created_on,omitempty"`
+	CreatedBy   string             `json:"created_by" bson:"created_by"`
+	ModifiedOn  time.Time          `json:"modified_on" bson:"modified_on,omitempty"`
+	Version     int64              `json:"version" bson:"version"`
+}
+
+// InvoiceLine bills a service or its management fee for the period of the invoice
+type InvoiceLine struct {
+	ServiceID        primitive.ObjectID `json:"service_id" bson:"service_id"`
+	Description      string             `json:"description" bson:"description"`
+	InvoiceFrequency string             `json:"invoice_frequency" bson:"invoice_frequency"`
+	// Quantity is the number of billing cycles covered by the period, e.g. 0.5 for half a month of a monthly service
+	Quantity   float64      `json:"quantity" bson:"quantity"`
+	UnitAmount money.Amount `json:"unit_amount" bson:"unit_amount"`
+	Amount     money.Amount `json:"amount" bson:"amount"`
+}
+
+// InvoiceRequest is the body of a request generating a draft invoice, the period end is exclusive. An invoice bills
+// the services of a single currency, Currency picks it for clients with services in several currencies.
+type InvoiceRequest struct {
+	PeriodStart time.Time `json:"period_start" validate:"required"`
+	PeriodEnd   time.Time `json:"period_end" validate:"required,gtfield=PeriodStart"`
+	Currency    string    `json:"currency" validate:"omitempty,currency"`
+}
+
+// InvoiceTransition is the body of an invoice status transition request
+type InvoiceTransition struct {
+	To string `json:"to" validate:"required,oneof=issued paid void"`
+}
+
+// NextInvoiceStatuses returns the statuses an invoice in status may move to
+func NextInvoiceStatuses(status string) []string {
+	return invoiceTransitions[status]
+}
+
+// CanTransitionInvoice reports whether an invoice may move from one status to another
+func CanTransitionInvoice(from string, to string) bool {
+	for _, status := range NextInvoiceStatuses(from) {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import "github.com/terrpan/clientdb/internal/money"
+
+// RevenueGroup is the recurring revenue in one currency of the services sharing a value of the grouped field. Key is
+// the value, for clients it is the client id and Name the client name. Services with an unknown invoice frequency
+// can't be normalized, they are counted in Unnormalized and left out of the figures.
+type RevenueGroup struct {
+	Key          string       `json:"key" bson:"key"`
+	Name         string       `json:"name" bson:"name"`
+	Currency     string       `json:"currency" bson:"currency"`
+	Services     int          `json:"services" bson:"services"`
+	Unnormalized int          `json:"unnormalized" bson:"unnormalized"`
+	Monthly      money.Amount `json:"monthly" bson:"monthly"`
+	Annual       money.Amount `json:"annual" bson:"annual"`
+}
+
+// RevenueReport is the recurring revenue of the services grouped by one of their fields. All figures are in
+// Currency, services billed in other currencies are converted with Rates.
+type RevenueReport struct {
+	GroupBy  string                  `json:"group_by"`
+	Currency string                  `json:"currency"`
+	Rates    map[string]money.Amount `json:"rates,omitempty"`
+	Groups   []RevenueGroup          `json:"groups"`
+	Monthly  money.Amount            `json:"monthly"`
+	Annual   money.Amount            `json:"annual"`
+}
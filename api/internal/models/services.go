@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/terrpan/clientdb/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ServiceBase struct {
+	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ServiceName        string             `json:"service_name" bson:"service_name" validate:"required"`
+	ServiceType        string             `json:"service_type" bson:"service_type" validate:"required"`
+	ServiceOwner       string             `json:"service_owner" bson:"service_owner" validate:"required"`
+	ServiceDescription string             `json:"service_description" bson:"service_description"`
+	ServiceStatus      string             `json:"service_status" bson:"service_status" validate:"required,oneof=proposed onboarding active suspended decommissioned"`
+	AttachedToClient   []Clients          `json:"attached_to_client" bson:"attached_to_client"`
+	InvoiceFrequency   string             `json:"invoice_frequency" bson:"invoice_frequency"`
+	InvoiceAmount      money.Amount       `json:"invoice_amount" bson:"invoice_amount"`
+	ManagementFee      money.Amount       `json:"management_fee" bson:"management_fee"`
+	Currency           string             `json:"currency" bson:"currency" validate:"required,currency"`
+	CreatedOn          time.Time          `json:"created_on" bson:"created_on,omitempty"`
+	ModifiedOn         time.Time          `json:"modified_on" bson:"modified_on,omitempty"`
+	Version            int64              `json:"version" bson:"version"`
+	// StatusChangedOn and StatusChangedBy record the last status transition, they are maintained by the API
+	StatusChangedOn time.Time `json:"status_changed_on,omitempty" bson:"status_changed_on,omitempty"`
+	StatusChangedBy string    `json:"status_changed_by,omitempty" bson:"status_changed_by,omitempty"`
+	// DeletedOn and DeletedBy mark a document in the trash, they are maintained by the API
+	DeletedOn *time.Time `json:"-" bson:"deleted_on,omitempty"`
+	DeletedBy string     `json:"-" bson:"deleted_by,omitempty"`
+}
+
+type ServiceResponse struct {
+	ID                 primitive.ObjectID      `json:"id" bson:"_id,omitempty"`
+	ServiceName        string                  `json:"service_name" bson:"service_name"`
+	ServiceType        string                  `json:"service_type" bson:"service_type"`
+	ServiceOwner       string                  `json:"service_owner" bson:"service_owner"`
+	ServiceDescription string                  `json:"service_description" bson:"service_description"`
+	ServiceStatus      string                  `json:"service_status" bson:"service_status"`
+	StatusChangedOn    time.Time               `json:"status_changed_on,omitempty" bson:"status_changed_on,omitempty"`
+	StatusChangedBy    string                  `json:"status_changed_by,omitempty" bson:"status_changed_by,omitempty"`
+	Client             []ServiceClientResponse `json:"client" bson:"client"`
+	InvoiceFrequency   string                  `json:"invoice_frequency" bson:"invoice_frequency"`
+	InvoiceAmount      money.Amount            `json:"invoice_amount" bson:"invoice_amount"`
+	ManagementFee      money.Amount            `json:"management_fee" bson:"management_fee"`
+	Currency           string                  `json:"currency" bson:"currency"`
+	CreatedOn          time.Time               `json:"created_on" bson:"created_on,omitempty"`
+	ModifiedOn         time.Time               `json:"modified_on" bson:"modified_on,omitempty"`
+	Version            int64                   `json:"version" bson:"version"`
+}
+
+type ServiceClientResponse struct {
+	ID         string `json:"id" bson:"_id,omitempty"`
+	ClientName string `json:"client_name" bson:"client_name"`
+}
+
+type Clients struct {
+	ClientID primitive.ObjectID `json:"client_id" bson:"_id"`
+}
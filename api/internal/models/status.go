@@ -0,0 +1,79 @@
+package models
+
+import "strings"
+
+// Service statuses, a service moves between them along serviceTransitions
+const (
+	StatusProposed       = "proposed"
+	StatusOnboarding     = "onboarding"
+	StatusActive         = "active"
+	StatusSuspended      = "suspended"
+	StatusDecommissioned = "decommissioned"
+)
+
+// serviceTransitions lists the statuses a service may move to from each status, decommissioned is final
+var serviceTransitions = map[string][]string{
+	StatusProposed:       {StatusOnboarding, StatusDecommissioned},
+	StatusOnboarding:     {StatusActive, StatusDecommissioned},
+	StatusActive:         {StatusSuspended, StatusDecommissioned},
+	StatusSuspended:      {StatusActive, StatusDecommissioned},
+	StatusDecommissioned: {},
+}
+
+// ServiceTransition is the body of a status transition request
+type ServiceTransition struct {
+	To string `json:"to" validate:"required,oneof=proposed onboarding active suspended decommissioned"`
+}
+
+// IsServiceStatus reports whether status is one of the defined service statuses
+func IsServiceStatus(status string) bool {
+	_, ok := serviceTransitions[status]
+	return ok
+}
+
+// legacyServiceStatuses maps the lower case free text statuses services were stored with before the defined set
+// onto the lifecycle
+var legacyServiceStatuses = map[string]string{
+	"planned":     StatusProposed,
+	"prospect":    StatusProposed,
+	"setup":       StatusOnboarding,
+	"in progress": StatusOnboarding,
+	"live":        StatusActive,
+	"running":     StatusActive,
+	"paused":      StatusSuspended,
+	"on hold":     StatusSuspended,
+	"inactive":    StatusSuspended,
+	"cancelled":   StatusDecommissioned,
+	"canceled":    StatusDecommissioned,
+	"terminated":  StatusDecommissioned,
+	"retired":     StatusDecommissioned,
+}
+
+// NextServiceStatuses returns the statuses a service in status may move to, none for a status outside the defined
+// set. Statuses stored before the set was defined are mapped onto it by cmd/migrate.
+func NextServiceStatuses(status string) []string {
+	return serviceTransitions[status]
+}
+
+// MigratedServiceStatus returns the defined status for a status stored before the set was defined, e.g. "Active"
+// becomes active. Free text that doesn't name a status becomes fallback.
+func MigratedServiceStatus(legacy string, fallback string) string {
+	status := strings.ToLower(strings.TrimSpace(legacy))
+	if IsServiceStatus(status) {
+		return status
+	}
+	if migrated, ok := legacyServiceStatuses[status]; ok {
+		return migrated
+	}
+	return fallback
+}
+
+// CanTransition reports whether a service may move from one status to another
+func CanTransition(from string, to string) bool {
+	for _, status := range NextServiceStatuses(from) {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusProposed, StatusOnboarding, true},
+		{StatusProposed, StatusActive, false},
+		{StatusActive, StatusSuspended, true},
+		{StatusSuspended, StatusActive, true},
+		{StatusDecommissioned, StatusActive, false},
+		// statuses from before the lifecycle have to be migrated
+		{"Tools", StatusActive, false},
+	}
+	for _, test := range tests {
+		if got := CanTransition(test.from, test.to); got != test.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestMigratedServiceStatus(t *testing.T) {
+	tests := map[string]string{
+		"Active":     StatusActive,
+		" SUSPENDED": StatusSuspended,
+		"On hold":    StatusSuspended,
+		"Cancelled":  StatusDecommissioned,
+		"Tools":      StatusProposed,
+		"":           StatusProposed,
+	}
+	for legacy, want := range tests {
+		if got := MigratedServiceStatus(legacy, StatusProposed); got != want {
+			t.Errorf("MigratedServiceStatus(%q) = %q, want %q", legacy, got, want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TrashItem is a deleted client, service or contact waiting to be restored or purged
+type TrashItem struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Type      string             `json:"type" bson:"type"`
+	Title     string             `json:"title" bson:"title"`
+	DeletedOn time.Time          `json:"deleted_on" bson:"deleted_on"`
+	DeletedBy string             `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+}
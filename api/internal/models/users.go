@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// User is a person logging in with a password to get a token, only the bcrypt hash of the password is stored
+type User struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Username     string             `json:"username" bson:"username"`
+	PasswordHash string             `json:"-" bson:"password_hash"`
+	Roles        []string           `json:"roles" bson:"roles"`
+	CreatedOn    time.Time          `json:"created_on,omitempty" bson:"created_on,omitempty"`
+	DisabledOn   *time.Time         `json:"disabled_on,omitempty" bson:"disabled_on,omitempty"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook delivery statuses, dead deliveries ran out of attempts and are only retried when redelivered
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook subscribes a URL to the change events of clients, services and contacts. Events are filtered by type,
+// e.g. service.updated, all the events of an entity, e.g. client.*, or every event with *. The payloads are signed
+// with the secret, which is only returned when the webhook is created.
+type Webhook struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	URL         string             `json:"url" bson:"url" validate:"required,url"`
+	Events      []string           `json:"events" bson:"events" validate:"required,min=1,dive,event"`
+	Description string             `json:"description" bson:"description"`
+	// Disabled webhooks get no new deliveries, their pending deliveries are dead-lettered
+	Disabled   bool      `json:"disabled" bson:"disabled"`
+	Secret     string    `json:"secret,omitempty" bson:"secret"`
+	CreatedBy  string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedOn  time.Time `json:"created_on,omitempty" bson:"created_on,omitempty"`
+	ModifiedOn time.Time `json:"modified_on,omitempty" bson:"modified_on,omitempty"`
+	Version    int64     `json:"version" bson:"version"`
+}
+
+// Event is the payload delivered to webhooks when a client, service or contact changes, Data is the document after
+// the change or, for deletes, before it. Data is null when the document isn't at hand, e.g. for the services deleted
+// with their client.
+type Event struct {
+	ID         primitive.ObjectID `json:"id"`
+	Type       string             `json:"type"`
+	OccurredOn time.Time          `json:"occurred_on"`
+	Actor      string             `json:"actor"`
+	RequestID  string             `json:"request_id,omitempty"`
+	Entity     string             `json:"entity"`
+	EntityID   primitive.ObjectID `json:"entity_id"`
+	Data       interface{}        `json:"data"`
+}
+
+// WebhookDelivery is an event queued for a webhook and the log of the attempts to deliver it. Payload is the
+// signed body, Failures counts the failed attempts since the delivery was queued or redelivered.
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	WebhookID     primitive.ObjectID `json:"webhook_id" bson:"webhook_id"`
+	EventID       primitive.ObjectID `json:"event_id" bson:"event_id"`
+	Event         string             `json:"event" bson:"event"`
+	Payload       json.RawMessage    `json:"payload" bson:"payload"`
+	Status        string             `json:"status" bson:"status"`
+	Failures      int                `json:"failures" bson:"failures"`
+	Attempts      []DeliveryAttempt  `json:"attempts" bson:"attempts"`
+	NextAttemptOn *time.Time         `json:"next_attempt_on,omitempty" bson:"next_attempt_on,omitempty"`
+	CreatedOn     time.Time          `json:"created_on" bson:"created_on"`
+	DeliveredOn   *time.Time         `json:"delivered_on,omitempty" bson:"delivered_on,omitempty"`
+}
+
+// DeliveryAttempt is the outcome of one attempt to deliver an event, ResponseStatus is 0 when no response was
+// received
+type DeliveryAttempt struct {
+	AttemptedOn    time.Time `json:"attempted_on" bson:"attempted_on"`
+	ResponseStatus int       `json:"response_status,omitempty" bson:"response_status,omitempty"`
+	Error          string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMS     int64     `json:"duration_ms" bson:"duration_ms"`
+}
@@ -0,0 +1,167 @@
+// Package money holds the exact decimal amounts and the ISO 4217 currencies services are billed in
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Amount is an exact decimal amount of money. It is stored as a Decimal128 in mongoDB and rendered as a json
+// number, json strings are accepted as well so clients can send amounts without going through a float.
+// The zero value is 0.
+type Amount struct {
+	value decimal.Decimal
+}
+
+// Zero is the amount 0
+var Zero = Amount{}
+
+// Parse parses a decimal amount, e.g. "1499.50"
+func Parse(s string) (Amount, error) {
+	value, err := decimal.NewFromString(s)
+	if err != nil {
+		return Zero, fmt.Errorf("invalid amount %q", s)
+	}
+	return Amount{value: value}, nil
+}
+
+// FromFloat returns the shortest decimal representing f, e.g. 0.1 for the float64 0.1. It is meant for amounts
+// stored as doubles before amounts were decimal.
+func FromFloat(f float64) Amount {
+	return Amount{value: decimal.NewFromFloat(f)}
+}
+
+// FromDecimal128 converts a mongoDB decimal, NaN and infinity are refused
+func FromDecimal128(d primitive.Decimal128) (Amount, error) {
+	coefficient, exponent, err := d.BigInt()
+	if err != nil {
+		return Zero, err
+	}
+	return Amount{value: decimal.NewFromBigInt(coefficient, int32(exponent))}, nil
+}
+
+// Decimal128 converts the amount to a mongoDB decimal without trailing zeros, so 1500.00 and 1500 are stored and
+// compared as the same value. Amounts with more than 34 significant digits are refused.
+func (a Amount) Decimal128() (primitive.Decimal128, error) {
+	d, err := primitive.ParseDecimal128(a.value.String())
+	if err != nil {
+		return primitive.Decimal128{}, fmt.Errorf("amount %s doesn't fit a Decimal128", a)
+	}
+	return d, nil
+}
+
+func (a Amount) Add(b Amount) Amount {
+	return Amount{value: a.value.Add(b.value)}
+}
+
+func (a Amount) Mul(b Amount) Amount {
+	return Amount{value: a.value.Mul(b.value)}
+}
+
+// MulFloat multiplies the amount by a factor that isn't money itself, e.g. the 12 months of a year
+func (a Amount) MulFloat(f float64) Amount {
+	return Amount{value: a.value.Mul(decimal.NewFromFloat(f))}
+}
+
+// MulDecimal multiplies the amount by an exact factor that isn't money itself, e.g. the pro-rated part of a
+// billing cycle
+func (a Amount) MulDecimal(d decimal.Decimal) Amount {
+	return Amount{value: a.value.Mul(d)}
+}
+
+// Round rounds half away from zero to the number of decimal places
+func (a Amount) Round(places int32) Amount {
+	return Amount{value: a.value.Round(places)}
+}
+
+func (a Amount) IsZero() bool {
+	return a.value.IsZero()
+}
+
+// Cmp returns -1, 0 or 1 if a is less than, equal to or greater than b
+func (a Amount) Cmp(b Amount) int {
+	return a.value.Cmp(b.value)
+}
+
+// String renders the amount without trailing zeros, e.g. 1499.5
+func (a Amount) String() string {
+	return a.value.String()
+}
+
+// StringFixed renders the amount with exactly the number of decimal places, e.g. 1499.50
+func (a Amount) StringFixed(places int32) string {
+	return a.value.StringFixed(places)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.value.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*a = Zero
+		return nil
+	}
+
+	// "1499.50" and 1499.50 are both accepted
+	text := string(data)
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	} else if !json.Valid(data) {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d, err := a.Decimal128()
+	if err != nil {
+		return 0, nil, err
+	}
+	return bsontype.Decimal128, bsoncore.AppendDecimal128(nil, d), nil
+}
+
+// UnmarshalBSONValue decodes decimals and, for documents that weren't migrated yet, doubles and integers
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+
+	switch t {
+	case bsontype.Decimal128:
+		parsed, err := FromDecimal128(value.Decimal128())
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case bsontype.Double:
+		*a = FromFloat(value.Double())
+	case bsontype.Int32:
+		*a = Amount{value: decimal.NewFromInt32(value.Int32())}
+	case bsontype.Int64:
+		*a = Amount{value: decimal.NewFromInt(value.Int64())}
+	case bsontype.String:
+		parsed, err := Parse(value.StringValue())
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case bsontype.Null, bsontype.Undefined:
+		*a = Zero
+	default:
+		return fmt.Errorf("cannot decode %s into an amount", t)
+	}
+
+	return nil
+}
@@ -0,0 +1,608 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryDB holds the documents of an in-memory store, all collections share one lock so lookups see a
+// consistent state
+type memoryDB struct {
+	mu       sync.RWMutex
+	clients  map[primitive.ObjectID]models.ClientBase
+	services map[primitive.ObjectID]models.ServiceBase
+	contacts map[primitive.ObjectID]models.ContactsBase
+	invoices map[primitive.ObjectID]models.Invoice
+	apiKeys  map[primitive.ObjectID]models.APIKey
+	users    map[primitive.ObjectID]models.User
+	audit    []models.AuditEntry
+	// webhooks and the queue of their deliveries
+	webhooks   map[primitive.ObjectID]models.Webhook
+	deliveries map[primitive.ObjectID]models.WebhookDelivery
+	// invoiceNumbers holds the last invoice number issued in each year
+	invoiceNumbers map[int]int64
+	// transaction serializes the transactions, each one holds it from its snapshot to its commit or rollback
+	transaction   sync.Mutex
+	inTransaction bool
+	// changes is the log of the last changes, changeSeq is the sequence number of the last change and published the
+	// one of the last change the streams can see. changeSignal is closed when changes are published.
+	changes      []models.Change
+	changeSeq    int64
+	published    int64
+	changeSignal chan struct{}
+}
+
+// NewMemoryStore returns a Store keeping all documents in memory, it behaves like the mongoDB store
+// and is meant for tests and running the API without a database
+func NewMemoryStore() *Store {
+	db := &memoryDB{
+		clients:  map[primitive.ObjectID]models.ClientBase{},
+		services: map[primitive.ObjectID]models.ServiceBase{},
+		contacts: map[primitive.ObjectID]models.ContactsBase{},
+		invoices: map[primitive.ObjectID]models.Invoice{},
+		apiKeys:  map[primitive.ObjectID]models.APIKey{},
+		users:    map[primitive.ObjectID]models.User{},
+
+		webhooks:   map[primitive.ObjectID]models.Webhook{},
+		deliveries: map[primitive.ObjectID]models.WebhookDelivery{},
+
+		invoiceNumbers: map[int]int64{},
+
+		changeSignal: make(chan struct{}),
+	}
+
+	return &Store{
+		Clients:  &memoryClients{db: db},
+		Services: &memoryServices{db: db},
+		Contacts: &memoryContacts{db: db},
+		Invoices: &memoryInvoices{db: db},
+		APIKeys:  &memoryAPIKeys{db: db},
+		Users:    &memoryUsers{db: db},
+		Audit:    &memoryAudit{db: db},
+
+		Webhooks:     &memoryWebhooks{db: db},
+		Deliveries:   &memoryDeliveries{db: db},
+		Transactions: &memoryTransactions{db: db},
+		Changes:      &memoryChanges{db: db},
+	}
+}
+
+// memoryTransactions rolls a transaction back by restoring a snapshot of the documents taken when it started.
+// Transactions run one at a time but aren't isolated from the calls made outside of them, a rollback also undoes
+// those, which is good enough for tests.
+type memoryTransactions struct {
+	db *memoryDB
+}
+
+func (m *memoryTransactions) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.db.transaction.Lock()
+	defer m.db.transaction.Unlock()
+
+	snapshot := m.db.snapshot()
+	m.db.mu.Lock()
+	m.db.inTransaction = true
+	m.db.mu.Unlock()
+
+	err := fn(ctx)
+	if err != nil {
+		m.db.restore(snapshot)
+	}
+
+	// the change streams only see the changes of committed transactions
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+	m.db.inTransaction = false
+	if err != nil {
+		m.db.discardChanges()
+		return err
+	}
+	m.db.publishChanges()
+	return nil
+}
+
+// snapshot returns a copy of the documents, the documents are replaced and never changed in place so copying
+// the maps is enough
+func (db *memoryDB) snapshot() *memoryDB {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return &memoryDB{
+		clients:        copyMap(db.clients),
+		services:       copyMap(db.services),
+		contacts:       copyMap(db.contacts),
+		invoices:       copyMap(db.invoices),
+		apiKeys:        copyMap(db.apiKeys),
+		users:          copyMap(db.users),
+		audit:          db.audit[:len(db.audit):len(db.audit)],
+		webhooks:       copyMap(db.webhooks),
+		deliveries:     copyMap(db.deliveries),
+		invoiceNumbers: copyMap(db.invoiceNumbers),
+	}
+}
+
+// restore replaces the documents with the ones of snapshot
+func (db *memoryDB) restore(snapshot *memoryDB) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.clients, db.services, db.contacts = snapshot.clients, snapshot.services, snapshot.contacts
+	db.invoices, db.apiKeys, db.users, db.audit = snapshot.invoices, snapshot.apiKeys, snapshot.users, snapshot.audit
+	db.webhooks, db.deliveries = snapshot.webhooks, snapshot.deliveries
+	db.invoiceNumbers = snapshot.invoiceNumbers
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	copied := make(map[K]V, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
+
+// toDocument converts a model into its bson representation, so filters and sorting use the document paths
+func toDocument(v interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	document := bson.M{}
+	err = bson.Unmarshal(raw, &document)
+	return document, err
+}
+
+// applyChanges mimics $set and $unset on the marshalled fields of current, the result is decoded into out
+func applyChanges(current interface{}, changes Changes, out interface{}) error {
+	document, err := toDocument(current)
+	if err != nil {
+		return err
+	}
+
+	for field, value := range changes.Set {
+		document[field] = value
+	}
+	for _, field := range changes.Unset {
+		delete(document, field)
+	}
+
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+// selectDocuments applies the filters, text search, sorting and pagination of opts and returns the indexes
+// of the documents on the page, their text search scores and the total number of matching documents
+func selectDocuments(documents []bson.M, opts ListOptions, index textIndex) ([]int, []float64, int) {
+	if opts.Query == "" {
+		return selectScored(documents, opts, nil)
+	}
+
+	// like $text, a query without any term matches nothing
+	terms := searchTerms(opts.Query)
+	return selectScored(documents, opts, func(document bson.M) float64 {
+		return textScore(document, index, terms)
+	})
+}
+
+// selectScored is selectDocuments with the documents matching the query of opts selected by score, a document is
+// left out when its score is 0. Without score every document matches the query.
+func selectScored(documents []bson.M, opts ListOptions, score func(document bson.M) float64) ([]int, []float64, int) {
+	scores := make([]float64, len(documents))
+
+	var matched []int
+	for i, document := range documents {
+		if score != nil {
+			scores[i] = score(document)
+			if scores[i] == 0 {
+				continue
+			}
+		}
+		if matchFilters(document, opts.Filters) {
+			matched = append(matched, i)
+		}
+	}
+
+	order := opts.Order
+	if order == 0 {
+		order = 1
+	}
+
+	sort.SliceStable(matched, func(a, b int) bool {
+		i, j := matched[a], matched[b]
+
+		result := 0
+		if opts.Sort == ScoreField {
+			result = compareValues(scores[i], scores[j])
+		} else if opts.Sort != "" {
+			result = compareValues(firstValue(documents[i], opts.Sort), firstValue(documents[j], opts.Sort))
+		}
+		// _id is the tie breaker, like in the mongoDB pipelines
+		if result == 0 {
+			result = compareValues(documents[i]["_id"], documents[j]["_id"])
+		}
+
+		return result*order < 0
+	})
+
+	total := len(matched)
+	start, end := opts.Start, total
+	if start > total {
+		start = total
+	}
+	if opts.End > 0 && opts.End < end {
+		end = opts.End
+	}
+	if end < start {
+		end = start
+	}
+
+	page := matched[start:end]
+	pageScores := make([]float64, len(page))
+	for i, index := range page {
+		pageScores[i] = scores[index]
+	}
+
+	return page, pageScores, total
+}
+
+// memorySearch ranks the documents by their text score and returns up to limit hits and the number of matches,
+// like mongoSearch. A query that matches no word is searched again as fragments of words.
+func memorySearch(documents []bson.M, index textIndex, query string, limit int) ([]models.SearchHit, int) {
+	opts := ListOptions{Query: query, Sort: ScoreField, Order: -1, End: limit}
+	page, scores, total := selectDocuments(documents, opts, index)
+	if terms := fragmentTerms(query); total == 0 && len(terms) > 0 {
+		page, scores, total = selectScored(documents, opts, func(document bson.M) float64 {
+			return fragmentScore(document, index, terms)
+		})
+	}
+
+	hits := []models.SearchHit{}
+	for i, position := range page {
+		document := documents[position]
+		title, _ := document[index.Title].(string)
+		description, _ := document[index.Description].(string)
+		id, _ := document["_id"].(primitive.ObjectID)
+
+		hits = append(hits, models.SearchHit{
+			ID:          id,
+			Type:        index.Type,
+			Title:       title,
+			Description: description,
+			Score:       scores[i],
+		})
+	}
+
+	return hits, total
+}
+
+// memoryTrash returns up to limit of the deleted documents, most recently deleted first, and the number of deleted
+// documents, like mongoTrash
+func memoryTrash(documents []bson.M, index textIndex, limit int) ([]models.TrashItem, int) {
+	page, _, total := selectDocuments(documents, ListOptions{Sort: "deleted_on", Order: -1, End: limit}, index)
+
+	items := []models.TrashItem{}
+	for _, position := range page {
+		document := documents[position]
+		id, _ := document["_id"].(primitive.ObjectID)
+		title, _ := document[index.Title].(string)
+		deletedOn, _ := document["deleted_on"].(primitive.DateTime)
+		deletedBy, _ := document["deleted_by"].(string)
+
+		items = append(items, models.TrashItem{
+			ID:        id,
+			Type:      index.Type,
+			Title:     title,
+			DeletedOn: deletedOn.Time(),
+			DeletedBy: deletedBy,
+		})
+	}
+
+	return items, total
+}
+
+// searchTerms splits a text search query into lower case terms, negated terms are ignored
+func searchTerms(query string) []string {
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		if strings.HasPrefix(term, "-") {
+			continue
+		}
+		terms = append(terms, tokenize(term)...)
+	}
+	return terms
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// textScore approximates the mongoDB text score as the weighted number of terms found in the indexed fields
+func textScore(document bson.M, index textIndex, terms []string) float64 {
+	score := 0.0
+	for _, weight := range index.Weights {
+		text, _ := document[weight.Key].(string)
+		words := map[string]bool{}
+		for _, word := range tokenize(text) {
+			words[word] = true
+		}
+
+		for _, term := range terms {
+			if words[term] {
+				score += float64(weight.Value.(int))
+			}
+		}
+	}
+	return score
+}
+
+// fragmentScore returns the weighted score of the fragments found in the indexed fields, like the score of the
+// fragment search of mongoSearch, it is 0 unless every fragment is found in one of the fields
+func fragmentScore(document bson.M, index textIndex, terms []searchTerm) float64 {
+	score := 0
+	for _, term := range terms {
+		termScore := 0
+		for _, weight := range index.Weights {
+			text, _ := document[weight.Key].(string)
+			termScore += term.score(text, weight.Value.(int))
+		}
+		if termScore == 0 {
+			return 0
+		}
+		score += termScore
+	}
+	return float64(score)
+}
+
+// matchFilters returns true if the document matches all filters, with mongoDB semantics for arrays:
+// a filter matches if any element matches, $ne and $nin match if no element matches
+func matchFilters(document bson.M, filters []Filter) bool {
+	for _, filter := range filters {
+		values := lookupPath(document, filter.Path)
+
+		switch filter.Operator {
+		case OpNe:
+			if containsValue(values, filter.Value) {
+				return false
+			}
+		case OpNin:
+			for _, candidate := range filter.Value.([]interface{}) {
+				if containsValue(values, candidate) {
+					return false
+				}
+			}
+		case OpIn:
+			found := false
+			for _, candidate := range filter.Value.([]interface{}) {
+				if containsValue(values, candidate) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			found := false
+			for _, value := range values {
+				if compareFilter(value, filter.Operator, filter.Value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func compareFilter(value interface{}, operator string, expected interface{}) bool {
+	// range operators only compare values of the same type, like mongoDB does
+	if typeRank(value) != typeRank(expected) {
+		return false
+	}
+
+	result := compareValues(value, expected)
+	switch operator {
+	case OpEq:
+		return result == 0
+	case OpGt:
+		return result > 0
+	case OpGte:
+		return result >= 0
+	case OpLt:
+		return result < 0
+	case OpLte:
+		return result <= 0
+	}
+	return false
+}
+
+func containsValue(values []interface{}, expected interface{}) bool {
+	for _, value := range values {
+		if compareFilter(value, OpEq, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPath returns all values at a dotted path, descending into arrays of documents
+func lookupPath(value interface{}, path string) []interface{} {
+	if path == "" {
+		if array, ok := value.(primitive.A); ok {
+			return array
+		}
+		return []interface{}{value}
+	}
+
+	key, rest := path, ""
+	if dot := strings.Index(path, "."); dot >= 0 {
+		key, rest = path[:dot], path[dot+1:]
+	}
+
+	switch v := value.(type) {
+	case bson.M:
+		child, ok := v[key]
+		if !ok {
+			return nil
+		}
+		return lookupPath(child, rest)
+	case primitive.D:
+		return lookupPath(v.Map(), path)
+	case primitive.A:
+		var values []interface{}
+		for _, element := range v {
+			values = append(values, lookupPath(element, path)...)
+		}
+		return values
+	}
+
+	return nil
+}
+
+func firstValue(document bson.M, path string) interface{} {
+	values := lookupPath(document, path)
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// normalize converts bson values to comparable go values
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case primitive.DateTime:
+		return v.Time()
+	case primitive.Decimal128:
+		// precise enough to compare amounts, the store doesn't do arithmetic on them
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return value
+		}
+		return f
+	}
+	return value
+}
+
+// typeRank orders values of different types like the mongoDB comparison order
+func typeRank(value interface{}) int {
+	switch normalize(value).(type) {
+	case nil:
+		return 0
+	case float64:
+		return 1
+	case string:
+		return 2
+	case primitive.ObjectID:
+		return 3
+	case bool:
+		return 4
+	case time.Time:
+		return 5
+	}
+	return 6
+}
+
+// compareValues returns -1, 0 or 1
+func compareValues(a interface{}, b interface{}) int {
+	rankA, rankB := typeRank(a), typeRank(b)
+	if rankA != rankB {
+		if rankA < rankB {
+			return -1
+		}
+		return 1
+	}
+
+	switch x := normalize(a).(type) {
+	case float64:
+		y := normalize(b).(float64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	case string:
+		return strings.Compare(x, b.(string))
+	case primitive.ObjectID:
+		return strings.Compare(x.Hex(), b.(primitive.ObjectID).Hex())
+	case bool:
+		y := b.(bool)
+		if x != y {
+			if !x {
+				return -1
+			}
+			return 1
+		}
+	case time.Time:
+		y := normalize(b).(time.Time)
+		if x.Before(y) {
+			return -1
+		} else if x.After(y) {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// sliceCursor is a Cursor over documents already in memory
+type sliceCursor struct {
+	documents []interface{}
+	current   int
+}
+
+func (c *sliceCursor) Next(ctx context.Context) bool {
+	if c.current < len(c.documents) {
+		c.current++
+	}
+	return c.current < len(c.documents)
+}
+
+// Decode stores the current document in v, which has to point to a value of the type of the document
+func (c *sliceCursor) Decode(v interface{}) error {
+	if c.current < 0 || c.current >= len(c.documents) {
+		return errors.New("cursor is not positioned on a document")
+	}
+
+	target, document := reflect.ValueOf(v), reflect.ValueOf(c.documents[c.current])
+	if target.Kind() != reflect.Ptr || target.IsNil() || !document.Type().AssignableTo(target.Elem().Type()) {
+		return fmt.Errorf("cannot decode %s into %T", document.Type(), v)
+	}
+
+	target.Elem().Set(document)
+	return nil
+}
+
+func (c *sliceCursor) Err() error {
+	return nil
+}
+
+func (c *sliceCursor) Close(ctx context.Context) error {
+	c.documents = nil
+	return nil
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryAPIKeys struct {
+	db *memoryDB
+}
+
+func (m *memoryAPIKeys) FindByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, key := range m.db.apiKeys {
+		if key.KeyHash == hash {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrNotFound
+}
+
+func (m *memoryAPIKeys) Insert(ctx context.Context, key models.APIKey) (primitive.ObjectID, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// mirrors the unique index on key_hash
+	for _, existing := range m.db.apiKeys {
+		if existing.KeyHash == key.KeyHash {
+			return primitive.NilObjectID, errors.New("duplicate api key hash")
+		}
+	}
+
+	if key.ID.IsZero() {
+		key.ID = primitive.NewObjectID()
+	}
+	m.db.apiKeys[key.ID] = key
+
+	return key.ID, nil
+}
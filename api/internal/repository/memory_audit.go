@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryAudit struct {
+	db *memoryDB
+}
+
+func (m *memoryAudit) Insert(ctx context.Context, entry models.AuditEntry) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	m.db.audit = append(m.db.audit, entry)
+
+	return nil
+}
+
+func (m *memoryAudit) List(ctx context.Context, opts ListOptions) ([]models.AuditEntry, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	documents := make([]bson.M, 0, len(m.db.audit))
+	for _, entry := range m.db.audit {
+		document, err := toDocument(entry)
+		if err != nil {
+			return nil, 0, err
+		}
+		documents = append(documents, document)
+	}
+
+	page, _, total := selectDocuments(documents, opts, textIndex{})
+	entries := []models.AuditEntry{}
+	for _, i := range page {
+		entries = append(entries, m.db.audit[i])
+	}
+
+	return entries, total, nil
+}
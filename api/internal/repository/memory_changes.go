@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryChangeLogSize is the number of changes an in-memory store keeps to resume feeds at
+const memoryChangeLogSize = 1000
+
+// changed appends the change of the document with the id to the change log, document is nil when it is purged.
+// It is called with the lock held right before the document is stored, so the stored document tells what kind of
+// change it is. Changes made in a transaction are only published when it commits.
+func (db *memoryDB) changed(entity string, id primitive.ObjectID, document interface{}) {
+	var previous interface{}
+	var existed bool
+	switch entity {
+	case "clients":
+		previous, existed = db.clients[id]
+	case "services":
+		previous, existed = db.services[id]
+	case "contacts":
+		previous, existed = db.contacts[id]
+	}
+
+	change := models.Change{Entity: entity, Action: models.ChangeUpdated, EntityID: id, OccurredOn: time.Now(), Data: document}
+	switch {
+	case document == nil:
+		change.Action = models.ChangePurged
+	case !existed:
+		change.Action = models.ChangeCreated
+	case deletedOn(previous) == nil && deletedOn(document) != nil:
+		change.Action = models.ChangeDeleted
+	case deletedOn(previous) != nil && deletedOn(document) == nil:
+		change.Action = models.ChangeRestored
+	}
+
+	db.changeSeq++
+	change.Token = strconv.FormatInt(db.changeSeq, 10)
+	db.changes = append(db.changes, change)
+	if len(db.changes) > memoryChangeLogSize {
+		db.changes = append([]models.Change(nil), db.changes[len(db.changes)-memoryChangeLogSize:]...)
+	}
+
+	if !db.inTransaction {
+		db.publishChanges()
+	}
+}
+
+// publishChanges wakes up the streams waiting for the changes logged so far, it is called with the lock held
+func (db *memoryDB) publishChanges() {
+	db.published = db.changeSeq
+	close(db.changeSignal)
+	db.changeSignal = make(chan struct{})
+}
+
+// discardChanges drops the changes that weren't published, it is called with the lock held
+func (db *memoryDB) discardChanges() {
+	unpublished := int(db.changeSeq - db.published)
+	if unpublished > len(db.changes) {
+		unpublished = len(db.changes)
+	}
+	db.changes = db.changes[:len(db.changes)-unpublished]
+	db.changeSeq = db.published
+}
+
+func deletedOn(document interface{}) *time.Time {
+	switch document := document.(type) {
+	case models.ClientBase:
+		return document.DeletedOn
+	case models.ServiceBase:
+		return document.DeletedOn
+	case models.ContactsBase:
+		return document.DeletedOn
+	}
+	return nil
+}
+
+// memoryChanges streams the change log of an in-memory store, the tokens are the sequence numbers of the changes
+type memoryChanges struct {
+	db *memoryDB
+}
+
+func (m *memoryChanges) Watch(ctx context.Context, entities []string, token string) (ChangeStream, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	position := m.db.published
+	if token != "" {
+		seq, err := strconv.ParseInt(token, 10, 64)
+		if err != nil || seq < m.db.oldestChange()-1 || seq > m.db.published {
+			return nil, ErrInvalidToken
+		}
+		position = seq
+	}
+
+	return &memoryChangeStream{db: m.db, entities: entities, position: position}, nil
+}
+
+// oldestChange returns the sequence number of the oldest change in the log, it is called with the lock held
+func (db *memoryDB) oldestChange() int64 {
+	return db.changeSeq - int64(len(db.changes)) + 1
+}
+
+type memoryChangeStream struct {
+	db       *memoryDB
+	entities []string
+	position int64
+	change   models.Change
+	err      error
+}
+
+func (s *memoryChangeStream) TryNext(ctx context.Context) bool {
+	if s.err != nil {
+		return false
+	}
+
+	found, signal := s.next()
+	if found || s.err != nil {
+		return found
+	}
+
+	timer := time.NewTimer(changeStreamWait)
+	defer timer.Stop()
+
+	select {
+	case <-signal:
+	case <-timer.C:
+	case <-ctx.Done():
+		return false
+	}
+
+	found, _ = s.next()
+	return found
+}
+
+// next moves to the next published change of the entities, it returns the signal of the next publication when
+// there is none
+func (s *memoryChangeStream) next() (bool, chan struct{}) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	oldest := s.db.oldestChange()
+	if s.position < oldest-1 {
+		// the stream fell behind the log
+		s.err = ErrInvalidToken
+		return false, nil
+	}
+
+	for seq := s.position + 1; seq <= s.db.published; seq++ {
+		s.position = seq
+		change := s.db.changes[seq-oldest]
+		if containsString(s.entities, change.Entity) {
+			s.change = change
+			return true, nil
+		}
+	}
+	return false, s.db.changeSignal
+}
+
+func (s *memoryChangeStream) Change() models.Change {
+	return s.change
+}
+
+func (s *memoryChangeStream) Token() string {
+	return strconv.FormatInt(s.position, 10)
+}
+
+func (s *memoryChangeStream) Err() error {
+	return s.err
+}
+
+func (s *memoryChangeStream) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,438 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryClients struct {
+	db *memoryDB
+}
+
+// sortedClients returns the clients ordered by id
+func sortedClients(clients map[primitive.ObjectID]models.ClientBase) []models.ClientBase {
+	sorted := make([]models.ClientBase, 0, len(clients))
+	for _, client := range clients {
+		sorted = append(sorted, client)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID.Hex() < sorted[j].ID.Hex()
+	})
+	return sorted
+}
+
+// clientDocuments returns the clients in the trash if deleted is true, the other clients otherwise, and their bson
+// documents in the same order, the caller must hold the lock
+func (db *memoryDB) clientDocuments(deleted bool) ([]models.ClientBase, []bson.M, error) {
+	var clients []models.ClientBase
+	for _, client := range sortedClients(db.clients) {
+		if (client.DeletedOn != nil) == deleted {
+			clients = append(clients, client)
+		}
+	}
+
+	documents := make([]bson.M, 0, len(clients))
+	for _, client := range clients {
+		document, err := toDocument(client)
+		if err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, document)
+	}
+	return clients, documents, nil
+}
+
+// clientResponse joins the services and contacts attached to the client, the caller must hold the lock
+func (db *memoryDB) clientResponse(client models.ClientBase) models.ClientResponse {
+	response := models.ClientResponse{
+		ID:             client.ID,
+		ClientName:     client.ClientName,
+		SlackChannel:   client.SlackChannel,
+		WebUrl:         client.WebUrl,
+		MangedServices: []models.ClientsManagedServicesResponse{},
+		ClientContacts: []models.ClientsContactResponse{},
+		CreatedOn:      client.CreatedOn,
+		ModifiedOn:     client.ModifiedOn,
+		Version:        client.Version,
+	}
+
+	// services and contacts in the trash aren't joined
+	for _, service := range sortedServices(db.services) {
+		if service.DeletedOn == nil && attachedTo(service.AttachedToClient, client.ID) {
+			response.MangedServices = append(response.MangedServices, models.ClientsManagedServicesResponse{
+				ID:               service.ID,
+				ServiceName:      service.ServiceName,
+				ServiceType:      service.ServiceType,
+				ServiceStatus:    service.ServiceStatus,
+				InvoiceFrequency: service.InvoiceFrequency,
+				InvoiceAmount:    service.InvoiceAmount,
+				ManagementFee:    service.ManagementFee,
+				Currency:         service.Currency,
+			})
+		}
+	}
+
+	for _, contact := range sortedContacts(db.contacts) {
+		if contact.DeletedOn == nil && attachedTo(contact.AttachedToClient, client.ID) {
+			response.ClientContacts = append(response.ClientContacts, models.ClientsContactResponse{
+				ID:          contact.ID,
+				FirstName:   contact.FirstName,
+				LastName:    contact.LastName,
+				FullName:    contact.FullName,
+				Email:       contact.Email,
+				PhoneNumber: contact.PhoneNumber,
+				Role:        contact.Role,
+			})
+		}
+	}
+
+	return response
+}
+
+// attachedTo returns true if the client id is in the attached_to_client list
+func attachedTo(clients []models.Clients, id primitive.ObjectID) bool {
+	for _, client := range clients {
+		if client.ClientID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryClients) List(ctx context.Context, opts ListOptions) ([]models.ClientResponse, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	clients, documents, err := m.db.clientDocuments(false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, _, total := selectDocuments(documents, opts, clientsTextIndex)
+	responses := []models.ClientResponse{}
+	for _, i := range page {
+		responses = append(responses, m.db.clientResponse(clients[i]))
+	}
+
+	return responses, total, nil
+}
+
+func (m *memoryClients) Export(ctx context.Context, opts ListOptions) (Cursor, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	clients, documents, err := m.db.clientDocuments(false)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Start, opts.End = 0, 0
+	matched, _, _ := selectDocuments(documents, opts, clientsTextIndex)
+	cursor := &sliceCursor{current: -1}
+	for _, i := range matched {
+		cursor.documents = append(cursor.documents, m.db.clientResponse(clients[i]))
+	}
+
+	return cursor, nil
+}
+
+func (m *memoryClients) Get(ctx context.Context, id primitive.ObjectID) (models.ClientResponse, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	client, ok := m.db.clients[id]
+	if !ok || client.DeletedOn != nil {
+		return models.ClientResponse{}, ErrNotFound
+	}
+
+	return m.db.clientResponse(client), nil
+}
+
+func (m *memoryClients) Find(ctx context.Context, id primitive.ObjectID) (models.ClientBase, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	client, ok := m.db.clients[id]
+	if !ok || client.DeletedOn != nil {
+		return models.ClientBase{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (m *memoryClients) NameExists(ctx context.Context, name string) (bool, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, client := range m.db.clients {
+		if client.DeletedOn == nil && client.ClientName == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryClients) FindByNames(ctx context.Context, names []string) ([]models.ClientBase, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	clients := []models.ClientBase{}
+	for _, client := range m.db.clients {
+		if client.DeletedOn == nil && wanted[client.ClientName] {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+func (m *memoryClients) Missing(ctx context.Context, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	var missing []primitive.ObjectID
+	for _, id := range ids {
+		if client, ok := m.db.clients[id]; !ok || client.DeletedOn != nil {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+func (m *memoryClients) Insert(ctx context.Context, client models.ClientBase) (primitive.ObjectID, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if client.ID.IsZero() {
+		client.ID = primitive.NewObjectID()
+	}
+	client.Version = 1
+	m.db.changed("clients", client.ID, client)
+	m.db.clients[client.ID] = client
+
+	return client.ID, nil
+}
+
+func (m *memoryClients) Replace(ctx context.Context, id primitive.ObjectID, version int64, client models.ClientBase) (models.ClientBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.clients[id]
+	if !ok || current.DeletedOn != nil {
+		return models.ClientBase{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.ClientBase{}, ErrVersionConflict
+	}
+
+	// round trip through bson like a stored document
+	var replaced models.ClientBase
+	if err := applyChanges(client, Changes{}, &replaced); err != nil {
+		return models.ClientBase{}, err
+	}
+	replaced.ID, replaced.Version = id, version+1
+	m.db.changed("clients", id, replaced)
+	m.db.clients[id] = replaced
+
+	return replaced, nil
+}
+
+func (m *memoryClients) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ClientBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.clients[id]
+	if !ok || current.DeletedOn != nil {
+		return models.ClientBase{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.ClientBase{}, ErrVersionConflict
+	}
+
+	var patched models.ClientBase
+	if err := applyChanges(current, changes, &patched); err != nil {
+		return models.ClientBase{}, err
+	}
+	patched.ID, patched.Version = id, version+1
+	m.db.changed("clients", id, patched)
+	m.db.clients[id] = patched
+
+	return patched, nil
+}
+
+func (m *memoryClients) Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string, cascade string) ([]models.Dependent, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	client, ok := m.db.clients[id]
+	if !ok || client.DeletedOn != nil {
+		return nil, ErrNotFound
+	}
+	if client.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	now := time.Now()
+
+	// the dependents are collected first so nothing is changed when the delete is restricted
+	var dependents []models.Dependent
+	for _, service := range sortedServices(m.db.services) {
+		if service.DeletedOn == nil && attachedTo(service.AttachedToClient, id) {
+			dependents = append(dependents, models.Dependent{
+				ID:     service.ID,
+				Type:   servicesTextIndex.Type,
+				Title:  service.ServiceName,
+				Action: cascadeAction(cascade, service.AttachedToClient, id),
+			})
+		}
+	}
+	for _, contact := range sortedContacts(m.db.contacts) {
+		if contact.DeletedOn == nil && attachedTo(contact.AttachedToClient, id) {
+			dependents = append(dependents, models.Dependent{
+				ID:     contact.ID,
+				Type:   contactsTextIndex.Type,
+				Title:  contact.FullName,
+				Action: cascadeAction(cascade, contact.AttachedToClient, id),
+			})
+		}
+	}
+
+	if cascade == CascadeRestrict && len(dependents) > 0 {
+		return dependents, ErrHasDependents
+	}
+
+	for i, dependent := range dependents {
+		switch dependent.Type {
+		case servicesTextIndex.Type:
+			service := m.db.services[dependent.ID]
+			dependents[i].Before = service
+			if dependent.Action == CascadeDelete {
+				service.DeletedOn, service.DeletedBy = &now, deletedBy
+			} else {
+				service.AttachedToClient, service.ModifiedOn = detach(service.AttachedToClient, id), now
+			}
+			service.Version++
+			if dependent.Action == CascadeDetach {
+				dependents[i].After = service
+			}
+			m.db.changed("services", service.ID, service)
+			m.db.services[service.ID] = service
+		case contactsTextIndex.Type:
+			contact := m.db.contacts[dependent.ID]
+			dependents[i].Before = contact
+			if dependent.Action == CascadeDelete {
+				contact.DeletedOn, contact.DeletedBy = &now, deletedBy
+			} else {
+				contact.AttachedToClient, contact.ModifiedOn = detach(contact.AttachedToClient, id), now
+			}
+			contact.Version++
+			if dependent.Action == CascadeDetach {
+				dependents[i].After = contact
+			}
+			m.db.changed("contacts", contact.ID, contact)
+			m.db.contacts[contact.ID] = contact
+		}
+	}
+
+	client.DeletedOn, client.DeletedBy = &now, deletedBy
+	client.Version++
+	m.db.changed("clients", id, client)
+	m.db.clients[id] = client
+
+	return dependents, nil
+}
+
+// cascadeAction returns the action the cascade policy applies to a document attached to the client, like the
+// mongoDB store it only deletes documents that aren't attached to other clients
+func cascadeAction(cascade string, attached []models.Clients, id primitive.ObjectID) string {
+	switch cascade {
+	case CascadeRestrict:
+		return ""
+	case CascadeDelete:
+		for _, reference := range attached {
+			if reference.ClientID != id {
+				return CascadeDetach
+			}
+		}
+		return CascadeDelete
+	}
+	return CascadeDetach
+}
+
+// detach returns the attached_to_client list without the client, like $pull
+func detach(attached []models.Clients, id primitive.ObjectID) []models.Clients {
+	remaining := []models.Clients{}
+	for _, reference := range attached {
+		if reference.ClientID != id {
+			remaining = append(remaining, reference)
+		}
+	}
+	return remaining
+}
+
+func (m *memoryClients) Restore(ctx context.Context, id primitive.ObjectID) (models.ClientBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	client, ok := m.db.clients[id]
+	if !ok || client.DeletedOn == nil {
+		return models.ClientBase{}, ErrNotFound
+	}
+
+	client.DeletedOn, client.DeletedBy = nil, ""
+	client.Version++
+	m.db.changed("clients", id, client)
+	m.db.clients[id] = client
+
+	return client, nil
+}
+
+func (m *memoryClients) Trash(ctx context.Context, limit int) ([]models.TrashItem, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	_, documents, err := m.db.clientDocuments(true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, total := memoryTrash(documents, clientsTextIndex, limit)
+	return items, total, nil
+}
+
+func (m *memoryClients) Purge(ctx context.Context, before time.Time) (int, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	purged := 0
+	for id, client := range m.db.clients {
+		if client.DeletedOn != nil && client.DeletedOn.Before(before) {
+			m.db.changed("clients", id, nil)
+			delete(m.db.clients, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (m *memoryClients) Search(ctx context.Context, query string, limit int) ([]models.SearchHit, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	_, documents, err := m.db.clientDocuments(false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits, total := memorySearch(documents, clientsTextIndex, query, limit)
+	return hits, total, nil
+}
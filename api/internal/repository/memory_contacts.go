@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryContacts struct {
+	db *memoryDB
+}
+
+// sortedContacts returns the contacts ordered by id
+func sortedContacts(contacts map[primitive.ObjectID]models.ContactsBase) []models.ContactsBase {
+	sorted := make([]models.ContactsBase, 0, len(contacts))
+	for _, contact := range contacts {
+		sorted = append(sorted, contact)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID.Hex() < sorted[j].ID.Hex()
+	})
+	return sorted
+}
+
+// contactDocuments returns the contacts in the trash if deleted is true, the other contacts otherwise, and their bson
+// documents in the same order, the caller must hold the lock
+func (db *memoryDB) contactDocuments(deleted bool) ([]models.ContactsBase, []bson.M, error) {
+	var contacts []models.ContactsBase
+	for _, contact := range sortedContacts(db.contacts) {
+		if (contact.DeletedOn != nil) == deleted {
+			contacts = append(contacts, contact)
+		}
+	}
+
+	documents := make([]bson.M, 0, len(contacts))
+	for _, contact := range contacts {
+		document, err := toDocument(contact)
+		if err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, document)
+	}
+	return contacts, documents, nil
+}
+
+// contactResponse joins the clients the contact is attached to, the caller must hold the lock
+func (db *memoryDB) contactResponse(contact models.ContactsBase) models.ContactResponse {
+	response := models.ContactResponse{
+		ID:          contact.ID,
+		FirstName:   contact.FirstName,
+		LastName:    contact.LastName,
+		FullName:    contact.FullName,
+		Email:       contact.Email,
+		PhoneNumber: contact.PhoneNumber,
+		Client:      []models.ContactClientResponse{},
+		Role:        contact.Role,
+		CreatedOn:   contact.CreatedOn,
+		ModifiedOn:  contact.ModifiedOn,
+		Version:     contact.Version,
+	}
+
+	for _, client := range db.attachedClients(contact.AttachedToClient) {
+		response.Client = append(response.Client, models.ContactClientResponse{
+			ID:         client.ID,
+			ClientName: client.ClientName,
+		})
+	}
+
+	return response
+}
+
+func (m *memoryContacts) List(ctx context.Context, opts ListOptions) ([]models.ContactResponse, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	contacts, documents, err := m.db.contactDocuments(false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, _, total := selectDocuments(documents, opts, contactsTextIndex)
+	responses := []models.ContactResponse{}
+	for _, i := range page {
+		responses = append(responses, m.db.contactResponse(contacts[i]))
+	}
+
+	return responses, total, nil
+}
+
+func (m *memoryContacts) Export(ctx context.Context, opts ListOptions) (Cursor, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	contacts, documents, err := m.db.contactDocuments(false)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Start, opts.End = 0, 0
+	matched, _, _ := selectDocuments(documents, opts, contactsTextIndex)
+	cursor := &sliceCursor{current: -1}
+	for _, i := range matched {
+		cursor.documents = append(cursor.documents, m.db.contactResponse(contacts[i]))
+	}
+
+	return cursor, nil
+}
+
+func (m *memoryContacts) Get(ctx context.Context, id primitive.ObjectID) (models.ContactResponse, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	contact, ok := m.db.contacts[id]
+	if !ok || contact.DeletedOn != nil {
+		return models.ContactResponse{}, ErrNotFound
+	}
+
+	return m.db.contactResponse(contact), nil
+}
+
+func (m *memoryContacts) Find(ctx context.Context, id primitive.ObjectID) (models.ContactsBase, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	contact, ok := m.db.contacts[id]
+	if !ok || contact.DeletedOn != nil {
+		return models.ContactsBase{}, ErrNotFound
+	}
+	return contact, nil
+}
+
+func (m *memoryContacts) Insert(ctx context.Context, contact models.ContactsBase) (primitive.ObjectID, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if contact.ID.IsZero() {
+		contact.ID = primitive.NewObjectID()
+	}
+	contact.Version = 1
+	m.db.changed("contacts", contact.ID, contact)
+	m.db.contacts[contact.ID] = contact
+
+	return contact.ID, nil
+}
+
+func (m *memoryContacts) Replace(ctx context.Context, id primitive.ObjectID, version int64, contact models.ContactsBase) (models.ContactsBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.contacts[id]
+	if !ok || current.DeletedOn != nil {
+		return models.ContactsBase{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.ContactsBase{}, ErrVersionConflict
+	}
+
+	// round trip through bson like a stored document
+	var replaced models.ContactsBase
+	if err := applyChanges(contact, Changes{}, &replaced); err != nil {
+		return models.ContactsBase{}, err
+	}
+	replaced.ID, replaced.Version = id, version+1
+	m.db.changed("contacts", id, replaced)
+	m.db.contacts[id] = replaced
+
+	return replaced, nil
+}
+
+func (m *memoryContacts) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ContactsBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.contacts[id]
+	if !ok || current.DeletedOn != nil {
+		return models.ContactsBase{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.ContactsBase{}, ErrVersionConflict
+	}
+
+	var patched models.ContactsBase
+	if err := applyChanges(current, changes, &patched); err != nil {
+		return models.ContactsBase{}, err
+	}
+	patched.ID, patched.Version = id, version+1
+	m.db.changed("contacts", id, patched)
+	m.db.contacts[id] = patched
+
+	return patched, nil
+}
+
+func (m *memoryContacts) Attach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ContactsBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	contact, ok := m.db.contacts[id]
+	if !ok || contact.DeletedOn != nil {
+		return models.ContactsBase{}, ErrNotFound
+	}
+	if attachedTo(contact.AttachedToClient, clientID) {
+		return contact, nil
+	}
+
+	contact.AttachedToClient = append(contact.AttachedToClient, models.Clients{ClientID: clientID})
+	contact.ModifiedOn = time.Now()
+	contact.Version++
+	m.db.changed("contacts", id, contact)
+	m.db.contacts[id] = contact
+
+	return contact, nil
+}
+
+func (m *memoryContacts) Detach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ContactsBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	contact, ok := m.db.contacts[id]
+	if !ok || contact.DeletedOn != nil || !attachedTo(contact.AttachedToClient, clientID) {
+		return models.ContactsBase{}, ErrNotFound
+	}
+
+	contact.AttachedToClient = detach(contact.AttachedToClient, clientID)
+	contact.ModifiedOn = time.Now()
+	contact.Version++
+	m.db.changed("contacts", id, contact)
+	m.db.contacts[id] = contact
+
+	return contact, nil
+}
+
+func (m *memoryContacts) Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	contact, ok := m.db.contacts[id]
+	if !ok || contact.DeletedOn != nil {
+		return ErrNotFound
+	}
+	if contact.Version != version {
+		return ErrVersionConflict
+	}
+
+	now := time.Now()
+	contact.DeletedOn, contact.DeletedBy = &now, deletedBy
+	contact.Version++
+	m.db.changed("contacts", id, contact)
+	m.db.contacts[id] = contact
+
+	return nil
+}
+
+func (m *memoryContacts) Restore(ctx context.Context, id primitive.ObjectID) (models.ContactsBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	contact, ok := m.db.contacts[id]
+	if !ok || contact.DeletedOn == nil {
+		return models.ContactsBase{}, ErrNotFound
+	}
+
+	contact.DeletedOn, contact.DeletedBy = nil, ""
+	contact.Version++
+	m.db.changed("contacts", id, contact)
+	m.db.contacts[id] = contact
+
+	return contact, nil
+}
+
+func (m *memoryContacts) Trash(ctx context.Context, limit int) ([]models.TrashItem, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	_, documents, err := m.db.contactDocuments(true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, total := memoryTrash(documents, contactsTextIndex, limit)
+	return items, total, nil
+}
+
+func (m *memoryContacts) Purge(ctx context.Context, before time.Time) (int, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	purged := 0
+	for id, contact := range m.db.contacts {
+		if contact.DeletedOn != nil && contact.DeletedOn.Before(before) {
+			m.db.changed("contacts", id, nil)
+			delete(m.db.contacts, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (m *memoryContacts) Search(ctx context.Context, query string, limit int) ([]models.SearchHit, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	_, documents, err := m.db.contactDocuments(false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits, total := memorySearch(documents, contactsTextIndex, query, limit)
+	return hits, total, nil
+}
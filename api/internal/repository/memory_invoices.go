@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryInvoices struct {
+	db *memoryDB
+}
+
+// sortedInvoices returns the invoices ordered by id, the caller must hold the lock
+func (db *memoryDB) sortedInvoices() []models.Invoice {
+	sorted := make([]models.Invoice, 0, len(db.invoices))
+	for _, invoice := range db.invoices {
+		sorted = append(sorted, invoice)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID.Hex() < sorted[j].ID.Hex()
+	})
+	return sorted
+}
+
+func (m *memoryInvoices) List(ctx context.Context, opts ListOptions) ([]models.Invoice, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	invoices := m.db.sortedInvoices()
+	documents := make([]bson.M, 0, len(invoices))
+	for _, invoice := range invoices {
+		document, err := toDocument(invoice)
+		if err != nil {
+			return nil, 0, err
+		}
+		documents = append(documents, document)
+	}
+
+	page, _, total := selectDocuments(documents, opts, textIndex{})
+	results := []models.Invoice{}
+	for _, i := range page {
+		results = append(results, invoices[i])
+	}
+
+	return results, total, nil
+}
+
+func (m *memoryInvoices) Find(ctx context.Context, id primitive.ObjectID) (models.Invoice, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	invoice, ok := m.db.invoices[id]
+	if !ok {
+		return models.Invoice{}, ErrNotFound
+	}
+	return invoice, nil
+}
+
+func (m *memoryInvoices) Overlaps(ctx context.Context, clientID primitive.ObjectID, currency string, start time.Time, end time.Time) (bool, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, invoice := range m.db.invoices {
+		if invoice.ClientID == clientID && invoice.Currency == currency && invoice.Status != models.InvoiceVoid &&
+			invoice.PeriodStart.Before(end) && invoice.PeriodEnd.After(start) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryInvoices) Insert(ctx context.Context, invoice models.Invoice) (primitive.ObjectID, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// the same constraint as the unique open_period index of the mongoDB store
+	for _, stored := range m.db.invoices {
+		if stored.ClientID == invoice.ClientID && stored.Currency == invoice.Currency &&
+			stored.PeriodStart.Equal(invoice.PeriodStart) && stored.VoidedOn == nil {
+			return primitive.NilObjectID, ErrAlreadyExists
+		}
+	}
+
+	if invoice.ID.IsZero() {
+		invoice.ID = primitive.NewObjectID()
+	}
+	invoice.Version = 1
+	m.db.invoices[invoice.ID] = invoice
+
+	return invoice.ID, nil
+}
+
+func (m *memoryInvoices) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.Invoice, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.invoices[id]
+	if !ok {
+		return models.Invoice{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.Invoice{}, ErrVersionConflict
+	}
+
+	var patched models.Invoice
+	if err := applyChanges(current, changes, &patched); err != nil {
+		return models.Invoice{}, err
+	}
+	patched.ID, patched.Version = id, version+1
+	m.db.invoices[id] = patched
+
+	return patched, nil
+}
+
+func (m *memoryInvoices) NextNumber(ctx context.Context, year int) (int64, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	m.db.invoiceNumbers[year]++
+	return m.db.invoiceNumbers[year], nil
+}
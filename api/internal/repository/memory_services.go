@@ -0,0 +1,419 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryServices struct {
+	db *memoryDB
+}
+
+// sortedServices returns the services ordered by id
+func sortedServices(services map[primitive.ObjectID]models.ServiceBase) []models.ServiceBase {
+	sorted := make([]models.ServiceBase, 0, len(services))
+	for _, service := range services {
+		sorted = append(sorted, service)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID.Hex() < sorted[j].ID.Hex()
+	})
+	return sorted
+}
+
+// serviceDocuments returns the services in the trash if deleted is true, the other services otherwise, and their bson
+// documents in the same order, the caller must hold the lock
+func (db *memoryDB) serviceDocuments(deleted bool) ([]models.ServiceBase, []bson.M, error) {
+	var services []models.ServiceBase
+	for _, service := range sortedServices(db.services) {
+		if (service.DeletedOn != nil) == deleted {
+			services = append(services, service)
+		}
+	}
+
+	documents := make([]bson.M, 0, len(services))
+	for _, service := range services {
+		document, err := toDocument(service)
+		if err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, document)
+	}
+	return services, documents, nil
+}
+
+// attachedClients returns the existing clients in the attached_to_client list that aren't in the trash,
+// the caller must hold the lock
+func (db *memoryDB) attachedClients(attached []models.Clients) []models.ClientBase {
+	var clients []models.ClientBase
+	seen := map[primitive.ObjectID]bool{}
+	for _, reference := range attached {
+		client, ok := db.clients[reference.ClientID]
+		if !ok || client.DeletedOn != nil || seen[client.ID] {
+			continue
+		}
+		seen[client.ID] = true
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// serviceResponse joins the clients the service is attached to, the caller must hold the lock
+func (db *memoryDB) serviceResponse(service models.ServiceBase) models.ServiceResponse {
+	response := models.ServiceResponse{
+		ID:                 service.ID,
+		ServiceName:        service.ServiceName,
+		ServiceType:        service.ServiceType,
+		ServiceOwner:       service.ServiceOwner,
+		ServiceDescription: service.ServiceDescription,
+		ServiceStatus:      service.ServiceStatus,
+		StatusChangedOn:    service.StatusChangedOn,
+		StatusChangedBy:    service.StatusChangedBy,
+		Client:             []models.ServiceClientResponse{},
+		InvoiceFrequency:   service.InvoiceFrequency,
+		InvoiceAmount:      service.InvoiceAmount,
+		ManagementFee:      service.ManagementFee,
+		Currency:           service.Currency,
+		CreatedOn:          service.CreatedOn,
+		ModifiedOn:         service.ModifiedOn,
+		Version:            service.Version,
+	}
+
+	for _, client := range db.attachedClients(service.AttachedToClient) {
+		response.Client = append(response.Client, models.ServiceClientResponse{
+			ID:         client.ID.Hex(),
+			ClientName: client.ClientName,
+		})
+	}
+
+	return response
+}
+
+func (m *memoryServices) List(ctx context.Context, opts ListOptions) ([]models.ServiceResponse, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	services, documents, err := m.db.serviceDocuments(false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, _, total := selectDocuments(documents, opts, servicesTextIndex)
+	responses := []models.ServiceResponse{}
+	for _, i := range page {
+		responses = append(responses, m.db.serviceResponse(services[i]))
+	}
+
+	return responses, total, nil
+}
+
+func (m *memoryServices) Export(ctx context.Context, opts ListOptions) (Cursor, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	services, documents, err := m.db.serviceDocuments(false)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Start, opts.End = 0, 0
+	matched, _, _ := selectDocuments(documents, opts, servicesTextIndex)
+	cursor := &sliceCursor{current: -1}
+	for _, i := range matched {
+		cursor.documents = append(cursor.documents, m.db.serviceResponse(services[i]))
+	}
+
+	return cursor, nil
+}
+
+func (m *memoryServices) Get(ctx context.Context, id primitive.ObjectID) (models.ServiceResponse, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	service, ok := m.db.services[id]
+	if !ok || service.DeletedOn != nil {
+		return models.ServiceResponse{}, ErrNotFound
+	}
+
+	return m.db.serviceResponse(service), nil
+}
+
+func (m *memoryServices) Find(ctx context.Context, id primitive.ObjectID) (models.ServiceBase, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	service, ok := m.db.services[id]
+	if !ok || service.DeletedOn != nil {
+		return models.ServiceBase{}, ErrNotFound
+	}
+	return service, nil
+}
+
+func (m *memoryServices) NameExists(ctx context.Context, name string) (bool, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, service := range m.db.services {
+		if service.DeletedOn == nil && service.ServiceName == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryServices) Insert(ctx context.Context, service models.ServiceBase) (primitive.ObjectID, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if service.ID.IsZero() {
+		service.ID = primitive.NewObjectID()
+	}
+	service.Version = 1
+	m.db.changed("services", service.ID, service)
+	m.db.services[service.ID] = service
+
+	return service.ID, nil
+}
+
+func (m *memoryServices) Replace(ctx context.Context, id primitive.ObjectID, version int64, service models.ServiceBase) (models.ServiceBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.services[id]
+	if !ok || current.DeletedOn != nil {
+		return models.ServiceBase{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.ServiceBase{}, ErrVersionConflict
+	}
+
+	// round trip through bson like a stored document
+	var replaced models.ServiceBase
+	if err := applyChanges(service, Changes{}, &replaced); err != nil {
+		return models.ServiceBase{}, err
+	}
+	replaced.ID, replaced.Version = id, version+1
+	m.db.changed("services", id, replaced)
+	m.db.services[id] = replaced
+
+	return replaced, nil
+}
+
+func (m *memoryServices) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ServiceBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.services[id]
+	if !ok || current.DeletedOn != nil {
+		return models.ServiceBase{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.ServiceBase{}, ErrVersionConflict
+	}
+
+	var patched models.ServiceBase
+	if err := applyChanges(current, changes, &patched); err != nil {
+		return models.ServiceBase{}, err
+	}
+	patched.ID, patched.Version = id, version+1
+	m.db.changed("services", id, patched)
+	m.db.services[id] = patched
+
+	return patched, nil
+}
+
+func (m *memoryServices) Attach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ServiceBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	service, ok := m.db.services[id]
+	if !ok || service.DeletedOn != nil {
+		return models.ServiceBase{}, ErrNotFound
+	}
+	if attachedTo(service.AttachedToClient, clientID) {
+		return service, nil
+	}
+
+	service.AttachedToClient = append(service.AttachedToClient, models.Clients{ClientID: clientID})
+	service.ModifiedOn = time.Now()
+	service.Version++
+	m.db.changed("services", id, service)
+	m.db.services[id] = service
+
+	return service, nil
+}
+
+func (m *memoryServices) Detach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ServiceBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	service, ok := m.db.services[id]
+	if !ok || service.DeletedOn != nil || !attachedTo(service.AttachedToClient, clientID) {
+		return models.ServiceBase{}, ErrNotFound
+	}
+
+	service.AttachedToClient = detach(service.AttachedToClient, clientID)
+	service.ModifiedOn = time.Now()
+	service.Version++
+	m.db.changed("services", id, service)
+	m.db.services[id] = service
+
+	return service, nil
+}
+
+func (m *memoryServices) Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	service, ok := m.db.services[id]
+	if !ok || service.DeletedOn != nil {
+		return ErrNotFound
+	}
+	if service.Version != version {
+		return ErrVersionConflict
+	}
+
+	now := time.Now()
+	service.DeletedOn, service.DeletedBy = &now, deletedBy
+	service.Version++
+	m.db.changed("services", id, service)
+	m.db.services[id] = service
+
+	return nil
+}
+
+func (m *memoryServices) Restore(ctx context.Context, id primitive.ObjectID) (models.ServiceBase, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	service, ok := m.db.services[id]
+	if !ok || service.DeletedOn == nil {
+		return models.ServiceBase{}, ErrNotFound
+	}
+
+	service.DeletedOn, service.DeletedBy = nil, ""
+	service.Version++
+	m.db.changed("services", id, service)
+	m.db.services[id] = service
+
+	return service, nil
+}
+
+func (m *memoryServices) Trash(ctx context.Context, limit int) ([]models.TrashItem, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	_, documents, err := m.db.serviceDocuments(true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, total := memoryTrash(documents, servicesTextIndex, limit)
+	return items, total, nil
+}
+
+func (m *memoryServices) Purge(ctx context.Context, before time.Time) (int, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	purged := 0
+	for id, service := range m.db.services {
+		if service.DeletedOn != nil && service.DeletedOn.Before(before) {
+			m.db.changed("services", id, nil)
+			delete(m.db.services, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (m *memoryServices) Search(ctx context.Context, query string, limit int) ([]models.SearchHit, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	_, documents, err := m.db.serviceDocuments(false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits, total := memorySearch(documents, servicesTextIndex, query, limit)
+	return hits, total, nil
+}
+
+func (m *memoryServices) Revenue(ctx context.Context, groupBy string, filters []Filter, monthlyFactors map[string]float64) ([]models.RevenueGroup, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	services, documents, err := m.db.serviceDocuments(false)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]*models.RevenueGroup{}
+	for i, document := range documents {
+		if !matchFilters(document, filters) {
+			continue
+		}
+		service := services[i]
+
+		// the keys the service counts towards and the share of its revenue each key gets
+		keys, share := []string{groupKey(firstValue(document, groupBy))}, 1.0
+		if groupBy == RevenueByClient {
+			keys = []string{""}
+			if len(service.AttachedToClient) > 0 {
+				keys = nil
+				for _, client := range service.AttachedToClient {
+					keys = append(keys, client.ClientID.Hex())
+				}
+				share = 1 / float64(len(keys))
+			}
+		}
+
+		factor, known := monthlyFactors[strings.ToLower(strings.TrimSpace(service.InvoiceFrequency))]
+		for _, key := range keys {
+			group, ok := groups[key+" "+service.Currency]
+			if !ok {
+				group = &models.RevenueGroup{Key: key, Currency: service.Currency}
+				if id, err := primitive.ObjectIDFromHex(key); err == nil && groupBy == RevenueByClient {
+					group.Name = m.db.clients[id].ClientName
+				}
+				groups[key+" "+service.Currency] = group
+			}
+
+			group.Services++
+			if !known {
+				group.Unnormalized++
+				continue
+			}
+			group.Monthly = group.Monthly.Add(service.InvoiceAmount.Add(service.ManagementFee).MulFloat(factor * share))
+		}
+	}
+
+	results := make([]models.RevenueGroup, 0, len(groups))
+	for _, group := range groups {
+		results = append(results, *group)
+	}
+
+	return results, nil
+}
+
+// groupKey renders a grouped value like $toString, missing values are grouped under an empty key
+func groupKey(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case primitive.ObjectID:
+		return v.Hex()
+	}
+	return fmt.Sprint(value)
+}
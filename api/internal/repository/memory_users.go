@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryUsers struct {
+	db *memoryDB
+}
+
+func (m *memoryUsers) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, user := range m.db.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (m *memoryUsers) Insert(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// mirrors the unique index on username
+	for _, existing := range m.db.users {
+		if existing.Username == user.Username {
+			return primitive.NilObjectID, errors.New("duplicate username")
+		}
+	}
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	m.db.users[user.ID] = user
+
+	return user.ID, nil
+}
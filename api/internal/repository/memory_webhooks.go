@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryWebhooks struct {
+	db *memoryDB
+}
+
+// sortedWebhooks returns the webhooks ordered by id, the caller must hold the lock
+func (db *memoryDB) sortedWebhooks() []models.Webhook {
+	sorted := make([]models.Webhook, 0, len(db.webhooks))
+	for _, webhook := range db.webhooks {
+		sorted = append(sorted, webhook)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID.Hex() < sorted[j].ID.Hex()
+	})
+	return sorted
+}
+
+func (m *memoryWebhooks) List(ctx context.Context, opts ListOptions) ([]models.Webhook, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	webhooks := m.db.sortedWebhooks()
+	documents := make([]bson.M, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		document, err := toDocument(webhook)
+		if err != nil {
+			return nil, 0, err
+		}
+		documents = append(documents, document)
+	}
+
+	page, _, total := selectDocuments(documents, opts, textIndex{})
+	results := []models.Webhook{}
+	for _, i := range page {
+		results = append(results, webhooks[i])
+	}
+
+	return results, total, nil
+}
+
+func (m *memoryWebhooks) Find(ctx context.Context, id primitive.ObjectID) (models.Webhook, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	webhook, ok := m.db.webhooks[id]
+	if !ok {
+		return models.Webhook{}, ErrNotFound
+	}
+	return webhook, nil
+}
+
+func (m *memoryWebhooks) Subscribed(ctx context.Context, event string) ([]models.Webhook, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	filters := eventFilters(event)
+	webhooks := []models.Webhook{}
+	for _, webhook := range m.db.sortedWebhooks() {
+		if webhook.Disabled {
+			continue
+		}
+		for _, filter := range webhook.Events {
+			if containsString(filters, filter) {
+				webhooks = append(webhooks, webhook)
+				break
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryWebhooks) Insert(ctx context.Context, webhook models.Webhook) (primitive.ObjectID, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	webhook.Version = 1
+	m.db.webhooks[webhook.ID] = webhook
+
+	return webhook.ID, nil
+}
+
+func (m *memoryWebhooks) Replace(ctx context.Context, id primitive.ObjectID, version int64, webhook models.Webhook) (models.Webhook, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.webhooks[id]
+	if !ok {
+		return models.Webhook{}, ErrNotFound
+	}
+	if current.Version != version {
+		return models.Webhook{}, ErrVersionConflict
+	}
+
+	webhook.ID, webhook.Version = id, version+1
+	m.db.webhooks[id] = webhook
+
+	return webhook, nil
+}
+
+func (m *memoryWebhooks) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.db.webhooks, id)
+
+	return nil
+}
+
+type memoryDeliveries struct {
+	db *memoryDB
+}
+
+// sortedDeliveries returns the deliveries ordered by id, the caller must hold the lock
+func (db *memoryDB) sortedDeliveries() []models.WebhookDelivery {
+	sorted := make([]models.WebhookDelivery, 0, len(db.deliveries))
+	for _, delivery := range db.deliveries {
+		sorted = append(sorted, delivery)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID.Hex() < sorted[j].ID.Hex()
+	})
+	return sorted
+}
+
+func (m *memoryDeliveries) List(ctx context.Context, opts ListOptions) ([]models.WebhookDelivery, int, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	deliveries := m.db.sortedDeliveries()
+	documents := make([]bson.M, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		document, err := toDocument(delivery)
+		if err != nil {
+			return nil, 0, err
+		}
+		documents = append(documents, document)
+	}
+
+	page, _, total := selectDocuments(documents, opts, textIndex{})
+	results := []models.WebhookDelivery{}
+	for _, i := range page {
+		results = append(results, deliveries[i])
+	}
+
+	return results, total, nil
+}
+
+func (m *memoryDeliveries) Find(ctx context.Context, id primitive.ObjectID) (models.WebhookDelivery, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	delivery, ok := m.db.deliveries[id]
+	if !ok {
+		return models.WebhookDelivery{}, ErrNotFound
+	}
+	return delivery, nil
+}
+
+func (m *memoryDeliveries) Insert(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		if delivery.ID.IsZero() {
+			delivery.ID = primitive.NewObjectID()
+		}
+		m.db.deliveries[delivery.ID] = delivery
+	}
+
+	return nil
+}
+
+func (m *memoryDeliveries) Claim(ctx context.Context, now time.Time, lease time.Duration) (models.WebhookDelivery, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	var claimed *models.WebhookDelivery
+	for _, delivery := range m.db.sortedDeliveries() {
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptOn == nil || delivery.NextAttemptOn.After(now) {
+			continue
+		}
+		if claimed == nil || delivery.NextAttemptOn.Before(*claimed.NextAttemptOn) {
+			delivery := delivery
+			claimed = &delivery
+		}
+	}
+	if claimed == nil {
+		return models.WebhookDelivery{}, ErrNotFound
+	}
+
+	next := now.Add(lease)
+	claimed.NextAttemptOn = &next
+	m.db.deliveries[claimed.ID] = *claimed
+
+	return *claimed, nil
+}
+
+func (m *memoryDeliveries) Record(ctx context.Context, id primitive.ObjectID, attempt models.DeliveryAttempt, status string, failures int, next *time.Time) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	delivery, ok := m.db.deliveries[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Status, delivery.Failures, delivery.NextAttemptOn = status, failures, next
+	if status == models.DeliveryDelivered {
+		delivered := attempt.AttemptedOn
+		delivery.DeliveredOn = &delivered
+	}
+	m.db.deliveries[id] = delivery
+
+	return nil
+}
+
+func (m *memoryDeliveries) Requeue(ctx context.Context, id primitive.ObjectID, now time.Time) (models.WebhookDelivery, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	delivery, ok := m.db.deliveries[id]
+	if !ok {
+		return models.WebhookDelivery{}, ErrNotFound
+	}
+	if delivery.Status == models.DeliveryPending {
+		return models.WebhookDelivery{}, ErrPending
+	}
+
+	delivery.Status, delivery.Failures, delivery.NextAttemptOn = models.DeliveryPending, 0, &now
+	m.db.deliveries[id] = delivery
+
+	return delivery, nil
+}
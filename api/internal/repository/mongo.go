@@ -0,0 +1,727 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const textIndexName = "text_search"
+
+// notDeleted matches the documents that aren't in the trash, deleted_on is removed again on restore
+var notDeleted = bson.M{"deleted_on": nil}
+
+// mongoCollection is a collection whose operations are each bounded by timeout
+type mongoCollection struct {
+	*mongo.Collection
+	timeout time.Duration
+}
+
+// operation returns the context for a single database operation, it is cancelled with the parent context
+// (e.g. when the HTTP client disconnects) or when the operation timeout expires
+func (c mongoCollection) operation(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// NewMongoStore returns a Store backed by the clients, services, contacts and invoices collections of db,
+// every database operation is bounded by timeout (0 means no deadline besides the one of the caller)
+func NewMongoStore(db *mongo.Database, timeout time.Duration) *Store {
+	collection := func(name string) mongoCollection {
+		return mongoCollection{Collection: db.Collection(name), timeout: timeout}
+	}
+
+	return &Store{
+		Clients:  &mongoClients{collection: collection("clients"), services: collection("services"), contacts: collection("contacts")},
+		Services: &mongoServices{collection: collection("services")},
+		Contacts: &mongoContacts{collection: collection("contacts")},
+		Invoices: &mongoInvoices{collection: collection("invoices"), numbers: collection("invoice_numbers")},
+		APIKeys:  &mongoAPIKeys{collection: collection("api_keys")},
+		Users:    &mongoUsers{collection: collection("users")},
+		Audit:    &mongoAudit{collection: collection("audit")},
+
+		Webhooks:   &mongoWebhooks{collection: collection("webhooks")},
+		Deliveries: &mongoDeliveries{collection: collection("webhook_deliveries")},
+
+		Transactions: &mongoTransactions{client: db.Client()},
+		Changes:      &mongoChanges{db: db},
+	}
+}
+
+// mongoTransactions runs multi-document transactions, transactions require mongoDB to run as a replica set
+// https://docs.mongodb.com/manual/core/transactions/
+type mongoTransactions struct {
+	client *mongo.Client
+}
+
+func (m *mongoTransactions) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	return inTransaction(ctx, m.client, fn)
+}
+
+// inTransaction calls fn with a session context running a transaction. A context that already belongs to a
+// session joins its transaction instead, e.g. a client deleted in a batch, the outer transaction then decides
+// whether the changes are committed.
+func inTransaction(ctx context.Context, client *mongo.Client, fn func(sc context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// EnsureMongoIndexes creates the text indexes used by the full text search, the indexes on the deletion time used
+// by the trash, the unique indexes on the api key hashes and usernames, the indexes on
+// invoices, the index used to browse the history of a document in the audit log and the indexes of the webhook
+// delivery queue.
+// Creating an index that already exists with the same definition is a no-op.
+func EnsureMongoIndexes(ctx context.Context, db *mongo.Database) error {
+	collections := map[string]textIndex{
+		"clients":  clientsTextIndex,
+		"services": servicesTextIndex,
+		"contacts": contactsTextIndex,
+	}
+
+	for name, index := range collections {
+		keys := bson.D{}
+		weights := bson.M{}
+		for _, weight := range index.Weights {
+			keys = append(keys, bson.E{Key: weight.Key, Value: "text"})
+			weights[weight.Key] = weight.Value
+		}
+
+		model := mongo.IndexModel{
+			Keys:    keys,
+			Options: options.Index().SetName(textIndexName).SetWeights(weights),
+		}
+		if _, err := db.Collection(name).Indexes().CreateOne(ctx, model); err != nil {
+			return err
+		}
+		log.Debug("Ensured text index on ", name)
+
+		// only documents in the trash have a deletion time
+		model = mongo.IndexModel{
+			Keys:    bson.D{{Key: "deleted_on", Value: -1}},
+			Options: options.Index().SetName("deleted_on").SetSparse(true),
+		}
+		if _, err := db.Collection(name).Indexes().CreateOne(ctx, model); err != nil {
+			return err
+		}
+		log.Debug("Ensured deleted_on index on ", name)
+	}
+
+	// api keys are looked up by their hash on every authenticated request
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: "key_hash", Value: 1}},
+		Options: options.Index().SetName("key_hash").SetUnique(true),
+	}
+	if _, err := db.Collection("api_keys").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured key_hash index on api_keys")
+
+	// users log in with their username
+	model = mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetName("username").SetUnique(true),
+	}
+	if _, err := db.Collection("users").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured username index on users")
+
+	// invoices are listed per client and checked for overlapping periods before a draft is generated
+	model = mongo.IndexModel{
+		Keys:    bson.D{{Key: "client_id", Value: 1}, {Key: "period_start", Value: 1}},
+		Options: options.Index().SetName("client_period"),
+	}
+	if _, err := db.Collection("invoices").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured client_period index on invoices")
+
+	// a period is billed once per currency, void invoices have a voiding time so they don't take the period. The
+	// overlap check covers other overlapping periods, the index refuses the same period generated twice at once.
+	model = mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "client_id", Value: 1}, {Key: "currency", Value: 1}, {Key: "period_start", Value: 1}, {Key: "voided_on", Value: 1},
+		},
+		Options: options.Index().SetName("open_period").SetUnique(true),
+	}
+	if _, err := db.Collection("invoices").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured open_period index on invoices")
+
+	// drafts don't have a number yet
+	model = mongo.IndexModel{
+		Keys:    bson.D{{Key: "number", Value: 1}},
+		Options: options.Index().SetName("number").SetUnique(true).SetSparse(true),
+	}
+	if _, err := db.Collection("invoices").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured number index on invoices")
+
+	model = mongo.IndexModel{
+		Keys:    bson.D{{Key: "entity", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("entity_history"),
+	}
+	if _, err := db.Collection("audit").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured entity_history index on audit")
+
+	// every change looks up the webhooks subscribed to its event
+	model = mongo.IndexModel{
+		Keys:    bson.D{{Key: "events", Value: 1}},
+		Options: options.Index().SetName("events"),
+	}
+	if _, err := db.Collection("webhooks").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured events index on webhooks")
+
+	// the dispatcher claims the pending deliveries that are due, the delivery log is browsed per webhook
+	model = mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_on", Value: 1}},
+		Options: options.Index().SetName("due"),
+	}
+	if _, err := db.Collection("webhook_deliveries").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured due index on webhook_deliveries")
+
+	model = mongo.IndexModel{
+		Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_on", Value: -1}},
+		Options: options.Index().SetName("webhook_log"),
+	}
+	if _, err := db.Collection("webhook_deliveries").Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	log.Debug("Ensured webhook_log index on webhook_deliveries")
+
+	return nil
+}
+
+// mongoMatch returns the stages selecting the documents of a list, they run before any lookup stage.
+// match holds further conditions every document has to meet, e.g. notDeleted.
+// $text has to be the first stage of the pipeline, the relevance is added as the score field.
+// https://docs.mongodb.com/manual/reference/operator/query/text/
+func mongoMatch(opts ListOptions, match bson.M) []bson.M {
+	var stages []bson.M
+
+	if opts.Query != "" {
+		stages = append(stages,
+			bson.M{"$match": bson.M{"$text": bson.M{"$search": opts.Query}}},
+			bson.M{"$addFields": bson.M{ScoreField: bson.M{"$meta": "textScore"}}},
+		)
+	}
+
+	conditions := bson.M{}
+	for path, condition := range match {
+		conditions[path] = condition
+	}
+	for _, filter := range opts.Filters {
+		operators, ok := conditions[filter.Path].(bson.M)
+		if !ok {
+			operators = bson.M{}
+			conditions[filter.Path] = operators
+		}
+		operators["$"+filter.Operator] = filter.Value
+	}
+
+	if len(conditions) > 0 {
+		stages = append(stages, bson.M{"$match": conditions})
+	}
+
+	return stages
+}
+
+// fragmentFilter matches the documents meeting match that contain every term in one of the fields of index
+func fragmentFilter(index textIndex, terms []searchTerm, match bson.M) bson.M {
+	// a collection without searched fields matches nothing
+	if len(index.Weights) == 0 {
+		return bson.M{"_id": bson.M{"$exists": false}}
+	}
+
+	all := bson.A{}
+	for _, term := range terms {
+		any := bson.A{}
+		for _, weight := range index.Weights {
+			any = append(any, bson.M{weight.Key: primitive.Regex{Pattern: term.fragment(), Options: "i"}})
+		}
+		all = append(all, bson.M{"$or": any})
+	}
+
+	filter := bson.M{"$and": all}
+	for path, condition := range match {
+		filter[path] = condition
+	}
+	return filter
+}
+
+// fragmentStages returns the stages selecting the documents of filter and adding the score fragmentScore computes
+// in memory as the score field. The terms are matched with regular expressions, which can't use the text index.
+func fragmentStages(index textIndex, terms []searchTerm, filter bson.M) []bson.M {
+	score := bson.A{0}
+	for _, term := range terms {
+		for _, weight := range index.Weights {
+			input := bson.M{"$ifNull": bson.A{"$" + weight.Key, ""}}
+
+			// the patterns are tried in order, the first match decides the score of the field
+			var fieldScore interface{} = 0
+			for i := len(term.patterns) - 1; i >= 0; i-- {
+				fieldScore = bson.M{"$cond": bson.A{
+					bson.M{"$regexMatch": bson.M{"input": input, "regex": term.patterns[i], "options": "i"}},
+					searchFactors[i] * weight.Value.(int),
+					fieldScore,
+				}}
+			}
+			score = append(score, fieldScore)
+		}
+	}
+
+	return []bson.M{
+		{"$match": filter},
+		{"$addFields": bson.M{ScoreField: bson.M{"$add": score}}},
+	}
+}
+
+// paginate wraps the lookup pipeline in a $facet stage so a single aggregation returns both the requested page
+// and the total number of matching documents. $sort, $skip and $limit run before the lookup stages so the joins
+// are only executed for the documents on the page.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/facet/
+func paginate(opts ListOptions, match bson.M, lookup []bson.M) []bson.M {
+	data := []bson.M{
+		{"$sort": listSort(opts)},
+		{"$skip": opts.Start},
+	}
+	if opts.End > 0 {
+		data = append(data, bson.M{"$limit": opts.End - opts.Start})
+	}
+	data = append(data, lookup...)
+
+	return append(mongoMatch(opts, match), bson.M{
+		"$facet": bson.M{
+			"data":  data,
+			"total": []bson.M{{"$count": "count"}},
+		},
+	})
+}
+
+// listSort returns the order of a list, _id is always added as a tie breaker to get a stable order between pages
+func listSort(opts ListOptions) bson.D {
+	sort := bson.D{{Key: opts.Sort, Value: opts.Order}}
+	if opts.Sort != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: opts.Order})
+	}
+	return sort
+}
+
+// export runs the lookup pipeline on every document matching opts and returns the cursor over the results.
+// The cursor is only bound to ctx and not to the operation timeout, an export lasts as long as the caller reads it.
+func export(ctx context.Context, collection mongoCollection, opts ListOptions, match bson.M, lookup []bson.M) (Cursor, error) {
+	pipeline := append(mongoMatch(opts, match), bson.M{"$sort": listSort(opts)})
+	pipeline = append(pipeline, lookup...)
+
+	// sorting a whole collection may exceed the memory limit of a $sort stage
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// aggregatePage executes a pipeline built by paginate, decodes the page into results and returns the total count
+func aggregatePage(ctx context.Context, collection mongoCollection, pipeline []bson.M, results interface{}) (int, error) {
+	var page struct {
+		Data  bson.RawValue `bson:"data"`
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+	}
+
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	// $facet always returns exactly one document
+	if !cursor.Next(ctx) {
+		return 0, cursor.Err()
+	}
+
+	if err := cursor.Decode(&page); err != nil {
+		return 0, err
+	}
+
+	if err := page.Data.Unmarshal(results); err != nil {
+		return 0, err
+	}
+
+	// $count returns no document at all when nothing matched
+	total := 0
+	if len(page.Total) > 0 {
+		total = page.Total[0].Count
+	}
+
+	return total, nil
+}
+
+// aggregateOne decodes the first document returned by the pipeline into result
+func aggregateOne(ctx context.Context, collection mongoCollection, pipeline []bson.M, result interface{}) error {
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+
+	return cursor.Decode(result)
+}
+
+// findOne decodes the document with the id into result, documents in the trash are not found
+func findOne(ctx context.Context, collection mongoCollection, id primitive.ObjectID, result interface{}) error {
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"_id": id, "deleted_on": nil}).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// exists returns true if at least one document matches filter
+func exists(ctx context.Context, collection mongoCollection, filter bson.M) (bool, error) {
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// insertOne inserts document and returns the id generated by the database
+func insertOne(ctx context.Context, collection mongoCollection, document interface{}) (primitive.ObjectID, error) {
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	result, err := collection.InsertOne(ctx, document)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+// versionFilter matches the document with the id at version unless it is in the trash, documents stored before
+// versioning count as version 0
+func versionFilter(id primitive.ObjectID, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "version": bson.M{"$in": bson.A{0, nil}}, "deleted_on": nil}
+	}
+	return bson.M{"_id": id, "version": version, "deleted_on": nil}
+}
+
+// versionError tells apart a missing document from a document at another version after a conditional
+// write matched nothing
+func versionError(ctx context.Context, collection mongoCollection, id primitive.ObjectID) error {
+	found, err := exists(ctx, collection, bson.M{"_id": id, "deleted_on": nil})
+	if err != nil {
+		return err
+	}
+	if found {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+// replaceOne replaces the document with the id if it is still at version and decodes the new document into result,
+// document must already carry the next version
+func replaceOne(ctx context.Context, collection mongoCollection, id primitive.ObjectID, version int64, document interface{}, result interface{}) error {
+	replaceCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	opts := options.FindOneAndReplace().SetReturnDocument(options.After)
+	err := collection.FindOneAndReplace(replaceCtx, versionFilter(id, version), document, opts).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return versionError(ctx, collection, id)
+	}
+	return err
+}
+
+// patchOne applies changes to the document with the id using $set and $unset if it is still at version,
+// increments the version and decodes the updated document into result
+func patchOne(ctx context.Context, collection mongoCollection, id primitive.ObjectID, version int64, changes Changes, result interface{}) error {
+	update := bson.M{"$inc": bson.M{"version": 1}}
+	if len(changes.Set) > 0 {
+		update["$set"] = changes.Set
+	}
+	if len(changes.Unset) > 0 {
+		unset := bson.M{}
+		for _, field := range changes.Unset {
+			unset[field] = ""
+		}
+		update["$unset"] = unset
+	}
+
+	patchCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(patchCtx, versionFilter(id, version), update, opts).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return versionError(ctx, collection, id)
+	}
+	return err
+}
+
+// trashOne moves the document with the id to the trash by setting its deletion time if it is still at version, the
+// version is incremented so pending conditional writes based on the document fail
+func trashOne(ctx context.Context, collection mongoCollection, id primitive.ObjectID, version int64, deletedBy string) error {
+	trashCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"deleted_on": time.Now(), "deleted_by": deletedBy},
+		"$inc": bson.M{"version": 1},
+	}
+	result, err := collection.UpdateOne(trashCtx, versionFilter(id, version), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return versionError(ctx, collection, id)
+	}
+
+	return nil
+}
+
+// attachOne adds the client to the attached_to_client list of the document with the id with $addToSet and decodes
+// the updated document into result, a document already attached to the client is returned unchanged
+func attachOne(ctx context.Context, collection mongoCollection, id primitive.ObjectID, clientID primitive.ObjectID, result interface{}) error {
+	attachCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	// documents stored without clients have a null list, $addToSet only adds to arrays
+	_, err := collection.UpdateOne(attachCtx,
+		bson.M{"_id": id, "attached_to_client": bson.M{"$type": "null"}},
+		bson.M{"$set": bson.M{"attached_to_client": bson.A{}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$addToSet": bson.M{"attached_to_client": bson.M{"_id": clientID}},
+		"$set":      bson.M{"modified_on": time.Now()},
+		"$inc":      bson.M{"version": 1},
+	}
+	filter := bson.M{"_id": id, "deleted_on": nil, "attached_to_client._id": bson.M{"$ne": clientID}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(attachCtx, filter, update, opts).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// the document is either attached already or doesn't exist
+		return findOne(ctx, collection, id, result)
+	}
+	return err
+}
+
+// detachOne removes the client from the attached_to_client list of the document with the id with $pull and decodes
+// the updated document into result, ErrNotFound is returned when the document isn't attached to the client
+func detachOne(ctx context.Context, collection mongoCollection, id primitive.ObjectID, clientID primitive.ObjectID, result interface{}) error {
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	update := bson.M{
+		"$pull": bson.M{"attached_to_client": bson.M{"_id": clientID}},
+		"$set":  bson.M{"modified_on": time.Now()},
+		"$inc":  bson.M{"version": 1},
+	}
+	filter := bson.M{"_id": id, "deleted_on": nil, "attached_to_client._id": clientID}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// restoreOne takes the document with the id out of the trash and decodes the restored document into result
+func restoreOne(ctx context.Context, collection mongoCollection, id primitive.ObjectID, result interface{}) error {
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	update := bson.M{
+		"$unset": bson.M{"deleted_on": "", "deleted_by": ""},
+		"$inc":   bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deleted_on": bson.M{"$ne": nil}}, update, opts).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// mongoTrash returns up to limit documents of the collection in the trash, most recently deleted first,
+// and the number of documents in the trash
+func mongoTrash(ctx context.Context, collection mongoCollection, index textIndex, limit int) ([]models.TrashItem, int, error) {
+	items := []models.TrashItem{}
+	deleted := bson.M{"deleted_on": bson.M{"$ne": nil}}
+
+	pipeline := []bson.M{
+		{"$match": deleted},
+		{"$sort": bson.D{{Key: "deleted_on", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline, bson.M{
+		"$project": bson.M{
+			"_id":        1,
+			"type":       bson.M{"$literal": index.Type},
+			"title":      "$" + index.Title,
+			"deleted_on": 1,
+			"deleted_by": 1,
+		},
+	})
+
+	trashCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := collection.Aggregate(trashCtx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := cursor.All(trashCtx, &items); err != nil {
+		return nil, 0, err
+	}
+
+	countCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	total, err := collection.CountDocuments(countCtx, deleted)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, int(total), nil
+}
+
+// purgeDeleted permanently removes the documents of the collection deleted before the time
+func purgeDeleted(ctx context.Context, collection mongoCollection, before time.Time) (int, error) {
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{"deleted_on": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
+
+// withoutDeleted returns an expression removing the documents in the trash from a field joined by $lookup
+func withoutDeleted(field string) bson.M {
+	return bson.M{
+		"$filter": bson.M{
+			"input": "$" + field,
+			"cond":  bson.M{"$not": bson.A{"$$this.deleted_on"}},
+		},
+	}
+}
+
+// mongoSearch runs a full text search on the collection and returns the hits ranked by relevance. The text index
+// only matches whole words, a query it finds nothing for is searched again as fragments of words, e.g. acm finds
+// Acme. The fragments can't use an index, so they are only searched when the text index found nothing.
+func mongoSearch(ctx context.Context, collection mongoCollection, index textIndex, query string, limit int) ([]models.SearchHit, int, error) {
+	filter := bson.M{"$text": bson.M{"$search": query}, "deleted_on": nil}
+	hits, total, err := searchHits(ctx, collection, index, mongoMatch(ListOptions{Query: query}, notDeleted), filter, limit)
+	if err != nil || total > 0 {
+		return hits, total, err
+	}
+
+	terms := fragmentTerms(query)
+	if len(terms) == 0 {
+		return hits, total, nil
+	}
+
+	filter = fragmentFilter(index, terms, notDeleted)
+	return searchHits(ctx, collection, index, fragmentStages(index, terms, filter), filter, limit)
+}
+
+// searchHits runs the stages selecting and scoring the documents of a search and returns up to limit hits, with
+// the number of documents matching filter
+func searchHits(ctx context.Context, collection mongoCollection, index textIndex, stages []bson.M, filter bson.M, limit int) ([]models.SearchHit, int, error) {
+	hits := []models.SearchHit{}
+
+	pipeline := append(stages,
+		bson.M{"$sort": bson.D{{Key: ScoreField, Value: -1}, {Key: "_id", Value: 1}}},
+	)
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline, bson.M{
+		"$project": bson.M{
+			"_id":         1,
+			"type":        bson.M{"$literal": index.Type},
+			"title":       "$" + index.Title,
+			"description": "$" + index.Description,
+			ScoreField:    1,
+		},
+	})
+
+	searchCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := collection.Aggregate(searchCtx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := cursor.All(searchCtx, &hits); err != nil {
+		return nil, 0, err
+	}
+
+	countCtx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	total, err := collection.CountDocuments(countCtx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return hits, int(total), nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoAPIKeys struct {
+	collection mongoCollection
+}
+
+func (m *mongoAPIKeys) FindByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	var key models.APIKey
+
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	err := m.collection.FindOne(ctx, bson.M{"key_hash": hash}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return key, ErrNotFound
+	}
+	return key, err
+}
+
+func (m *mongoAPIKeys) Insert(ctx context.Context, key models.APIKey) (primitive.ObjectID, error) {
+	return insertOne(ctx, m.collection, key)
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type mongoAudit struct {
+	collection mongoCollection
+}
+
+func (m *mongoAudit) Insert(ctx context.Context, entry models.AuditEntry) error {
+	_, err := insertOne(ctx, m.collection, entry)
+	return err
+}
+
+func (m *mongoAudit) List(ctx context.Context, opts ListOptions) ([]models.AuditEntry, int, error) {
+	entries := []models.AuditEntry{}
+	total, err := aggregatePage(ctx, m.collection, paginate(opts, nil, nil), &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range entries {
+		for j := range entries[i].Changes {
+			change := &entries[i].Changes[j]
+			change.Before = plainValue(change.Before)
+			change.After = plainValue(change.After)
+		}
+	}
+
+	return entries, total, nil
+}
+
+// plainValue converts the primitive.D documents the driver decodes into interface{} fields to bson.M,
+// so they are rendered as json objects instead of lists of key value pairs
+func plainValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case primitive.D:
+		document := bson.M{}
+		for _, element := range value {
+			document[element.Key] = plainValue(element.Value)
+		}
+		return document
+	case primitive.A:
+		for i := range value {
+			value[i] = plainValue(value[i])
+		}
+		return value
+	}
+	return v
+}
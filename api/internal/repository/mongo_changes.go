@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeStreamWait is how long TryNext waits for a change before it gives up
+const changeStreamWait = time.Second
+
+// server errors of a change stream that can't be resumed at its token
+const (
+	codeInvalidResumeToken      = 260
+	codeChangeStreamFatalError  = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+// mongoChanges streams the changes with change streams, which require mongoDB to run as a replica set. The
+// resume tokens are the _data of the change events, they are valid as long as the events are in the oplog.
+// https://docs.mongodb.com/manual/changeStreams/
+type mongoChanges struct {
+	db *mongo.Database
+}
+
+func (m *mongoChanges) Watch(ctx context.Context, entities []string, token string) (ChangeStream, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"ns.coll":       bson.M{"$in": entities},
+			"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}},
+		}},
+	}
+
+	// the updated documents are looked up when the change is read, they may include later changes
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup).SetMaxAwaitTime(changeStreamWait)
+	if token != "" {
+		if _, err := hex.DecodeString(token); err != nil {
+			return nil, ErrInvalidToken
+		}
+		opts.SetResumeAfter(bson.M{"_data": token})
+	}
+
+	stream, err := m.db.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, changeStreamError(err)
+	}
+	return &mongoChangeStream{stream: stream}, nil
+}
+
+// changeStreamError returns ErrInvalidToken for the errors of a stream that can't be resumed
+func changeStreamError(err error) error {
+	if serverErr, ok := err.(mongo.ServerError); ok {
+		for _, code := range []int{codeInvalidResumeToken, codeChangeStreamFatalError, codeChangeStreamHistoryLost} {
+			if serverErr.HasErrorCode(code) {
+				return ErrInvalidToken
+			}
+		}
+	}
+	return err
+}
+
+// changeEvent holds the fields of a change event the feed uses
+// https://docs.mongodb.com/manual/reference/change-events/
+type changeEvent struct {
+	ID            bson.Raw            `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	Namespace     struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.RawValue `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+type mongoChangeStream struct {
+	stream *mongo.ChangeStream
+	change models.Change
+	err    error
+}
+
+func (s *mongoChangeStream) TryNext(ctx context.Context) bool {
+	if s.err != nil || !s.stream.TryNext(ctx) {
+		return false
+	}
+
+	var event changeEvent
+	if err := s.stream.Decode(&event); err != nil {
+		s.err = err
+		return false
+	}
+
+	change, err := event.change()
+	if err != nil {
+		s.err = err
+		return false
+	}
+	s.change = change
+	return true
+}
+
+// change converts the event into a Change, trashing and restoring are updates of deleted_on
+func (e changeEvent) change() (models.Change, error) {
+	token, _ := e.ID.Lookup("_data").StringValueOK()
+	change := models.Change{
+		Token:      token,
+		Entity:     e.Namespace.Coll,
+		Action:     models.ChangeUpdated,
+		EntityID:   e.DocumentKey.ID,
+		OccurredOn: time.Unix(int64(e.ClusterTime.T), 0).UTC(),
+	}
+
+	switch e.OperationType {
+	case "insert":
+		change.Action = models.ChangeCreated
+	case "delete":
+		change.Action = models.ChangePurged
+	case "update":
+		if deletedOn, ok := e.UpdateDescription.UpdatedFields["deleted_on"]; ok && deletedOn != nil {
+			change.Action = models.ChangeDeleted
+		}
+		for _, field := range e.UpdateDescription.RemovedFields {
+			if field == "deleted_on" {
+				change.Action = models.ChangeRestored
+			}
+		}
+	}
+
+	// the document is missing once it is purged
+	if e.FullDocument.Type != bsontype.EmbeddedDocument {
+		return change, nil
+	}
+
+	var document interface{}
+	switch change.Entity {
+	case "clients":
+		document = &models.ClientBase{}
+	case "services":
+		document = &models.ServiceBase{}
+	default:
+		document = &models.ContactsBase{}
+	}
+	if err := e.FullDocument.Unmarshal(document); err != nil {
+		return change, err
+	}
+	change.Data = document
+	return change, nil
+}
+
+func (s *mongoChangeStream) Change() models.Change {
+	return s.change
+}
+
+func (s *mongoChangeStream) Token() string {
+	if token, ok := s.stream.ResumeToken().Lookup("_data").StringValueOK(); ok {
+		return token
+	}
+	return s.change.Token
+}
+
+func (s *mongoChangeStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return changeStreamError(s.stream.Err())
+}
+
+func (s *mongoChangeStream) Close(ctx context.Context) error {
+	return s.stream.Close(ctx)
+}
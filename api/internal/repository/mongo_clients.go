@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type mongoClients struct {
+	collection mongoCollection
+	// services and contacts are changed with a deleted client
+	services mongoCollection
+	contacts mongoCollection
+}
+
+// dependent is a document attached to a client, shared is true when it is attached to other clients as well
+type dependent struct {
+	models.Dependent `bson:",inline"`
+	Shared           bool  `bson:"shared"`
+	Version          int64 `bson:"version"`
+}
+
+// clientLookup joins managed_services from the services collection and client_contacts from the contacts collection
+// using mongoDB's $lookup and $project to get the required fields
+// https://docs.mongodb.com/manual/reference/operator/aggregation/lookup/
+// https://docs.mongodb.com/manual/core/aggregation-pipeline/
+var clientLookup = []bson.M{
+	{
+		"$lookup": bson.M{
+			"from":         "services",
+			"localField":   "_id",
+			"foreignField": "attached_to_client._id",
+			"as":           "managed_services",
+		},
+	},
+	{
+		"$lookup": bson.M{
+			"from":         "contacts",
+			"localField":   "_id",
+			"foreignField": "attached_to_client._id",
+			"as":           "client_contacts",
+		},
+	},
+	// services and contacts in the trash aren't joined
+	{
+		"$addFields": bson.M{
+			"managed_services": withoutDeleted("managed_services"),
+			"client_contacts":  withoutDeleted("client_contacts"),
+		},
+	},
+	{
+		"$project": bson.M{
+			"_id":                                1,
+			"client_name":                        1,
+			"slack_channel":                      1,
+			"web_url":                            1,
+			"created_on":                         1,
+			"modified_on":                        1,
+			"version":                            1,
+			"managed_services._id":               1,
+			"managed_services.service_name":      1,
+			"managed_services.service_type":      1,
+			"managed_services.service_status":    1,
+			"managed_services.invoice_frequency": 1,
+			"managed_services.invoice_amount":    1,
+			"managed_services.management_fee":    1,
+			"managed_services.currency":          1,
+			"client_contacts._id":                1,
+			"client_contacts.first_name":         1,
+			"client_contacts.last_name":          1,
+			"client_contacts.full_name":          1,
+			"client_contacts.email":              1,
+			"client_contacts.phone_number":       1,
+			"client_contacts.role":               1,
+		},
+	},
+}
+
+func (m *mongoClients) List(ctx context.Context, opts ListOptions) ([]models.ClientResponse, int, error) {
+	clients := []models.ClientResponse{}
+	total, err := aggregatePage(ctx, m.collection, paginate(opts, notDeleted, clientLookup), &clients)
+	return clients, total, err
+}
+
+func (m *mongoClients) Export(ctx context.Context, opts ListOptions) (Cursor, error) {
+	return export(ctx, m.collection, opts, notDeleted, clientLookup)
+}
+
+func (m *mongoClients) Get(ctx context.Context, id primitive.ObjectID) (models.ClientResponse, error) {
+	var client models.ClientResponse
+	pipeline := append([]bson.M{{"$match": bson.M{"_id": id, "deleted_on": nil}}}, clientLookup...)
+	err := aggregateOne(ctx, m.collection, pipeline, &client)
+	return client, err
+}
+
+func (m *mongoClients) Find(ctx context.Context, id primitive.ObjectID) (models.ClientBase, error) {
+	var client models.ClientBase
+	err := findOne(ctx, m.collection, id, &client)
+	return client, err
+}
+
+func (m *mongoClients) NameExists(ctx context.Context, name string) (bool, error) {
+	return exists(ctx, m.collection, bson.M{"client_name": name, "deleted_on": nil})
+}
+
+func (m *mongoClients) FindByNames(ctx context.Context, names []string) ([]models.ClientBase, error) {
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := m.collection.Find(ctx, bson.M{"client_name": bson.M{"$in": names}, "deleted_on": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	clients := []models.ClientBase{}
+	err = cursor.All(ctx, &clients)
+	return clients, err
+}
+
+func (m *mongoClients) Missing(ctx context.Context, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	found, err := m.collection.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}, "deleted_on": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[primitive.ObjectID]bool{}
+	for _, id := range found {
+		if id, ok := id.(primitive.ObjectID); ok {
+			existing[id] = true
+		}
+	}
+
+	var missing []primitive.ObjectID
+	for _, id := range ids {
+		if !existing[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+func (m *mongoClients) Insert(ctx context.Context, client models.ClientBase) (primitive.ObjectID, error) {
+	client.Version = 1
+	return insertOne(ctx, m.collection, client)
+}
+
+func (m *mongoClients) Replace(ctx context.Context, id primitive.ObjectID, version int64, client models.ClientBase) (models.ClientBase, error) {
+	var replaced models.ClientBase
+	client.ID, client.Version = id, version+1
+	err := replaceOne(ctx, m.collection, id, version, client, &replaced)
+	return replaced, err
+}
+
+func (m *mongoClients) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ClientBase, error) {
+	var patched models.ClientBase
+	err := patchOne(ctx, m.collection, id, version, changes, &patched)
+	return patched, err
+}
+
+// Delete runs in a multi-document transaction so a client is never deleted half-way, or in the transaction ctx
+// already belongs to
+func (m *mongoClients) Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string, cascade string) ([]models.Dependent, error) {
+	dependentCollections := []struct {
+		collection mongoCollection
+		index      textIndex
+		// document returns a value to decode a stored dependent into
+		document func() interface{}
+	}{
+		{m.services, servicesTextIndex, func() interface{} { return &models.ServiceBase{} }},
+		{m.contacts, contactsTextIndex, func() interface{} { return &models.ContactsBase{} }},
+	}
+
+	var dependents []models.Dependent
+	err := inTransaction(ctx, m.collection.Database().Client(), func(sc context.Context) error {
+		// the transaction is retried on transient errors
+		dependents = nil
+
+		if err := trashOne(sc, m.collection, id, version, deletedBy); err != nil {
+			return err
+		}
+
+		for _, dependentCollection := range dependentCollections {
+			found, err := mongoDependents(sc, dependentCollection.collection, dependentCollection.index, id)
+			if err != nil {
+				return err
+			}
+
+			for _, d := range found {
+				if cascade != CascadeRestrict {
+					// the stored document is read in the transaction, it is what the cascade changes
+					d.Before = dependentCollection.document()
+					if err := findOne(sc, dependentCollection.collection, d.ID, d.Before); err != nil {
+						return err
+					}
+				}
+
+				switch {
+				case cascade == CascadeRestrict:
+				case cascade == CascadeDelete && !d.Shared:
+					d.Action = CascadeDelete
+					err = trashOne(sc, dependentCollection.collection, d.ID, d.Version, deletedBy)
+				default:
+					d.Action = CascadeDetach
+					d.After = dependentCollection.document()
+					err = detachOne(sc, dependentCollection.collection, d.ID, id, d.After)
+				}
+				if err != nil {
+					return err
+				}
+
+				dependents = append(dependents, d.Dependent)
+			}
+		}
+
+		// aborting the transaction restores the client, a joined transaction has to be aborted by its caller
+		if cascade == CascadeRestrict && len(dependents) > 0 {
+			return ErrHasDependents
+		}
+
+		return nil
+	})
+
+	return dependents, err
+}
+
+func (m *mongoClients) Restore(ctx context.Context, id primitive.ObjectID) (models.ClientBase, error) {
+	var restored models.ClientBase
+	err := restoreOne(ctx, m.collection, id, &restored)
+	return restored, err
+}
+
+func (m *mongoClients) Trash(ctx context.Context, limit int) ([]models.TrashItem, int, error) {
+	return mongoTrash(ctx, m.collection, clientsTextIndex, limit)
+}
+
+func (m *mongoClients) Purge(ctx context.Context, before time.Time) (int, error) {
+	return purgeDeleted(ctx, m.collection, before)
+}
+
+// mongoDependents returns the documents of the collection attached to the client that aren't in the trash
+func mongoDependents(ctx context.Context, collection mongoCollection, index textIndex, clientID primitive.ObjectID) ([]dependent, error) {
+	dependents := []dependent{}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"attached_to_client._id": clientID, "deleted_on": nil}},
+		{"$sort": bson.M{"_id": 1}},
+		{
+			"$project": bson.M{
+				"_id":     1,
+				"version": 1,
+				"type":    bson.M{"$literal": index.Type},
+				"title":   "$" + index.Title,
+				"shared": bson.M{
+					"$anyElementTrue": bson.A{
+						bson.M{"$map": bson.M{
+							"input": "$attached_to_client",
+							"in":    bson.M{"$ne": bson.A{"$$this._id", clientID}},
+						}},
+					},
+				},
+			},
+		},
+	}
+
+	ctx, cancel := collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &dependents)
+	return dependents, err
+}
+
+func (m *mongoClients) Search(ctx context.Context, query string, limit int) ([]models.SearchHit, int, error) {
+	return mongoSearch(ctx, m.collection, clientsTextIndex, query, limit)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type mongoContacts struct {
+	collection mongoCollection
+}
+
+// contactLookup joins the clients collection to get the client name and id for each contact using $lookup and $project
+var contactLookup = []bson.M{
+	{
+		"$lookup": bson.M{
+			"from":         "clients",
+			"localField":   "attached_to_client._id",
+			"foreignField": "_id",
+			"as":           "client",
+		},
+	},
+	// clients in the trash aren't joined
+	{"$addFields": bson.M{"client": withoutDeleted("client")}},
+	{
+		"$project": bson.M{
+			"_id":                1,
+			"first_name":         1,
+			"last_name":          1,
+			"full_name":          1,
+			"email":              1,
+			"phone_number":       1,
+			"role":               1,
+			"created_on":         1,
+			"modified_on":        1,
+			"version":            1,
+			"client._id":         1,
+			"client.client_name": 1,
+		},
+	},
+}
+
+func (m *mongoContacts) List(ctx context.Context, opts ListOptions) ([]models.ContactResponse, int, error) {
+	contacts := []models.ContactResponse{}
+	total, err := aggregatePage(ctx, m.collection, paginate(opts, notDeleted, contactLookup), &contacts)
+	return contacts, total, err
+}
+
+func (m *mongoContacts) Export(ctx context.Context, opts ListOptions) (Cursor, error) {
+	return export(ctx, m.collection, opts, notDeleted, contactLookup)
+}
+
+func (m *mongoContacts) Get(ctx context.Context, id primitive.ObjectID) (models.ContactResponse, error) {
+	var contact models.ContactResponse
+	pipeline := append([]bson.M{{"$match": bson.M{"_id": id, "deleted_on": nil}}}, contactLookup...)
+	err := aggregateOne(ctx, m.collection, pipeline, &contact)
+	return contact, err
+}
+
+func (m *mongoContacts) Find(ctx context.Context, id primitive.ObjectID) (models.ContactsBase, error) {
+	var contact models.ContactsBase
+	err := findOne(ctx, m.collection, id, &contact)
+	return contact, err
+}
+
+func (m *mongoContacts) Insert(ctx context.Context, contact models.ContactsBase) (primitive.ObjectID, error) {
+	contact.Version = 1
+	return insertOne(ctx, m.collection, contact)
+}
+
+func (m *mongoContacts) Replace(ctx context.Context, id primitive.ObjectID, version int64, contact models.ContactsBase) (models.ContactsBase, error) {
+	var replaced models.ContactsBase
+	contact.ID, contact.Version = id, version+1
+	err := replaceOne(ctx, m.collection, id, version, contact, &replaced)
+	return replaced, err
+}
+
+func (m *mongoContacts) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ContactsBase, error) {
+	var patched models.ContactsBase
+	err := patchOne(ctx, m.collection, id, version, changes, &patched)
+	return patched, err
+}
+
+func (m *mongoContacts) Attach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ContactsBase, error) {
+	var attached models.ContactsBase
+	err := attachOne(ctx, m.collection, id, clientID, &attached)
+	return attached, err
+}
+
+func (m *mongoContacts) Detach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ContactsBase, error) {
+	var detached models.ContactsBase
+	err := detachOne(ctx, m.collection, id, clientID, &detached)
+	return detached, err
+}
+
+func (m *mongoContacts) Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string) error {
+	return trashOne(ctx, m.collection, id, version, deletedBy)
+}
+
+func (m *mongoContacts) Restore(ctx context.Context, id primitive.ObjectID) (models.ContactsBase, error) {
+	var restored models.ContactsBase
+	err := restoreOne(ctx, m.collection, id, &restored)
+	return restored, err
+}
+
+func (m *mongoContacts) Trash(ctx context.Context, limit int) ([]models.TrashItem, int, error) {
+	return mongoTrash(ctx, m.collection, contactsTextIndex, limit)
+}
+
+func (m *mongoContacts) Purge(ctx context.Context, before time.Time) (int, error) {
+	return purgeDeleted(ctx, m.collection, before)
+}
+
+func (m *mongoContacts) Search(ctx context.Context, query string, limit int) ([]models.SearchHit, int, error) {
+	return mongoSearch(ctx, m.collection, contactsTextIndex, query, limit)
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoInvoices struct {
+	collection mongoCollection
+	// numbers holds a counter document per year, keyed by the year
+	numbers mongoCollection
+}
+
+func (m *mongoInvoices) List(ctx context.Context, opts ListOptions) ([]models.Invoice, int, error) {
+	invoices := []models.Invoice{}
+	total, err := aggregatePage(ctx, m.collection, paginate(opts, nil, nil), &invoices)
+	if err != nil {
+		return nil, 0, err
+	}
+	return invoices, total, nil
+}
+
+func (m *mongoInvoices) Find(ctx context.Context, id primitive.ObjectID) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := findOne(ctx, m.collection, id, &invoice)
+	return invoice, err
+}
+
+func (m *mongoInvoices) Overlaps(ctx context.Context, clientID primitive.ObjectID, currency string, start time.Time, end time.Time) (bool, error) {
+	return exists(ctx, m.collection, bson.M{
+		"client_id":    clientID,
+		"currency":     currency,
+		"status":       bson.M{"$ne": models.InvoiceVoid},
+		"period_start": bson.M{"$lt": end},
+		"period_end":   bson.M{"$gt": start},
+	})
+}
+
+func (m *mongoInvoices) Insert(ctx context.Context, invoice models.Invoice) (primitive.ObjectID, error) {
+	invoice.Version = 1
+	id, err := insertOne(ctx, m.collection, invoice)
+	if mongo.IsDuplicateKeyError(err) {
+		return id, ErrAlreadyExists
+	}
+	return id, err
+}
+
+func (m *mongoInvoices) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := patchOne(ctx, m.collection, id, version, changes, &invoice)
+	return invoice, err
+}
+
+// NextNumber increments the counter of the year with an upsert, so concurrent calls never get the same number
+func (m *mongoInvoices) NextNumber(ctx context.Context, year int) (int64, error) {
+	var counter struct {
+		Sequence int64 `bson:"sequence"`
+	}
+
+	ctx, cancel := m.numbers.operation(ctx)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := m.numbers.FindOneAndUpdate(ctx,
+		bson.M{"_id": strconv.Itoa(year)},
+		bson.M{"$inc": bson.M{"sequence": 1}},
+		opts,
+	).Decode(&counter)
+	return counter.Sequence, err
+}
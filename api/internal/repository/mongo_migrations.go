@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// plainNumber matches amounts stored as doubles or integers before amounts were stored as Decimal128
+var plainNumber = bson.M{"$type": bson.A{"double", "int", "long"}}
+
+// toDecimal returns an expression converting the amount of expression to a Decimal128, a missing amount becomes 0
+func toDecimal(expression interface{}) bson.M {
+	return bson.M{"$toDecimal": bson.M{"$ifNull": bson.A{expression, 0}}}
+}
+
+// withCurrency returns an expression keeping the currency of a document or setting currency if it has none
+func withCurrency(currency string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$in": bson.A{bson.M{"$ifNull": bson.A{"$currency", ""}}, bson.A{""}}},
+		currency,
+		"$currency",
+	}}
+}
+
+// MigrateMoney converts the amounts of services and invoices stored as doubles or integers to Decimal128 and sets
+// the currency of the documents without one to currency. Services seeded with the legacy Invoice_amount key get their
+// amount moved to invoice_amount. Every migrated document gets a new version, documents
+// migrated before are left alone so the migration can be run again. It returns the number of migrated documents
+// of each collection.
+// Updates with an aggregation pipeline require mongoDB 4.2.
+func MigrateMoney(ctx context.Context, db *mongo.Database, currency string) (map[string]int64, error) {
+	noCurrency := bson.M{"currency": bson.M{"$in": bson.A{nil, ""}}}
+	nextVersion := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}}
+
+	migrations := []struct {
+		collection string
+		filter     bson.M
+		update     bson.A
+	}{
+		{
+			collection: "services",
+			filter: bson.M{"$or": bson.A{
+				bson.M{"invoice_amount": plainNumber},
+				bson.M{"management_fee": plainNumber},
+				bson.M{"Invoice_amount": bson.M{"$exists": true}},
+				noCurrency,
+			}},
+			update: bson.A{bson.M{"$set": bson.M{
+				"invoice_amount": toDecimal(bson.M{"$ifNull": bson.A{"$invoice_amount", "$Invoice_amount"}}),
+				"management_fee": toDecimal("$management_fee"),
+				"currency":       withCurrency(currency),
+				"version":        nextVersion,
+			}}, bson.M{"$unset": "Invoice_amount"}},
+		},
+		{
+			collection: "invoices",
+			filter: bson.M{"$or": bson.A{
+				bson.M{"total": plainNumber},
+				bson.M{"lines.amount": plainNumber},
+				bson.M{"lines.unit_amount": plainNumber},
+				noCurrency,
+			}},
+			update: bson.A{bson.M{"$set": bson.M{
+				"total": toDecimal("$total"),
+				"lines": bson.M{"$map": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$lines", bson.A{}}},
+					"in": bson.M{"$mergeObjects": bson.A{"$$this", bson.M{
+						"unit_amount": toDecimal("$$this.unit_amount"),
+						"amount":      toDecimal("$$this.amount"),
+					}}},
+				}},
+				"currency": withCurrency(currency),
+				"version":  nextVersion,
+			}}},
+		},
+	}
+
+	migrated := map[string]int64{}
+	for _, migration := range migrations {
+		result, err := db.Collection(migration.collection).UpdateMany(ctx, migration.filter, migration.update)
+		if err != nil {
+			return migrated, err
+		}
+		migrated[migration.collection] = result.ModifiedCount
+		log.Info("Migrated amounts of ", result.ModifiedCount, " ", migration.collection)
+	}
+
+	return migrated, nil
+}
+
+// MigrateServiceStatuses maps the statuses of services stored before the lifecycle was defined onto it with
+// models.MigratedServiceStatus, services without a status and free text statuses get fallback. The transition is
+// recorded as made by the migration and every migrated service gets a new version. It returns the number of
+// migrated services.
+func MigrateServiceStatuses(ctx context.Context, db *mongo.Database, fallback string) (int64, error) {
+	collection := db.Collection("services")
+	defined := bson.A{
+		models.StatusProposed, models.StatusOnboarding, models.StatusActive, models.StatusSuspended, models.StatusDecommissioned,
+	}
+	legacy := bson.M{"service_status": bson.M{"$nin": defined}}
+
+	statuses, err := collection.Distinct(ctx, "service_status", legacy)
+	if err != nil {
+		return 0, err
+	}
+
+	// a missing status isn't returned by distinct, it is migrated like an empty one
+	statuses = append(statuses, nil)
+
+	var migrated int64
+	for _, status := range statuses {
+		text, _ := status.(string)
+		next := models.MigratedServiceStatus(text, fallback)
+
+		filter := bson.M{"$and": bson.A{legacy, bson.M{"service_status": status}}}
+		update := bson.M{
+			"$set": bson.M{
+				"service_status":    next,
+				"status_changed_on": time.Now(),
+				"status_changed_by": "migrate",
+			},
+			"$inc": bson.M{"version": 1},
+		}
+		result, err := collection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return migrated, err
+		}
+		if result.ModifiedCount > 0 {
+			log.Info("Migrated the status of ", result.ModifiedCount, " services from ", status, " to ", next)
+		}
+		migrated += result.ModifiedCount
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type mongoServices struct {
+	collection mongoCollection
+}
+
+// serviceLookup joins the clients collection to get the client name and id for each service using $lookup and $project
+var serviceLookup = []bson.M{
+	{
+		"$lookup": bson.M{
+			"from":         "clients",
+			"localField":   "attached_to_client._id",
+			"foreignField": "_id",
+			"as":           "client",
+		},
+	},
+	// clients in the trash aren't joined
+	{"$addFields": bson.M{"client": withoutDeleted("client")}},
+	{
+		"$project": bson.M{
+			"_id":                 1,
+			"service_name":        1,
+			"service_type":        1,
+			"service_owner":       1,
+			"service_description": 1,
+			"service_status":      1,
+			"status_changed_on":   1,
+			"status_changed_by":   1,
+			"invoice_frequency":   1,
+			"invoice_amount":      1,
+			"management_fee":      1,
+			"currency":            1,
+			"created_on":          1,
+			"modified_on":         1,
+			"version":             1,
+			"client._id":          1,
+			"client.client_name":  1,
+		},
+	},
+}
+
+func (m *mongoServices) List(ctx context.Context, opts ListOptions) ([]models.ServiceResponse, int, error) {
+	services := []models.ServiceResponse{}
+	total, err := aggregatePage(ctx, m.collection, paginate(opts, notDeleted, serviceLookup), &services)
+	return services, total, err
+}
+
+func (m *mongoServices) Export(ctx context.Context, opts ListOptions) (Cursor, error) {
+	return export(ctx, m.collection, opts, notDeleted, serviceLookup)
+}
+
+func (m *mongoServices) Get(ctx context.Context, id primitive.ObjectID) (models.ServiceResponse, error) {
+	var service models.ServiceResponse
+	pipeline := append([]bson.M{{"$match": bson.M{"_id": id, "deleted_on": nil}}}, serviceLookup...)
+	err := aggregateOne(ctx, m.collection, pipeline, &service)
+	return service, err
+}
+
+func (m *mongoServices) Find(ctx context.Context, id primitive.ObjectID) (models.ServiceBase, error) {
+	var service models.ServiceBase
+	err := findOne(ctx, m.collection, id, &service)
+	return service, err
+}
+
+func (m *mongoServices) NameExists(ctx context.Context, name string) (bool, error) {
+	return exists(ctx, m.collection, bson.M{"service_name": name, "deleted_on": nil})
+}
+
+func (m *mongoServices) Insert(ctx context.Context, service models.ServiceBase) (primitive.ObjectID, error) {
+	service.Version = 1
+	return insertOne(ctx, m.collection, service)
+}
+
+func (m *mongoServices) Replace(ctx context.Context, id primitive.ObjectID, version int64, service models.ServiceBase) (models.ServiceBase, error) {
+	var replaced models.ServiceBase
+	service.ID, service.Version = id, version+1
+	err := replaceOne(ctx, m.collection, id, version, service, &replaced)
+	return replaced, err
+}
+
+func (m *mongoServices) Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ServiceBase, error) {
+	var patched models.ServiceBase
+	err := patchOne(ctx, m.collection, id, version, changes, &patched)
+	return patched, err
+}
+
+func (m *mongoServices) Attach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ServiceBase, error) {
+	var attached models.ServiceBase
+	err := attachOne(ctx, m.collection, id, clientID, &attached)
+	return attached, err
+}
+
+func (m *mongoServices) Detach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ServiceBase, error) {
+	var detached models.ServiceBase
+	err := detachOne(ctx, m.collection, id, clientID, &detached)
+	return detached, err
+}
+
+func (m *mongoServices) Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string) error {
+	return trashOne(ctx, m.collection, id, version, deletedBy)
+}
+
+func (m *mongoServices) Restore(ctx context.Context, id primitive.ObjectID) (models.ServiceBase, error) {
+	var restored models.ServiceBase
+	err := restoreOne(ctx, m.collection, id, &restored)
+	return restored, err
+}
+
+func (m *mongoServices) Trash(ctx context.Context, limit int) ([]models.TrashItem, int, error) {
+	return mongoTrash(ctx, m.collection, servicesTextIndex, limit)
+}
+
+func (m *mongoServices) Purge(ctx context.Context, before time.Time) (int, error) {
+	return purgeDeleted(ctx, m.collection, before)
+}
+
+func (m *mongoServices) Search(ctx context.Context, query string, limit int) ([]models.SearchHit, int, error) {
+	return mongoSearch(ctx, m.collection, servicesTextIndex, query, limit)
+}
+
+// Revenue runs a $group pipeline, services with an unknown invoice frequency get a null monthly revenue which
+// $sum ignores
+func (m *mongoServices) Revenue(ctx context.Context, groupBy string, filters []Filter, monthlyFactors map[string]float64) ([]models.RevenueGroup, error) {
+	frequency := bson.M{"$toLower": bson.M{"$trim": bson.M{"input": bson.M{"$ifNull": bson.A{"$invoice_frequency", ""}}}}}
+	branches := bson.A{}
+	for name, factor := range monthlyFactors {
+		branches = append(branches, bson.M{"case": bson.M{"$eq": bson.A{frequency, name}}, "then": factor})
+	}
+
+	pipeline := append(mongoMatch(ListOptions{Filters: filters}, notDeleted), bson.M{
+		"$addFields": bson.M{
+			"monthly": bson.M{"$multiply": bson.A{
+				bson.M{"$add": bson.A{
+					bson.M{"$ifNull": bson.A{"$invoice_amount", 0}},
+					bson.M{"$ifNull": bson.A{"$management_fee", 0}},
+				}},
+				bson.M{"$switch": bson.M{"branches": branches, "default": nil}},
+			}},
+			"share": 1,
+		},
+	})
+
+	key := "$" + groupBy
+	if groupBy == RevenueByClient {
+		// one document per attached client carrying its share, services without clients are kept under a null key
+		clients := bson.M{"$ifNull": bson.A{"$attached_to_client", bson.A{}}}
+		pipeline = append(pipeline,
+			bson.M{"$addFields": bson.M{
+				"share": bson.M{"$divide": bson.A{1, bson.M{"$max": bson.A{1, bson.M{"$size": clients}}}}},
+				"clients": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$size": clients}, 0}},
+					bson.A{bson.M{"_id": nil}},
+					clients,
+				}},
+			}},
+			bson.M{"$unwind": "$clients"},
+		)
+		key = "$clients._id"
+	}
+
+	pipeline = append(pipeline, bson.M{
+		"$group": bson.M{
+			"_id":          bson.M{"key": key, "currency": "$currency"},
+			"services":     bson.M{"$sum": 1},
+			"monthly":      bson.M{"$sum": bson.M{"$multiply": bson.A{"$monthly", "$share"}}},
+			"unnormalized": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$monthly", nil}}, 1, 0}}},
+		},
+	})
+
+	name := bson.M{"$literal": ""}
+	if groupBy == RevenueByClient {
+		pipeline = append(pipeline, bson.M{
+			"$lookup": bson.M{
+				"from":         "clients",
+				"localField":   "_id.key",
+				"foreignField": "_id",
+				"as":           "client",
+			},
+		})
+		name = bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$client.client_name", 0}}, ""}}
+	}
+
+	pipeline = append(pipeline, bson.M{
+		"$project": bson.M{
+			"_id":          0,
+			"key":          bson.M{"$ifNull": bson.A{bson.M{"$toString": "$_id.key"}, ""}},
+			"name":         name,
+			"currency":     bson.M{"$ifNull": bson.A{"$_id.currency", ""}},
+			"services":     1,
+			"unnormalized": 1,
+			"monthly":      1,
+		},
+	})
+
+	revenueCtx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := m.collection.Aggregate(revenueCtx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []models.RevenueGroup{}
+	if err := cursor.All(revenueCtx, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
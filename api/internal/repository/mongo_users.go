@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoUsers struct {
+	collection mongoCollection
+}
+
+func (m *mongoUsers) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	err := m.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (m *mongoUsers) Insert(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	return insertOne(ctx, m.collection, user)
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eventFilters returns the event filters of webhooks matching the event type, e.g. service.updated, service.* and *
+func eventFilters(event string) []string {
+	entity := strings.SplitN(event, ".", 2)[0]
+	return []string{event, entity + ".*", "*"}
+}
+
+type mongoWebhooks struct {
+	collection mongoCollection
+}
+
+func (m *mongoWebhooks) List(ctx context.Context, opts ListOptions) ([]models.Webhook, int, error) {
+	webhooks := []models.Webhook{}
+	total, err := aggregatePage(ctx, m.collection, paginate(opts, nil, nil), &webhooks)
+	if err != nil {
+		return nil, 0, err
+	}
+	return webhooks, total, nil
+}
+
+func (m *mongoWebhooks) Find(ctx context.Context, id primitive.ObjectID) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := findOne(ctx, m.collection, id, &webhook)
+	return webhook, err
+}
+
+func (m *mongoWebhooks) Subscribed(ctx context.Context, event string) ([]models.Webhook, error) {
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	cursor, err := m.collection.Find(ctx, bson.M{"events": bson.M{"$in": eventFilters(event)}, "disabled": false})
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []models.Webhook{}
+	err = cursor.All(ctx, &webhooks)
+	return webhooks, err
+}
+
+func (m *mongoWebhooks) Insert(ctx context.Context, webhook models.Webhook) (primitive.ObjectID, error) {
+	webhook.Version = 1
+	return insertOne(ctx, m.collection, webhook)
+}
+
+func (m *mongoWebhooks) Replace(ctx context.Context, id primitive.ObjectID, version int64, webhook models.Webhook) (models.Webhook, error) {
+	webhook.ID, webhook.Version = id, version+1
+
+	var replaced models.Webhook
+	err := replaceOne(ctx, m.collection, id, version, webhook, &replaced)
+	return replaced, err
+}
+
+func (m *mongoWebhooks) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	result, err := m.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoDeliveries struct {
+	collection mongoCollection
+}
+
+func (m *mongoDeliveries) List(ctx context.Context, opts ListOptions) ([]models.WebhookDelivery, int, error) {
+	deliveries := []models.WebhookDelivery{}
+	total, err := aggregatePage(ctx, m.collection, paginate(opts, nil, nil), &deliveries)
+	if err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+func (m *mongoDeliveries) Find(ctx context.Context, id primitive.ObjectID) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := findOne(ctx, m.collection, id, &delivery)
+	return delivery, err
+}
+
+func (m *mongoDeliveries) Insert(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	documents := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		documents[i] = delivery
+	}
+
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	_, err := m.collection.InsertMany(ctx, documents)
+	return err
+}
+
+// Claim takes the lease with a single update, so concurrent workers never claim the same delivery
+func (m *mongoDeliveries) Claim(ctx context.Context, now time.Time, lease time.Duration) (models.WebhookDelivery, error) {
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	var delivery models.WebhookDelivery
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_on", Value: 1}}).
+		SetReturnDocument(options.After)
+	err := m.collection.FindOneAndUpdate(ctx,
+		bson.M{"status": models.DeliveryPending, "next_attempt_on": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_on": now.Add(lease)}},
+		opts,
+	).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return delivery, ErrNotFound
+	}
+	return delivery, err
+}
+
+func (m *mongoDeliveries) Record(ctx context.Context, id primitive.ObjectID, attempt models.DeliveryAttempt, status string, failures int, next *time.Time) error {
+	set := bson.M{"status": status, "failures": failures}
+	update := bson.M{"$push": bson.M{"attempts": attempt}, "$set": set}
+	if next != nil {
+		set["next_attempt_on"] = *next
+	} else {
+		update["$unset"] = bson.M{"next_attempt_on": ""}
+	}
+	if status == models.DeliveryDelivered {
+		set["delivered_on"] = attempt.AttemptedOn
+	}
+
+	ctx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	result, err := m.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoDeliveries) Requeue(ctx context.Context, id primitive.ObjectID, now time.Time) (models.WebhookDelivery, error) {
+	requeueCtx, cancel := m.collection.operation(ctx)
+	defer cancel()
+
+	var delivery models.WebhookDelivery
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := m.collection.FindOneAndUpdate(requeueCtx,
+		bson.M{"_id": id, "status": bson.M{"$ne": models.DeliveryPending}},
+		bson.M{"$set": bson.M{"status": models.DeliveryPending, "failures": 0, "next_attempt_on": now}},
+		opts,
+	).Decode(&delivery)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return delivery, err
+	}
+
+	found, err := exists(ctx, m.collection, bson.M{"_id": id})
+	if err != nil {
+		return delivery, err
+	}
+	if found {
+		return delivery, ErrPending
+	}
+	return delivery, ErrNotFound
+}
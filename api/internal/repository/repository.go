@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/terrpan/clientdb/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when no document matches the given id
+	ErrNotFound = errors.New("document not found")
+	// ErrVersionConflict is returned when a document was changed since the version the update is based on
+	ErrVersionConflict = errors.New("document version conflict")
+	// ErrAlreadyExists is returned when a unique index refuses a new document
+	ErrAlreadyExists = errors.New("document already exists")
+	// ErrHasDependents is returned when a client isn't deleted because services or contacts are attached to it
+	ErrHasDependents = errors.New("document has dependents")
+	// ErrPending is returned when a webhook delivery is requeued while it is still pending
+	ErrPending = errors.New("delivery is pending")
+	// ErrInvalidToken is returned when a change feed can't be resumed at a token, because it is malformed or the
+	// change it points to is no longer in the history
+	ErrInvalidToken = errors.New("invalid resume token")
+)
+
+// Cascade policies applied to the services and contacts attached to a deleted client
+const (
+	// CascadeRestrict refuses to delete a client with dependents
+	CascadeRestrict = "restrict"
+	// CascadeDetach removes the client from the attached_to_client list of its dependents
+	CascadeDetach = "detach"
+	// CascadeDelete moves the dependents to the trash with the client, dependents attached to other clients as
+	// well are detached instead
+	CascadeDelete = "delete"
+)
+
+// RevenueByClient groups the revenue of services by the clients they are attached to instead of a document path,
+// the revenue of a service attached to several clients is split evenly between them
+const RevenueByClient = "client"
+
+// ScoreField is the sort field holding the relevance of a full text search
+const ScoreField = "score"
+
+// Filter operators accepted in a Filter
+const (
+	OpEq  = "eq"
+	OpNe  = "ne"
+	OpGt  = "gt"
+	OpGte = "gte"
+	OpLt  = "lt"
+	OpLte = "lte"
+	OpIn  = "in"
+	OpNin = "nin"
+)
+
+// Filter matches documents where the value at Path compares to Value using Operator.
+// Path is the document path, e.g. attached_to_client._id, and Value is a []interface{} for OpIn and OpNin.
+type Filter struct {
+	Path     string
+	Operator string
+	Value    interface{}
+}
+
+// ListOptions controls which page of documents a List call returns
+type ListOptions struct {
+	Start   int
+	End     int // 0 means no upper bound
+	Sort    string
+	Order   int // 1 ascending, -1 descending
+	Query   string
+	Filters []Filter
+}
+
+// Changes are the fields a partial update sets and removes, keyed by field name
+type Changes struct {
+	Set   map[string]interface{}
+	Unset []string
+}
+
+// Searcher runs a full text search on a collection and returns up to limit hits (0 means no limit) and the
+// total number of matching documents
+type Searcher interface {
+	Search(ctx context.Context, query string, limit int) ([]models.SearchHit, int, error)
+}
+
+// TrashBin lists and purges the deleted documents of a collection
+type TrashBin interface {
+	// Trash returns up to limit deleted documents (0 means no limit), most recently deleted first, and the total
+	// number of deleted documents
+	Trash(ctx context.Context, limit int) ([]models.TrashItem, int, error)
+	// Purge permanently removes the documents deleted before the time and returns how many were removed
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// Cursor iterates over the documents of an export one at a time, *mongo.Cursor is a Cursor
+type Cursor interface {
+	Next(ctx context.Context) bool
+	Decode(v interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Deleted documents are kept in the trash until they are purged, all lookups except the ones of the TrashBin
+// ignore them.
+
+type ClientRepository interface {
+	Searcher
+	TrashBin
+	// List returns a page of clients with their services and contacts and the total number of matching clients
+	List(ctx context.Context, opts ListOptions) ([]models.ClientResponse, int, error)
+	// Export returns a cursor over every client matching opts with their services and contacts, decoded as models.ClientResponse.
+	// The page of opts is ignored and the documents are read as the cursor advances.
+	Export(ctx context.Context, opts ListOptions) (Cursor, error)
+	Get(ctx context.Context, id primitive.ObjectID) (models.ClientResponse, error)
+	// Find returns the stored document without the joined fields
+	Find(ctx context.Context, id primitive.ObjectID) (models.ClientBase, error)
+	NameExists(ctx context.Context, name string) (bool, error)
+	// FindByNames returns the clients named one of names, a name may belong to more than one client
+	FindByNames(ctx context.Context, names []string) ([]models.ClientBase, error)
+	// Missing returns the ids among ids that don't belong to a client, clients in the trash count as missing
+	Missing(ctx context.Context, ids []primitive.ObjectID) ([]primitive.ObjectID, error)
+	// Insert stores a new client at version 1
+	Insert(ctx context.Context, client models.ClientBase) (primitive.ObjectID, error)
+	// Replace replaces the stored document with client if it is still at version and returns the new document
+	Replace(ctx context.Context, id primitive.ObjectID, version int64, client models.ClientBase) (models.ClientBase, error)
+	// Patch sets and removes the changed fields if the document is still at version and returns the updated document
+	Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ClientBase, error)
+	// Delete moves the client to the trash if it is still at version and applies the cascade policy to the services
+	// and contacts attached to it, all or nothing. It returns the dependents and the action applied to each, with
+	// CascadeRestrict the dependents are returned with ErrHasDependents and nothing is deleted.
+	Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string, cascade string) ([]models.Dependent, error)
+	// Restore takes the document out of the trash and returns it
+	Restore(ctx context.Context, id primitive.ObjectID) (models.ClientBase, error)
+}
+
+type ServiceRepository interface {
+	Searcher
+	TrashBin
+	// List returns a page of services with their clients and the total number of matching services
+	List(ctx context.Context, opts ListOptions) ([]models.ServiceResponse, int, error)
+	// Export returns a cursor over every service matching opts with their clients, decoded as models.ServiceResponse.
+	// The page of opts is ignored and the documents are read as the cursor advances.
+	Export(ctx context.Context, opts ListOptions) (Cursor, error)
+	Get(ctx context.Context, id primitive.ObjectID) (models.ServiceResponse, error)
+	// Find returns the stored document without the joined fields
+	Find(ctx context.Context, id primitive.ObjectID) (models.ServiceBase, error)
+	NameExists(ctx context.Context, name string) (bool, error)
+	// Insert stores a new service at version 1
+	Insert(ctx context.Context, service models.ServiceBase) (primitive.ObjectID, error)
+	// Replace replaces the stored document with service if it is still at version and returns the new document
+	Replace(ctx context.Context, id primitive.ObjectID, version int64, service models.ServiceBase) (models.ServiceBase, error)
+	// Patch sets and removes the changed fields if the document is still at version and returns the updated document
+	Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ServiceBase, error)
+	// Attach adds the client to attached_to_client with $addToSet and returns the service, attaching a client again
+	// changes nothing
+	Attach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ServiceBase, error)
+	// Detach removes the client from attached_to_client with $pull and returns the service, ErrNotFound is returned
+	// when the service isn't attached to the client
+	Detach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ServiceBase, error)
+	// Delete moves the document to the trash if it is still at version, deletedBy is recorded with the deletion time
+	Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string) error
+	// Restore takes the document out of the trash and returns it
+	Restore(ctx context.Context, id primitive.ObjectID) (models.ServiceBase, error)
+	// Revenue sums the monthly revenue, invoice amount plus management fee times the factor of the lower case
+	// invoice frequency, of the services matching filters per value of the groupBy path or RevenueByClient and
+	// currency. The sums aren't rounded, Annual is left to the caller and the groups are returned in no particular
+	// order.
+	Revenue(ctx context.Context, groupBy string, filters []Filter, monthlyFactors map[string]float64) ([]models.RevenueGroup, error)
+}
+
+type ContactRepository interface {
+	Searcher
+	TrashBin
+	// List returns a page of contacts with their clients and the total number of matching contacts
+	List(ctx context.Context, opts ListOptions) ([]models.ContactResponse, int, error)
+	// Export returns a cursor over every contact matching opts with their clients, decoded as models.ContactResponse.
+	// The page of opts is ignored and the documents are read as the cursor advances.
+	Export(ctx context.Context, opts ListOptions) (Cursor, error)
+	Get(ctx context.Context, id primitive.ObjectID) (models.ContactResponse, error)
+	// Find returns the stored document without the joined fields
+	Find(ctx context.Context, id primitive.ObjectID) (models.ContactsBase, error)
+	// Insert stores a new contact at version 1
+	Insert(ctx context.Context, contact models.ContactsBase) (primitive.ObjectID, error)
+	// Replace replaces the stored document with contact if it is still at version and returns the new document
+	Replace(ctx context.Context, id primitive.ObjectID, version int64, contact models.ContactsBase) (models.ContactsBase, error)
+	// Patch sets and removes the changed fields if the document is still at version and returns the updated document
+	Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.ContactsBase, error)
+	// Attach adds the client to attached_to_client with $addToSet and returns the contact, attaching a client again
+	// changes nothing
+	Attach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ContactsBase, error)
+	// Detach removes the client from attached_to_client with $pull and returns the contact, ErrNotFound is returned
+	// when the contact isn't attached to the client
+	Detach(ctx context.Context, id primitive.ObjectID, clientID primitive.ObjectID) (models.ContactsBase, error)
+	// Delete moves the document to the trash if it is still at version, deletedBy is recorded with the deletion time
+	Delete(ctx context.Context, id primitive.ObjectID, version int64, deletedBy string) error
+	// Restore takes the document out of the trash and returns it
+	Restore(ctx context.Context, id primitive.ObjectID) (models.ContactsBase, error)
+}
+
+type InvoiceRepository interface {
+	// List returns a page of invoices and the total number of matching invoices
+	List(ctx context.Context, opts ListOptions) ([]models.Invoice, int, error)
+	Find(ctx context.Context, id primitive.ObjectID) (models.Invoice, error)
+	// Overlaps reports whether the client has an invoice in currency that isn't void for a period overlapping start
+	// to end
+	Overlaps(ctx context.Context, clientID primitive.ObjectID, currency string, start time.Time, end time.Time) (bool, error)
+	// Insert stores a new invoice at version 1, ErrAlreadyExists is returned when the client has an invoice in the
+	// currency that isn't void for a period starting at the same time
+	Insert(ctx context.Context, invoice models.Invoice) (primitive.ObjectID, error)
+	// Patch sets and removes the changed fields if the document is still at version and returns the updated document
+	Patch(ctx context.Context, id primitive.ObjectID, version int64, changes Changes) (models.Invoice, error)
+	// NextNumber returns the next number of the invoice sequence of year, every call returns a new number
+	NextNumber(ctx context.Context, year int) (int64, error)
+}
+
+type APIKeyRepository interface {
+	// FindByHash returns the key with the hash, revoked keys are returned as well
+	FindByHash(ctx context.Context, hash string) (models.APIKey, error)
+	Insert(ctx context.Context, key models.APIKey) (primitive.ObjectID, error)
+}
+
+type UserRepository interface {
+	// FindByUsername returns the user with the username, disabled users are returned as well
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+	Insert(ctx context.Context, user models.User) (primitive.ObjectID, error)
+}
+
+type AuditRepository interface {
+	Insert(ctx context.Context, entry models.AuditEntry) error
+	// List returns a page of audit entries and the total number of matching entries
+	List(ctx context.Context, opts ListOptions) ([]models.AuditEntry, int, error)
+}
+
+type WebhookRepository interface {
+	// List returns a page of webhooks and the total number of matching webhooks
+	List(ctx context.Context, opts ListOptions) ([]models.Webhook, int, error)
+	Find(ctx context.Context, id primitive.ObjectID) (models.Webhook, error)
+	// Subscribed returns the webhooks that aren't disabled and whose events match the event type, e.g.
+	// service.updated matches service.updated, service.* and *
+	Subscribed(ctx context.Context, event string) ([]models.Webhook, error)
+	// Insert stores a new webhook at version 1
+	Insert(ctx context.Context, webhook models.Webhook) (primitive.ObjectID, error)
+	// Replace replaces the webhook if it is still at version and returns the new document
+	Replace(ctx context.Context, id primitive.ObjectID, version int64, webhook models.Webhook) (models.Webhook, error)
+	// Delete removes the webhook, its deliveries are kept for the delivery log
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// DeliveryRepository is the queue of webhook deliveries, a delivery is pending until it is delivered or dead
+type DeliveryRepository interface {
+	// List returns a page of deliveries and the total number of matching deliveries
+	List(ctx context.Context, opts ListOptions) ([]models.WebhookDelivery, int, error)
+	Find(ctx context.Context, id primitive.ObjectID) (models.WebhookDelivery, error)
+	Insert(ctx context.Context, deliveries []models.WebhookDelivery) error
+	// Claim returns the pending delivery that is due the longest at now and postpones its next attempt by lease,
+	// so it isn't claimed again while it is delivered. A delivery whose attempt isn't recorded, e.g. because the
+	// process stopped, is claimed again after the lease. ErrNotFound is returned when no delivery is due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (models.WebhookDelivery, error)
+	// Record adds attempt to the log of the delivery and sets its status and failures, next is the time of the
+	// next attempt of a pending delivery
+	Record(ctx context.Context, id primitive.ObjectID, attempt models.DeliveryAttempt, status string, failures int, next *time.Time) error
+	// Requeue makes a delivery that isn't pending due again at now with no failures and returns it, ErrPending is
+	// returned for a pending delivery
+	Requeue(ctx context.Context, id primitive.ObjectID, now time.Time) (models.WebhookDelivery, error)
+}
+
+// Transactions runs changes across repositories all together or not at all
+type Transactions interface {
+	// Run calls fn in a transaction, the repository calls made with the context passed to fn belong to it. The
+	// transaction is committed when fn returns nil and rolled back otherwise. fn may be called more than once
+	// when the transaction is retried, so it must not keep state from an earlier attempt.
+	Run(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// ChangeFeed streams the changes of the clients, services and contacts as they are committed
+type ChangeFeed interface {
+	// Watch returns a stream of the changes of entities, starting after the change of token or, when token is
+	// empty, with the next change. ErrInvalidToken is returned when the feed can't be resumed at token.
+	Watch(ctx context.Context, entities []string, token string) (ChangeStream, error)
+}
+
+// ChangeStream iterates over the changes of a feed
+type ChangeStream interface {
+	// TryNext waits a short while for the next change, it returns false when none came or the stream failed and
+	// Err tells them apart
+	TryNext(ctx context.Context) bool
+	// Change returns the change TryNext moved to
+	Change() models.Change
+	// Token resumes the stream after the last change it returned or, before the first one, where it started
+	Token() string
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Store bundles the repositories the API is served from
+type Store struct {
+	Clients      ClientRepository
+	Services     ServiceRepository
+	Contacts     ContactRepository
+	Invoices     InvoiceRepository
+	APIKeys      APIKeyRepository
+	Users        UserRepository
+	Audit        AuditRepository
+	Webhooks     WebhookRepository
+	Deliveries   DeliveryRepository
+	Transactions Transactions
+	Changes      ChangeFeed
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// textIndex describes the text index of a collection and how its documents are presented as search hits
+type textIndex struct {
+	Type        string
+	Weights     bson.D
+	Title       string
+	Description string
+}
+
+var (
+	clientsTextIndex = textIndex{
+		Type:        "clients",
+		Weights:     bson.D{{Key: "client_name", Value: 10}},
+		Title:       "client_name",
+		Description: "web_url",
+	}
+	servicesTextIndex = textIndex{
+		Type:        "services",
+		Weights:     bson.D{{Key: "service_name", Value: 10}, {Key: "service_description", Value: 2}},
+		Title:       "service_name",
+		Description: "service_description",
+	}
+	contactsTextIndex = textIndex{
+		Type:        "contacts",
+		Weights:     bson.D{{Key: "full_name", Value: 10}, {Key: "email", Value: 5}},
+		Title:       "full_name",
+		Description: "email",
+	}
+)
+
+// searchFactors multiply the weight of a field matching a term exactly, at the start of a word or anywhere, in the
+// order of the patterns of a searchTerm
+var searchFactors = []int{3, 2, 1}
+
+// searchTerm is a fragment of a search query, it is searched when no word of the query is in the text index. The
+// patterns are matched case-insensitively, the first one that
+// matches a field decides its score. They are valid both as Go and as mongoDB (PCRE) regular expressions.
+type searchTerm struct {
+	patterns []string
+	regexps  []*regexp.Regexp
+}
+
+// fragmentTerms splits a search query into fragments, the special characters of the fragments are escaped so they
+// only match themselves
+func fragmentTerms(query string) []searchTerm {
+	var terms []searchTerm
+	for _, fragment := range strings.Fields(query) {
+		quoted := regexp.QuoteMeta(fragment)
+		term := searchTerm{patterns: []string{"^" + quoted + "$", `(^|\W)` + quoted, quoted}}
+		for _, pattern := range term.patterns {
+			term.regexps = append(term.regexps, regexp.MustCompile("(?i)"+pattern))
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// fragment returns the pattern matching the term anywhere in a field
+func (t searchTerm) fragment() string {
+	return t.patterns[len(t.patterns)-1]
+}
+
+// score returns the score of the term in text for a field of weight
+func (t searchTerm) score(text string, weight int) int {
+	for i, re := range t.regexps {
+		if re.MatchString(text) {
+			return searchFactors[i] * weight
+		}
+	}
+	return 0
+}
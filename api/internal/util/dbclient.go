@@ -1,37 +1,75 @@
 package util
 
 import (
+	"context"
+	"net/url"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// DBConnect is a function to connect to the database
-func DbConnect() *mongo.Client {
+// maxRetryBackoff caps the exponential backoff between connection attempts
+const maxRetryBackoff = 30 * time.Second
+
+// redactConnectionString hides the password in a connection string so it can be logged, a string that can't be
+// parsed is hidden entirely
+func redactConnectionString(connectionString string) string {
+	u, err := url.Parse(connectionString)
+	if err != nil {
+		return "<invalid connection string>"
+	}
+	return u.Redacted()
+}
 
-	connectionString := "mongodb://" + MongoDBHost + ":" + MongoDBPort + "/" + MongoDBName
-	log.Debug("Using connection string: ", connectionString)
+// DBConnect connects to the database and verifies the connection, retrying with exponential backoff
+// until config.ConnectRetries attempts have failed or ctx is done
+func DbConnect(ctx context.Context, config Config) (*mongo.Client, error) {
+	connectionString := config.ConnectionString()
+	log.Debug("Using connection string: ", redactConnectionString(connectionString))
 	// Set client options
-	mongoOptions := options.Client().ApplyURI(connectionString)
+	mongoOptions := options.Client().
+		ApplyURI(connectionString).
+		SetConnectTimeout(config.ConnectTimeout).
+		SetServerSelectionTimeout(config.ConnectTimeout)
 
-	// Connect to MongoDB
+	// Connect only validates the options, the servers are dialed in the background
 	mongoClient, err := mongo.Connect(ctx, mongoOptions)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	// Check the connection
-	err = mongoClient.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal(err)
+	backoff := config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, config.ConnectTimeout)
+		err = mongoClient.Ping(pingCtx, nil)
+		cancel()
+		if err == nil {
+			break
+		}
+
+		if attempt >= config.ConnectRetries {
+			mongoClient.Disconnect(context.Background())
+			return nil, err
+		}
+
+		log.Warnf("Failed to connect to MongoDB (attempt %d of %d), retrying in %s: %s", attempt, config.ConnectRetries, backoff, err)
+		select {
+		case <-ctx.Done():
+			mongoClient.Disconnect(context.Background())
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
 	}
 
 	log.Info("Connected to MongoDB")
-	return mongoClient
-
-}
+	return mongoClient, nil
 
-func GetCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	collection := client.Database(MongoDBName).Collection(collectionName)
-	return collection
 }
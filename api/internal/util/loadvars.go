@@ -1,24 +1,174 @@
 package util
 
 import (
-	"context"
+	"fmt"
 	"os"
-
-	"go.mongodb.org/mongo-driver/mongo"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	VarPrefix = "CLIENTDB_"
 )
 
-var (
-	MongoDBHost               = GetEnv(VarPrefix+"MONGODB_HOST", "localhost")
-	MongoDBPort               = GetEnv(VarPrefix+"MONGODB_PORT", "27017")
-	MongoDBName               = GetEnv(VarPrefix+"MONGODB_DATABASE", "test")
-	LogLevel                  = GetEnv(VarPrefix+"LOG_LEVEL", "info")
-	ctx                       = context.TODO()
-	DB          *mongo.Client = DbConnect()
-)
+// Config holds the application settings, read from CLIENTDB_ prefixed environment variables
+type Config struct {
+	ListenAddr  string
+	LogLevel    string
+	MongoDBHost string
+	MongoDBPort string
+	MongoDBName string
+	// MongoDBURI overrides the connection string built from host, port and database name
+	MongoDBURI string
+	// ConnectTimeout bounds every attempt to reach the database
+	ConnectTimeout time.Duration
+	// ConnectRetries is the number of attempts made before giving up on the database
+	ConnectRetries int
+	// RetryBackoff is the wait after the first failed attempt, it doubles after every attempt
+	RetryBackoff time.Duration
+	// QueryTimeout is the deadline of every single database operation
+	QueryTimeout time.Duration
+	// ReadTimeout, WriteTimeout and IdleTimeout are passed on to the http.Server
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests may take to drain after SIGTERM or SIGINT
+	ShutdownTimeout time.Duration
+	// AllowedOrigins are the origins allowed to call the API from a browser
+	AllowedOrigins []string
+	// JWTKeysFile is the path to the JWKS file bearer tokens are verified against, tokens are rejected when unset
+	JWTKeysFile string
+	// JWTIssuer and JWTAudience are checked against the iss and aud claims when set
+	JWTIssuer   string
+	JWTAudience string
+	// JWTSigningKeyID is the kid of the symmetric key in the JWKS file the tokens of users logging in with a
+	// password are signed with, password login is disabled when unset
+	JWTSigningKeyID string
+	// JWTLifetime is how long the tokens issued at login are valid
+	JWTLifetime time.Duration
+	// TrashRetention is how long deleted documents are kept before they are purged, 0 keeps them forever
+	TrashRetention time.Duration
+	// PurgeInterval is how often the trash is checked for documents past the retention period
+	PurgeInterval time.Duration
+	// WebhookMaxAttempts is the number of failed attempts after which a webhook delivery is dead
+	WebhookMaxAttempts int
+	// WebhookBackoff is the wait after the first failed delivery attempt, it doubles after every attempt up to
+	// WebhookMaxBackoff
+	WebhookBackoff    time.Duration
+	WebhookMaxBackoff time.Duration
+	// WebhookTimeout bounds every delivery attempt
+	WebhookTimeout time.Duration
+	// WebhookPollInterval is how often the delivery queue is checked once it is empty
+	WebhookPollInterval time.Duration
+	// WebhookWorkers is the number of deliveries attempted at the same time
+	WebhookWorkers int
+}
+
+// LoadConfig reads the configuration from the environment, falling back to defaults for unset variables
+func LoadConfig() (Config, error) {
+	config := Config{
+		ListenAddr:  GetEnv(VarPrefix+"LISTEN_ADDR", ":8080"),
+		LogLevel:    GetEnv(VarPrefix+"LOG_LEVEL", "info"),
+		MongoDBHost: GetEnv(VarPrefix+"MONGODB_HOST", "localhost"),
+		MongoDBPort: GetEnv(VarPrefix+"MONGODB_PORT", "27017"),
+		MongoDBName: GetEnv(VarPrefix+"MONGODB_DATABASE", "test"),
+		MongoDBURI:  GetEnv(VarPrefix+"MONGODB_URI", ""),
+
+		AllowedOrigins: GetEnvList(VarPrefix+"CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000"}),
+		JWTKeysFile:    GetEnv(VarPrefix+"JWT_KEYS_FILE", ""),
+		JWTIssuer:      GetEnv(VarPrefix+"JWT_ISSUER", ""),
+		JWTAudience:    GetEnv(VarPrefix+"JWT_AUDIENCE", ""),
+
+		JWTSigningKeyID: GetEnv(VarPrefix+"JWT_SIGNING_KEY_ID", ""),
+	}
+
+	var err error
+	if config.ConnectTimeout, err = GetEnvDuration(VarPrefix+"MONGODB_CONNECT_TIMEOUT", 10*time.Second); err != nil {
+		return config, err
+	}
+	if config.ConnectRetries, err = GetEnvInt(VarPrefix+"MONGODB_CONNECT_RETRIES", 5); err != nil {
+		return config, err
+	}
+	if config.RetryBackoff, err = GetEnvDuration(VarPrefix+"MONGODB_RETRY_BACKOFF", time.Second); err != nil {
+		return config, err
+	}
+	if config.QueryTimeout, err = GetEnvDuration(VarPrefix+"QUERY_TIMEOUT", 10*time.Second); err != nil {
+		return config, err
+	}
+	if config.ReadTimeout, err = GetEnvDuration(VarPrefix+"READ_TIMEOUT", 15*time.Second); err != nil {
+		return config, err
+	}
+	if config.WriteTimeout, err = GetEnvDuration(VarPrefix+"WRITE_TIMEOUT", 30*time.Second); err != nil {
+		return config, err
+	}
+	if config.IdleTimeout, err = GetEnvDuration(VarPrefix+"IDLE_TIMEOUT", 60*time.Second); err != nil {
+		return config, err
+	}
+	if config.ShutdownTimeout, err = GetEnvDuration(VarPrefix+"SHUTDOWN_TIMEOUT", 30*time.Second); err != nil {
+		return config, err
+	}
+	if config.JWTLifetime, err = GetEnvDuration(VarPrefix+"JWT_LIFETIME", 8*time.Hour); err != nil {
+		return config, err
+	}
+	if config.TrashRetention, err = GetEnvDuration(VarPrefix+"TRASH_RETENTION", 30*24*time.Hour); err != nil {
+		return config, err
+	}
+	if config.PurgeInterval, err = GetEnvDuration(VarPrefix+"TRASH_PURGE_INTERVAL", time.Hour); err != nil {
+		return config, err
+	}
+
+	if config.WebhookMaxAttempts, err = GetEnvInt(VarPrefix+"WEBHOOK_MAX_ATTEMPTS", 8); err != nil {
+		return config, err
+	}
+	if config.WebhookBackoff, err = GetEnvDuration(VarPrefix+"WEBHOOK_BACKOFF", 30*time.Second); err != nil {
+		return config, err
+	}
+	if config.WebhookMaxBackoff, err = GetEnvDuration(VarPrefix+"WEBHOOK_MAX_BACKOFF", time.Hour); err != nil {
+		return config, err
+	}
+	if config.WebhookTimeout, err = GetEnvDuration(VarPrefix+"WEBHOOK_TIMEOUT", 10*time.Second); err != nil {
+		return config, err
+	}
+	if config.WebhookPollInterval, err = GetEnvDuration(VarPrefix+"WEBHOOK_POLL_INTERVAL", time.Second); err != nil {
+		return config, err
+	}
+	if config.WebhookWorkers, err = GetEnvInt(VarPrefix+"WEBHOOK_WORKERS", 4); err != nil {
+		return config, err
+	}
+
+	if config.ConnectRetries < 1 {
+		return config, fmt.Errorf("%sMONGODB_CONNECT_RETRIES must be at least 1", VarPrefix)
+	}
+	if config.JWTLifetime <= 0 {
+		return config, fmt.Errorf("%sJWT_LIFETIME must be positive", VarPrefix)
+	}
+	if config.PurgeInterval <= 0 {
+		return config, fmt.Errorf("%sTRASH_PURGE_INTERVAL must be positive", VarPrefix)
+	}
+	if config.WebhookMaxAttempts < 1 {
+		return config, fmt.Errorf("%sWEBHOOK_MAX_ATTEMPTS must be at least 1", VarPrefix)
+	}
+	if config.WebhookWorkers < 1 {
+		return config, fmt.Errorf("%sWEBHOOK_WORKERS must be at least 1", VarPrefix)
+	}
+	if config.WebhookBackoff <= 0 || config.WebhookMaxBackoff < config.WebhookBackoff {
+		return config, fmt.Errorf("%sWEBHOOK_BACKOFF must be positive and at most %sWEBHOOK_MAX_BACKOFF", VarPrefix, VarPrefix)
+	}
+	if config.WebhookTimeout <= 0 || config.WebhookPollInterval <= 0 {
+		return config, fmt.Errorf("%sWEBHOOK_TIMEOUT and %sWEBHOOK_POLL_INTERVAL must be positive", VarPrefix, VarPrefix)
+	}
+
+	return config, nil
+}
+
+// ConnectionString returns the mongoDB connection string
+func (c Config) ConnectionString() string {
+	if c.MongoDBURI != "" {
+		return c.MongoDBURI
+	}
+	return "mongodb://" + c.MongoDBHost + ":" + c.MongoDBPort + "/" + c.MongoDBName
+}
 
 // func GetEnv is a function to get environment variables to be able to set default values if not set
 func GetEnv(key, fallback string) string {
@@ -27,3 +177,47 @@ func GetEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// GetEnvList returns the comma separated values of an environment variable or fallback if not set
+func GetEnvList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// GetEnvInt returns the integer value of an environment variable or fallback if not set
+func GetEnvInt(key string, fallback int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return parsed, nil
+}
+
+// GetEnvDuration returns the duration value of an environment variable (e.g. "5s") or fallback if not set
+func GetEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,233 @@
+// Package webhooks delivers the change events queued for webhooks, signed with the secret of the webhook
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Clientdb-Event"
+	DeliveryHeader  = "X-Clientdb-Delivery"
+	SignatureHeader = "X-Clientdb-Signature"
+)
+
+// NewSecret returns a random secret for a new webhook
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Sign returns the signature header of a payload sent at timestamp, t=<unix time>,v1=<hex HMAC-SHA256>. The HMAC
+// covers the timestamp and the payload joined by a dot, receivers recompute it with the secret of the webhook and
+// should refuse old timestamps so a payload can't be replayed.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(payload)
+
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the wait before the next attempt of a delivery that failed failures times, base doubles after
+// every failure up to max
+func Backoff(failures int, base time.Duration, max time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < failures && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
+
+// Options configure a Dispatcher
+type Options struct {
+	// MaxAttempts is the number of failed attempts after which a delivery is dead
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt, it doubles after every attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds every attempt, including reading the response
+	Timeout time.Duration
+	// PollInterval is how often the queue is checked for due deliveries once it is empty
+	PollInterval time.Duration
+	// Workers is the number of deliveries attempted at the same time
+	Workers int
+}
+
+// Dispatcher delivers the queued deliveries to their webhooks, any number of dispatchers can share a queue
+type Dispatcher struct {
+	webhooks   repository.WebhookRepository
+	deliveries repository.DeliveryRepository
+	client     *http.Client
+	options    Options
+}
+
+// NewDispatcher returns a Dispatcher of the deliveries queued in store
+func NewDispatcher(store *repository.Store, options Options) *Dispatcher {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+
+	return &Dispatcher{
+		webhooks:   store.Webhooks,
+		deliveries: store.Deliveries,
+		client:     &http.Client{Timeout: options.Timeout},
+		options:    options,
+	}
+}
+
+// Run delivers the due deliveries until ctx is cancelled, an attempt in progress is abandoned and made again after
+// its lease
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(d.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for d.DeliverNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverNext claims the delivery that is due the longest and attempts it, it returns false when no delivery is due
+func (d *Dispatcher) DeliverNext(ctx context.Context) bool {
+	// the lease outlasts the attempt, so the delivery is only claimed again when its attempt was never recorded
+	lease := d.options.Timeout + time.Minute
+
+	delivery, err := d.deliveries.Claim(ctx, time.Now(), lease)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error("Failed to claim a webhook delivery: ", err)
+		}
+		return false
+	}
+
+	d.attempt(ctx, delivery)
+	return ctx.Err() == nil
+}
+
+// attempt sends the payload of delivery to its webhook and records the outcome, a failed delivery is retried after
+// a backoff until it runs out of attempts and is dead
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) {
+	logger := log.WithFields(log.Fields{"webhook_id": delivery.WebhookID.Hex(), "delivery_id": delivery.ID.Hex()})
+	now := time.Now()
+	attempt := models.DeliveryAttempt{AttemptedOn: now}
+
+	webhook, err := d.webhooks.Find(ctx, delivery.WebhookID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		attempt.Error = "webhook was deleted"
+		d.record(ctx, logger, delivery, attempt, models.DeliveryDead, delivery.Failures, nil)
+		return
+	case err != nil:
+		// the delivery is attempted again after the lease
+		logger.Error("Failed to get webhook: ", err)
+		return
+	case webhook.Disabled:
+		attempt.Error = "webhook is disabled"
+		d.record(ctx, logger, delivery, attempt, models.DeliveryDead, delivery.Failures, nil)
+		return
+	}
+
+	attempt.ResponseStatus, err = d.send(ctx, webhook, delivery, now)
+	attempt.DurationMS = time.Since(now).Milliseconds()
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		logger.Info("Delivered ", delivery.Event, " to webhook")
+		d.record(ctx, logger, delivery, attempt, models.DeliveryDelivered, delivery.Failures, nil)
+		return
+	}
+
+	attempt.Error = err.Error()
+	failures := delivery.Failures + 1
+	if failures >= d.options.MaxAttempts {
+		logger.Warn("Webhook delivery is dead after ", failures, " failed attempts: ", err)
+		d.record(ctx, logger, delivery, attempt, models.DeliveryDead, failures, nil)
+		return
+	}
+
+	next := now.Add(Backoff(failures, d.options.Backoff, d.options.MaxBackoff))
+	logger.Warn("Webhook delivery failed, retrying at ", next.Format(time.RFC3339), ": ", err)
+	d.record(ctx, logger, delivery, attempt, models.DeliveryPending, failures, &next)
+}
+
+// send posts the signed payload of delivery to the webhook and returns the response status, responses other than
+// 2xx are returned as error
+func (d *Dispatcher) send(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "clientdb-webhooks")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, delivery.ID.Hex())
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, now, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	// the body is read so the connection can be reused, it isn't kept
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+func (d *Dispatcher) record(ctx context.Context, logger *log.Entry, delivery models.WebhookDelivery, attempt models.DeliveryAttempt, status string, failures int, next *time.Time) {
+	if err := d.deliveries.Record(ctx, delivery.ID, attempt, status, failures, next); err != nil {
+		logger.Error("Failed to record webhook delivery attempt: ", err)
+	}
+}
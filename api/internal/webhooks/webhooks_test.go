@@ -0,0 +1,210 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/terrpan/clientdb/internal/models"
+	"github.com/terrpan/clientdb/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	log.SetOutput(io.Discard)
+}
+
+// verify checks a signature header the way a receiver does
+func verify(t *testing.T, secret string, header string, payload []byte) time.Time {
+	t.Helper()
+
+	parts := strings.Split(header, ",")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "t=") || !strings.HasPrefix(parts[1], "v1=") {
+		t.Fatalf("malformed signature %q", header)
+	}
+	unix, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "t="), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.TrimPrefix(parts[0], "t=") + "." + string(payload)))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.TrimPrefix(parts[1], "v1="))) {
+		t.Fatalf("signature %q doesn't match the payload", header)
+	}
+	return time.Unix(unix, 0)
+}
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"type":"client.created"}`)
+	timestamp := time.Unix(1767225600, 0)
+
+	signature := Sign("whsec_test", timestamp, payload)
+	if want := "t=1767225600,v1=6e246327f81a100b4f3650f6ea86a007045ebd34e07e151048367e7278087a8c"; signature != want {
+		t.Fatalf("Sign = %q, want %q", signature, want)
+	}
+	if got := verify(t, "whsec_test", signature, payload); !got.Equal(timestamp) {
+		t.Fatalf("timestamp = %s, want %s", got, timestamp)
+	}
+
+	// the signature covers the timestamp, the payload and the secret
+	for _, other := range []string{
+		Sign("whsec_test", timestamp.Add(time.Second), payload),
+		Sign("whsec_test", timestamp, []byte(`{"type":"client.deleted"}`)),
+		Sign("whsec_other", timestamp, payload),
+	} {
+		if other[strings.Index(other, "v1="):] == signature[strings.Index(signature, "v1="):] {
+			t.Errorf("%q signs the same as %q", other, signature)
+		}
+	}
+
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, "whsec_") || len(secret) != len("whsec_")+64 {
+		t.Fatalf("unexpected secret %q", secret)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for failures, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 10: time.Minute} {
+		if got := Backoff(failures, time.Second, time.Minute); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+// queue stores a webhook for url and a delivery of payload due now
+func queue(t *testing.T, store *repository.Store, url string, payload string) (models.Webhook, primitive.ObjectID) {
+	t.Helper()
+
+	webhook := models.Webhook{URL: url, Events: []string{"*"}, Secret: "whsec_test"}
+	id, err := store.Webhooks.Insert(context.Background(), webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.ID = id
+
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		ID:            primitive.NewObjectID(),
+		WebhookID:     id,
+		Event:         "client.created",
+		Payload:       []byte(payload),
+		Status:        models.DeliveryPending,
+		NextAttemptOn: &now,
+		CreatedOn:     now,
+	}
+	if err := store.Deliveries.Insert(context.Background(), []models.WebhookDelivery{delivery}); err != nil {
+		t.Fatal(err)
+	}
+	return webhook, delivery.ID
+}
+
+func TestDeliverNext(t *testing.T) {
+	store := repository.NewMemoryStore()
+	payload := `{"type":"client.created"}`
+
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verify(t, "whsec_test", r.Header.Get(SignatureHeader), body)
+		if string(body) != payload {
+			t.Errorf("body = %s, want %s", body, payload)
+		}
+		received <- r
+	}))
+	defer server.Close()
+
+	_, id := queue(t, store, server.URL, payload)
+	dispatcher := NewDispatcher(store, Options{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, Timeout: time.Second})
+
+	if !dispatcher.DeliverNext(context.Background()) {
+		t.Fatal("no delivery was due")
+	}
+	r := <-received
+	if r.Header.Get(EventHeader) != "client.created" || r.Header.Get(DeliveryHeader) != id.Hex() {
+		t.Fatalf("unexpected headers %v", r.Header)
+	}
+
+	delivery, err := store.Deliveries.Find(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != models.DeliveryDelivered || len(delivery.Attempts) != 1 || delivery.Attempts[0].ResponseStatus != http.StatusOK {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+
+	if dispatcher.DeliverNext(context.Background()) {
+		t.Fatal("a delivered delivery was due again")
+	}
+}
+
+func TestDeliverNextRetries(t *testing.T) {
+	store := repository.NewMemoryStore()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, id := queue(t, store, server.URL, `{}`)
+	dispatcher := NewDispatcher(store, Options{MaxAttempts: 2, Backoff: time.Minute, MaxBackoff: time.Hour, Timeout: time.Second})
+
+	before := time.Now()
+	dispatcher.DeliverNext(context.Background())
+	delivery, err := store.Deliveries.Find(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != models.DeliveryPending || delivery.Failures != 1 || delivery.NextAttemptOn == nil ||
+		delivery.NextAttemptOn.Before(before.Add(time.Minute)) || delivery.Attempts[0].ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+
+	// the retry isn't due before its backoff
+	if dispatcher.DeliverNext(context.Background()) {
+		t.Fatal("a retry was due before its backoff")
+	}
+
+	// once the retry is due its failure is the last attempt and leaves the delivery dead
+	if err := store.Deliveries.Record(context.Background(), id, models.DeliveryAttempt{}, models.DeliveryPending, 1, &before); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.DeliverNext(context.Background())
+	delivery, err = store.Deliveries.Find(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != models.DeliveryDead || delivery.Failures != 2 {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+}
+
+func TestDeliverNextToADeletedWebhook(t *testing.T) {
+	store := repository.NewMemoryStore()
+
+	webhook, id := queue(t, store, "http://127.0.0.1:0", `{}`)
+	if err := store.Webhooks.Delete(context.Background(), webhook.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	NewDispatcher(store, Options{MaxAttempts: 3, Timeout: time.Second}).DeliverNext(context.Background())
+	delivery, err := store.Deliveries.Find(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != models.DeliveryDead || delivery.Attempts[0].Error != "webhook was deleted" {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
-	"github.com/rs/cors"
 	log "github.com/sirupsen/logrus"
-	"github.com/terrpan/clientdb/internal/controllers"
+	"github.com/terrpan/clientdb/internal/app"
 	"github.com/terrpan/clientdb/internal/util"
 )
 
@@ -20,9 +22,11 @@ func init() {
 	})
 
 	log.SetOutput(os.Stdout)
+}
 
-	// set log level depending on env
-	switch strings.ToLower(util.LogLevel) {
+// setLogLevel sets the log level depending on env
+func setLogLevel(level string) {
+	switch strings.ToLower(level) {
 	case "debug":
 		log.SetLevel(log.DebugLevel)
 		log.SetReportCaller(true)
@@ -37,63 +41,79 @@ func init() {
 	log.Info("Log level set to: ", log.GetLevel().String())
 }
 
-// func Homehandler is dummy func for returning "I'm alive"
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("I'm alive"))
-}
-
-// commonMiddleware is a middleware for setting content type on on all requests
-func commonMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		next.ServeHTTP(w, r)
-	})
-}
+func main() {
 
-func logger(next http.Handler) http.Handler {
-	if log.GetLevel().String() == "debug" {
-		return handlers.CombinedLoggingHandler(os.Stdout, next)
+	config, err := util.LoadConfig()
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
 	}
-	return next
-}
 
-func main() {
+	setLogLevel(config.LogLevel)
 
-	util.DbConnect()
-	//print all os.envs
-	r := mux.NewRouter()
-
-	r.Use(commonMiddleware, logger)
-	r.HandleFunc("/", homeHandler)
-	r.HandleFunc("/api/clients", controllers.GetClients).Methods("GET")
-	r.HandleFunc("/api/clients/{id}", controllers.GetClientbyId).Methods("GET")
-	r.HandleFunc("/api/clients", controllers.AddClient).Methods("POST")
-	r.HandleFunc("/api/clients/{id}", controllers.UpdateClient).Methods("PUT", "PATCH")
-	r.HandleFunc("/api/clients/{id}", controllers.DeleteClient).Methods("DELETE")
-	r.HandleFunc("/api/services", controllers.GetServices).Methods("GET")
-	r.HandleFunc("/api/services/{id}", controllers.GetServiceById).Methods("GET")
-	r.HandleFunc("/api/services", controllers.AddService).Methods("POST")
-	r.HandleFunc("/api/services/{id}", controllers.UpdateService).Methods("PATCH", "PUT")
-	r.HandleFunc("/api/services/{id}", controllers.DeleteService).Methods("DELETE")
-	r.HandleFunc("/api/contacts", controllers.GetContacts).Methods("GET")
-	r.HandleFunc("/api/contacts/{id}", controllers.GetContactById).Methods("GET")
-	r.HandleFunc("/api/contacts", controllers.AddContact).Methods("POST")
-	r.HandleFunc("/api/contacts/{id}", controllers.UpdateContact).Methods("PATCH", "PUT")
-	r.HandleFunc("/api/contacts/{id}", controllers.DeleteContact).Methods("DELETE")
-	r.Handle("/", r)
-
-	// setup the cors
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "FETCH"},
-		ExposedHeaders:   []string{"Content-Type", "Accept", "X-Total-Count"},
-		AllowCredentials: true,
-	})
+	// the context is cancelled on SIGINT or SIGTERM, which starts the graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	application, err := app.New(ctx, config)
+	if err != nil {
+		log.Fatal("Failed to start: ", err)
+	}
+
+	// the requests run with a context that is cancelled once the shutdown stops waiting for them, so nothing keeps
+	// using the database after it is disconnected
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	srv := &http.Server{
-		Handler: c.Handler(r),
-		Addr:    ":8080",
+		Handler:      application.Router,
+		Addr:         config.ListenAddr,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+	}
+
+	// the event feeds never end on their own, they are closed as soon as the shutdown starts so the clients
+	// reconnect to another instance
+	srv.RegisterOnShutdown(application.Streams.Close)
+
+	// deleted documents are purged in the background until the shutdown starts
+	go application.PurgeTrash(ctx)
+
+	// change events are delivered to the webhooks in the background, deliveries left at shutdown are retried
+	// after the restart
+	go application.DeliverWebhooks(ctx)
+
+	go func() {
+		log.Info("Listening on ", config.ListenAddr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Info("Shutting down, draining in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	// stop accepting new connections and wait for the in-flight requests before closing the database client
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("Failed to drain in-flight requests: ", err)
+	}
+	cancelRequests()
+
+	// the WebSockets are hijacked connections, which the shutdown of the server doesn't wait for
+	if err := application.Streams.Wait(shutdownCtx); err != nil {
+		log.Error("Failed to close the event feeds: ", err)
+	}
+
+	if err := application.Close(shutdownCtx); err != nil {
+		log.Error("Failed to disconnect from MongoDB: ", err)
 	}
 
-	log.Fatal(srv.ListenAndServe())
+	log.Info("Shutdown complete")
 }
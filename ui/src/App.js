@@ -1,9 +1,10 @@
 import * as React from 'react';
-import { Admin, Resource,  ListGuesser, ShowGuesser, EditGuesser } from 'react-admin';
+import { Admin, Resource,  ListGuesser, ShowGuesser, EditGuesser, Layout, fetchUtils } from 'react-admin';
 import jsonServerProvider from 'ra-data-json-server';
 import clientIcon from '@material-ui/icons/Book';
 import serviceIcon from '@material-ui/icons/SettingsApplications';
 import contactsIcon from '@material-ui/icons/Contacts';
+import invoiceIcon from '@material-ui/icons/Receipt';
 
 import { 
   clientList, 
@@ -23,8 +24,58 @@ import {
   contactEdit,
   ContactCreate,
 } from './components/contacts';
+import {
+  invoiceList,
+  invoiceShow,
+} from './components/invoices';
+import { LiveUpdates } from './events';
+import { authHeaders, authProvider } from './authProvider';
+
+const apiUrl = 'http://localhost:3000/api'; // /api will be proxied
+
+// the API requires credentials, the token of the logged in user is sent with every request
+const httpClient = (url, options = {}) => {
+  options.headers = authHeaders(new Headers(options.headers || { Accept: 'application/json' }));
+  return fetchUtils.fetchJson(url, options);
+};
+const jsonServerDataProvider = jsonServerProvider(apiUrl, httpClient);
+
+// updates are only applied to the version the record was read at, a concurrent edit fails with 412
+const dataProvider = {
+  ...jsonServerDataProvider,
+  update: (resource, params) =>
+    httpClient(`${apiUrl}/${resource}/${params.id}`, {
+      method: 'PUT',
+      body: JSON.stringify(params.data),
+      headers: new Headers({ 'If-Match': `"${params.previousData.version}"` }),
+    }).then(({ json }) => ({ data: json })),
+  // the services, contacts and invoices of a client are paged through its sub-resources, e.g. /clients/{id}/services
+  getManyReference: (resource, params) => {
+    if (params.target !== 'client_id') {
+      return jsonServerDataProvider.getManyReference(resource, params);
+    }
+    const { page, perPage } = params.pagination;
+    const { field, order } = params.sort;
+    const query = new URLSearchParams({
+      _sort: field,
+      _order: order,
+      _start: (page - 1) * perPage,
+      _end: page * perPage,
+    });
+    return httpClient(`${apiUrl}/clients/${params.id}/${resource}?${query}`).then(({ headers, json }) => ({
+      data: json,
+      total: parseInt(headers.get('x-total-count'), 10),
+    }));
+  },
+};
+// the views are refreshed when the records change on the server
+const liveLayout = props => (
+  <>
+    <LiveUpdates url={`${apiUrl}/events`} />
+    <Layout {...props} />
+  </>
+);
 
-const dataProvider = jsonServerProvider('http://localhost:3000/api'); // /api will be proxied 
 // const dataProvider = jsonServerProvider('http://localhost:3000/api');
 
 // const dataProvider = jsonServerProvider('http://clientdb-api:8080/api');
@@ -33,7 +84,7 @@ const dataProvider = jsonServerProvider('http://localhost:3000/api'); // /api wi
 
 
 const app = () => (
-  <Admin dataProvider={dataProvider}>
+  <Admin dataProvider={dataProvider} authProvider={authProvider(apiUrl)} layout={liveLayout}>
     <Resource 
       name="clients" 
       list={clientList} 
@@ -58,6 +109,12 @@ const app = () => (
       create={ContactCreate}
       icon={contactsIcon} 
     />
+    <Resource
+      name="invoices"
+      list={invoiceList}
+      show={invoiceShow}
+      icon={invoiceIcon}
+    />
 
   </Admin>
 );
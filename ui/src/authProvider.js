@@ -0,0 +1,61 @@
+// users log in with their own username and password, the API returns a short-lived token which is kept in the
+// session storage of the tab and sent as a bearer token. No credentials are built into the bundle.
+const tokenKey = 'clientdb.token';
+
+export const getToken = () => {
+  const session = JSON.parse(sessionStorage.getItem(tokenKey) || 'null');
+  if (!session || session.expiresOn <= Date.now()) {
+    return null;
+  }
+  return session;
+};
+
+// authHeaders adds the token of the logged in user to headers
+export const authHeaders = headers => {
+  const session = getToken();
+  if (session) {
+    headers.set('Authorization', `Bearer ${session.token}`);
+  }
+  return headers;
+};
+
+export const authProvider = apiUrl => ({
+  login: async ({ username, password }) => {
+    const response = await fetch(`${apiUrl}/login`, {
+      method: 'POST',
+      headers: new Headers({ 'Content-Type': 'application/json', Accept: 'application/json' }),
+      body: JSON.stringify({ username, password }),
+    });
+    if (!response.ok) {
+      throw new Error(response.status === 401 ? 'Invalid username or password' : `Login failed with ${response.status}`);
+    }
+    const { access_token, expires_in, username: subject, roles } = await response.json();
+    sessionStorage.setItem(tokenKey, JSON.stringify({
+      token: access_token,
+      expiresOn: Date.now() + expires_in * 1000,
+      username: subject,
+      roles,
+    }));
+  },
+  logout: () => {
+    sessionStorage.removeItem(tokenKey);
+    return Promise.resolve();
+  },
+  // an expired token sends the user back to the login page
+  checkAuth: () => (getToken() ? Promise.resolve() : Promise.reject()),
+  checkError: ({ status }) => {
+    if (status === 401) {
+      sessionStorage.removeItem(tokenKey);
+      return Promise.reject();
+    }
+    return Promise.resolve();
+  },
+  getIdentity: () => {
+    const session = getToken();
+    return session ? Promise.resolve({ id: session.username, fullName: session.username }) : Promise.reject();
+  },
+  getPermissions: () => {
+    const session = getToken();
+    return Promise.resolve(session ? session.roles : []);
+  },
+});
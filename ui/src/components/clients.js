@@ -3,8 +3,8 @@ import {
   List,
   Datagrid,
   TextField,
-  ArrayField,
   DateField,
+  NumberField,
   Show,
   TabbedShowLayout,
   Tab,
@@ -21,15 +21,16 @@ import {
   FormTab,
   SelectInput,
   ReferenceInput, 
+  ReferenceManyField,
+  Pagination,
 } from 'react-admin';
 
-//TODO: not in use do to missing functionality in backend
 const clientFilters = [
   <TextInput label="Search" source="q" alwaysOn />,
 ]
 
 export const clientList = props => (
-  <List {...props}>
+  <List {...props} filters={clientFilters}>
     <Datagrid rowClick={"show"}>
       <TextField source="client_name" />
       <TextField source="slack_channel" />
@@ -50,23 +51,35 @@ export const clientShow = (props) => (
       <DateField source="created_on" showTime/>
     </Tab>
     <Tab label="Contacts">
-      <ArrayField source="client_contacts">
-        <Datagrid>
+      <ReferenceManyField reference="contacts" target="client_id" pagination={<Pagination />} addLabel={false}>
+        <Datagrid rowClick="show">
           <TextField source="full_name" />
           <EmailField source="email" />
           <TextField source="phone_number" />
           <TextField source="role" />
         </Datagrid>
-      </ArrayField>
+      </ReferenceManyField>
     </Tab>
     <Tab label="Services">
-      <ArrayField source="managed_services">
-        <Datagrid>
+      <ReferenceManyField reference="services" target="client_id" pagination={<Pagination />} addLabel={false}>
+        <Datagrid rowClick="show">
           <TextField source="service_name" />
           <TextField source="service_type" />
           <TextField source="service_description" />
         </Datagrid>
-      </ArrayField>
+      </ReferenceManyField>
+    </Tab>
+    <Tab label="Invoices">
+      <ReferenceManyField reference="invoices" target="client_id" sort={{ field: 'period_start', order: 'DESC' }} pagination={<Pagination />} addLabel={false}>
+        <Datagrid rowClick="show">
+          <TextField source="number" />
+          <DateField source="period_start" />
+          <DateField source="period_end" />
+          <TextField source="status" />
+          <NumberField source="total" />
+          <TextField source="currency" />
+        </Datagrid>
+      </ReferenceManyField>
     </Tab>
     </TabbedShowLayout>
   </Show>
@@ -0,0 +1,59 @@
+import * as React from 'react';
+import {
+  List,
+  Datagrid,
+  TextField,
+  DateField,
+  NumberField,
+  ReferenceField,
+  ArrayField,
+  Show,
+  SimpleShowLayout,
+} from 'react-admin';
+
+// invoices are generated per client through POST /api/clients/{id}/invoices, the UI only browses them
+export const invoiceList = props => (
+  <List {...props} sort={{ field: 'period_start', order: 'DESC' }}>
+    <Datagrid rowClick="show">
+      <TextField source="number" />
+      <ReferenceField source="client_id" reference="clients" link="show">
+        <TextField source="client_name" />
+      </ReferenceField>
+      <DateField source="period_start" />
+      <DateField source="period_end" />
+      <TextField source="status" />
+      <NumberField source="total" />
+      <TextField source="currency" />
+    </Datagrid>
+  </List>
+);
+
+export const invoiceShow = props => (
+  <Show {...props}>
+    <SimpleShowLayout>
+      <TextField source="number" />
+      <ReferenceField source="client_id" reference="clients" link="show">
+        <TextField source="client_name" />
+      </ReferenceField>
+      <DateField source="period_start" />
+      <DateField source="period_end" />
+      <TextField source="status" />
+      <ArrayField source="lines">
+        <Datagrid>
+          <TextField source="description" />
+          <TextField source="invoice_frequency" />
+          <NumberField source="quantity" />
+          <NumberField source="unit_amount" />
+          <NumberField source="amount" />
+        </Datagrid>
+      </ArrayField>
+      <NumberField source="total" />
+      <TextField source="currency" />
+      <DateField source="issued_on" showTime />
+      <DateField source="paid_on" showTime />
+      <DateField source="voided_on" showTime />
+      <TextField source="created_by" />
+      <DateField source="created_on" showTime />
+    </SimpleShowLayout>
+  </Show>
+);
@@ -26,6 +26,20 @@ import {
   useRefresh,
 } from 'react-admin';
 
+// the service lifecycle, the API rejects status changes the lifecycle doesn't allow
+const serviceStatuses = [
+  { id: 'proposed', name: 'Proposed' },
+  { id: 'onboarding', name: 'Onboarding' },
+  { id: 'active', name: 'Active' },
+  { id: 'suspended', name: 'Suspended' },
+  { id: 'decommissioned', name: 'Decommissioned' },
+];
+
+const currencies = [
+  { id: 'SEK', name: 'SEK' },
+  { id: 'EUR', name: 'EUR' },
+  { id: 'USD', name: 'USD' },
+];
 
 export const serviceList = props => (
   <List {...props}>
@@ -49,6 +63,9 @@ export const serviceShow = props => (
         <TextField source="service_name" />
         <TextField source="service_description" />
         <TextField source="service_type" />
+        <TextField source="service_status" />
+        <DateField source="status_changed_on" />
+        <TextField source="status_changed_by" />
         <DateField source="created_on" />
         <DateField source="modified_on" />
       </FormTab>
@@ -65,6 +82,7 @@ export const serviceShow = props => (
         <TextField source="invoice_amount" />
         <TextField source="invoice_frequency" />
         <TextField source="management_fee" />
+        <TextField source="currency" />
       </FormTab>
     </TabbedForm>
   </Show>
@@ -77,7 +95,7 @@ export const serviceEdit = props => (
       <TextInput source="service_type" />
       <TextInput source="service_owner" />
       <TextInput source="service_description" />
-      <TextInput source="service_status" />
+      <SelectInput source="service_status" choices={serviceStatuses} />
       <TextInput source="invoice_frequency" />
       <ReferenceArrayInput source="attached_to_client" reference="clients" label="Client" allowEmpty>
         <ArrayInput>
@@ -90,6 +108,7 @@ export const serviceEdit = props => (
       </ReferenceArrayInput>
       <NumberInput source="invoice_amount" />
       <NumberInput source="management_fee" />
+      <SelectInput source="currency" choices={currencies} />
     </SimpleForm>
   </Edit>
 );
@@ -112,6 +131,8 @@ export const ServiceCreate = props => {
         <TextInput source="service_type" />
         <TextInput source="service_owner" />
         <TextInput source="service_description" />
+        <SelectInput source="service_status" choices={serviceStatuses} defaultValue="proposed" />
+        <SelectInput source="currency" choices={currencies} defaultValue="SEK" />
         <ReferenceArrayInput source="attached_to_client" reference="clients" label="Client" allowEmpty>
           <ArrayInput>
           <SimpleFormIterator>
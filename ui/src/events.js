@@ -0,0 +1,88 @@
+import { useEffect } from 'react';
+import { useRefresh } from 'react-admin';
+import { authHeaders } from './authProvider';
+
+// the event feed is read with fetch instead of EventSource, which can't send the token
+const readEvents = async (url, lastEventId, signal, onEvent) => {
+  const headers = authHeaders(new Headers({ Accept: 'text/event-stream' }));
+  if (lastEventId) {
+    headers.set('Last-Event-ID', lastEventId);
+  }
+
+  const response = await fetch(url, { headers, signal });
+  if (response.status === 410) {
+    // the changes since the last event are lost, reload everything and start over
+    onEvent(null);
+    return { lastEventId: '' };
+  }
+  if (!response.ok) {
+    throw new Error(`event feed responded with ${response.status}`);
+  }
+
+  const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffer = '';
+  let retry;
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) {
+      return { lastEventId, retry };
+    }
+    buffer += value;
+
+    // messages end with a blank line, a message without data only moves the position
+    const messages = buffer.split('\n\n');
+    buffer = messages.pop();
+    for (const message of messages) {
+      let data = '';
+      for (const line of message.split('\n')) {
+        const [name, ...rest] = line.split(':');
+        const field = rest.join(':').replace(/^ /, '');
+        if (name === 'id') lastEventId = field;
+        if (name === 'data') data += field;
+        if (name === 'retry') retry = parseInt(field, 10);
+      }
+      if (data) {
+        onEvent(JSON.parse(data));
+      }
+    }
+  }
+};
+
+// LiveUpdates refreshes the views when clients, services or contacts change, including the changes of colleagues.
+// The feed is resumed at the last event after a disconnect so no change is missed
+export const LiveUpdates = ({ url }) => {
+  const refresh = useRefresh();
+
+  useEffect(() => {
+    const controller = new AbortController();
+    let timer;
+    // a burst of changes, e.g. a batch or an import, refreshes the views once
+    const onEvent = () => {
+      clearTimeout(timer);
+      timer = setTimeout(refresh, 250);
+    };
+
+    const run = async () => {
+      let lastEventId = '';
+      let retry = 3000;
+      while (!controller.signal.aborted) {
+        try {
+          const result = await readEvents(url, lastEventId, controller.signal, onEvent);
+          lastEventId = result.lastEventId;
+          retry = result.retry || retry;
+        } catch (error) {
+          if (controller.signal.aborted) return;
+        }
+        await new Promise(resolve => setTimeout(resolve, retry));
+      }
+    };
+    run();
+
+    return () => {
+      controller.abort();
+      clearTimeout(timer);
+    };
+  }, [url, refresh]);
+
+  return null;
+};